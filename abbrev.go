@@ -0,0 +1,299 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+// Abbreviation tables, see DWARFv5 section 7.5.3.
+
+var DebugInfo, DebugAbbrev []byte
+
+// abbrevTable is an abbreviation table of .debug_abbrev, tables of split
+// units are given offsets past the end of .debug_abbrev of the executable.
+type abbrevTable struct {
+	Off     int // offset of the table in the virtual .debug_abbrev section
+	RealOff int // offset of the table in the file containing it
+	Path    string
+	Decls   []*abbrevDecl
+	Units   []dwarf.Offset // first entry of every unit using the table
+	Err     string
+
+	byCode map[uint64]*abbrevDecl
+}
+
+type abbrevDecl struct {
+	Off      int
+	Code     uint64
+	Tag      dwarf.Tag
+	Children bool
+	Attrs    []abbrevAttr
+	Count    int // number of entries using the abbreviation
+}
+
+type abbrevAttr struct {
+	Attr  dwarf.Attr
+	Form  uint64
+	Const int64 // value of DW_FORM_implicit_const
+}
+
+func (a abbrevAttr) FormName() string {
+	if s, ok := formNames[a.Form]; ok {
+		return s
+	}
+	return fmt.Sprintf("DW_FORM_%#x", a.Form)
+}
+
+// abbrevUnit is a unit of .debug_info and the abbreviation table it uses.
+type abbrevUnit struct {
+	first, end dwarf.Offset // first entry and end of the unit
+	data       []byte       // section containing the unit
+	base       dwarf.Offset // offset of data in the virtual .debug_info section
+	table      *abbrevTable
+
+	version         uint16
+	addrSize, offsz int
+	byteOrder       binary.ByteOrder
+}
+
+var abbrevTables map[int]*abbrevTable
+var abbrevUnits []*abbrevUnit
+var abbrevsCounted bool
+
+func init() {
+	onReset(func() {
+		DebugInfo, DebugAbbrev = nil, nil
+		abbrevTables, abbrevUnits, abbrevsCounted = nil, nil, false
+	})
+}
+
+func loadAbbrevUnits() {
+	if abbrevUnits != nil {
+		return
+	}
+	abbrevTables = map[int]*abbrevTable{}
+	abbrevUnits = []*abbrevUnit{}
+	for hdrOff, first := range UnitHeaders {
+		readAbbrevUnit(DebugInfo, 0, int(hdrOff), first, DebugAbbrev, 0, "")
+	}
+	abase := len(DebugAbbrev)
+	for _, su := range Dwarf.Splits {
+		if su.data == nil {
+			continue
+		}
+		readAbbrevUnit(su.info, su.base, 0, su.cuOff, su.abbrev, abase, su.Path)
+		abase += len(su.abbrev)
+	}
+	if Dwarf.Types != nil {
+		for _, tu := range TypeUnits {
+			if tu.hdrOff >= Dwarf.typesBase {
+				readAbbrevUnit(DebugTypes, Dwarf.typesBase, int(tu.hdrOff-Dwarf.typesBase), tu.Off, DebugAbbrev, 0, "")
+			}
+		}
+	}
+	sort.Slice(abbrevUnits, func(i, j int) bool { return abbrevUnits[i].first < abbrevUnits[j].first })
+	for _, t := range abbrevTables {
+		sort.Slice(t.Units, func(i, j int) bool { return t.Units[i] < t.Units[j] })
+	}
+}
+
+// readAbbrevUnit reads the header of the unit at hdrOff in data and the
+// abbreviation table it references in abbrev.
+func readAbbrevUnit(data []byte, base dwarf.Offset, hdrOff int, first dwarf.Offset, abbrev []byte, abase int, path string) {
+	if hdrOff+4 > len(data) {
+		return
+	}
+	length, dwarf64, version, byteOrder := readDwarfLengthVersion(data[hdrOff:])
+	b := &lineBuf{data: data, off: hdrOff + 4, bo: byteOrder}
+	offsz := 4
+	if dwarf64 {
+		b.off += 8
+		offsz = 8
+	}
+	end := b.off + int(length)
+	b.u16()
+	var addrSize uint8
+	if version >= 5 {
+		b.u8() // unit type
+		addrSize = b.u8()
+	}
+	aoff := b.uint(offsz)
+	if version < 5 {
+		addrSize = b.u8()
+	}
+	if b.eof {
+		return
+	}
+	t := abbrevTableAt(abbrev, abase, int(aoff), path)
+	t.Units = append(t.Units, first)
+	abbrevUnits = append(abbrevUnits, &abbrevUnit{
+		first: first, end: base + dwarf.Offset(end), data: data, base: base, table: t,
+		version: uint16(version), addrSize: int(addrSize), offsz: offsz, byteOrder: byteOrder})
+}
+
+func abbrevTableAt(abbrev []byte, abase, off int, path string) *abbrevTable {
+	if t := abbrevTables[abase+off]; t != nil {
+		return t
+	}
+	t := &abbrevTable{Off: abase + off, RealOff: off, Path: path, byCode: map[uint64]*abbrevDecl{}}
+	abbrevTables[t.Off] = t
+	if off >= len(abbrev) {
+		t.Err = fmt.Sprintf("offset %#x is past the end of the section", off)
+		return t
+	}
+	b := &lineBuf{data: abbrev, off: off, bo: Arch.ByteOrder}
+	for {
+		d := &abbrevDecl{Off: b.off}
+		d.Code = b.uleb()
+		if b.eof {
+			t.Err = "missing terminator"
+			break
+		}
+		if d.Code == 0 {
+			break
+		}
+		d.Tag = dwarf.Tag(b.uleb())
+		d.Children = b.u8() != 0
+		for {
+			attr, form := b.uleb(), b.uleb()
+			if b.eof || (attr == 0 && form == 0) {
+				break
+			}
+			a := abbrevAttr{Attr: dwarf.Attr(attr), Form: form}
+			if form == _DW_FORM_implicit_const {
+				a.Const = b.sleb()
+			}
+			d.Attrs = append(d.Attrs, a)
+		}
+		if b.eof {
+			t.Err = fmt.Sprintf("abbreviation %d is truncated", d.Code)
+			break
+		}
+		if t.byCode[d.Code] != nil {
+			t.Err = fmt.Sprintf("abbreviation %d is declared more than once", d.Code)
+		} else {
+			t.byCode[d.Code] = d
+		}
+		t.Decls = append(t.Decls, d)
+	}
+	return t
+}
+
+// abbrevUnitFor returns the unit containing the entry at off.
+func abbrevUnitFor(off dwarf.Offset) *abbrevUnit {
+	loadAbbrevUnits()
+	i := sort.Search(len(abbrevUnits), func(i int) bool { return off < abbrevUnits[i].first })
+	if i > 0 && off < abbrevUnits[i-1].end {
+		return abbrevUnits[i-1]
+	}
+	return nil
+}
+
+// abbrevFor returns the abbreviation code of the entry at off and its
+// declaration, which is nil if the code is not in the table of the unit.
+func abbrevFor(off dwarf.Offset) (*abbrevUnit, uint64, *abbrevDecl) {
+	u := abbrevUnitFor(off)
+	if u == nil {
+		return nil, 0, nil
+	}
+	b := &lineBuf{data: u.data, off: int(off - u.base), bo: u.byteOrder}
+	code := b.uleb()
+	return u, code, u.table.byCode[code]
+}
+
+// countAbbrevs counts the entries using each abbreviation.
+func countAbbrevs() {
+	if abbrevsCounted {
+		return
+	}
+	abbrevsCounted = true
+	rdr := Dwarf.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if _, _, d := abbrevFor(e.Offset); d != nil {
+			d.Count++
+		}
+	}
+}
+
+func fmtEntryNodeAbbrev(e *dwarf.Entry) string {
+	u, code, d := abbrevFor(e.Offset)
+	if u == nil {
+		return ""
+	}
+	if d == nil {
+		return fmt.Sprintf(" <b>(abbreviation %d not found in <a href=\"/abbrev/%x\">table</a>)</b>", code, u.table.Off)
+	}
+	return fmt.Sprintf(" (<a href=\"/abbrev/%x#code%d\">abbrev %d</a>)", u.table.Off, code, code)
+}
+
+// fmtEntryNodeForm returns the form of the i-th attribute of e.
+func fmtEntryNodeForm(e *dwarf.Entry, i int) string {
+	_, _, d := abbrevFor(e.Offset)
+	if d == nil || i >= len(d.Attrs) || i >= len(e.Field) || d.Attrs[i].Attr != e.Field[i].Attr {
+		return ""
+	}
+	return d.Attrs[i].FormName()
+}
+
+func (en *EntryNode) AbbrevTable() *abbrevTable {
+	if u := abbrevUnitFor(en.E.Offset); u != nil {
+		return u.table
+	}
+	return nil
+}
+
+var abbrevTmpl = template.Must(template.New("abbrev").Parse(`<!doctype html>
+<html>
+<head>
+<title>Abbreviation table at {{.RealOff | printf "%#x"}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>{{if .Path}}.debug_abbrev.dwo{{else}}.debug_abbrev{{end}} table at {{.RealOff | printf "%#x"}}</h3>
+<table class='dwarftbl'>
+{{if .Path}}<tr><td>File</td><td><tt>{{.Path}}</tt></td></tr>{{end}}
+<tr><td>Abbreviations</td><td>{{len .Decls}}</td></tr>
+<tr><td>Used by</td><td>{{range .Units}}<a href="/{{. | printf "%x"}}">&lt;{{. | printf "%x"}}&gt;</a> {{end}}</td></tr>
+{{if .Err}}<tr><td>Problems</td><td><b>{{.Err}}</b></td></tr>{{end}}
+</table>
+<hr/>
+<tt><table class='dwarftbl'>
+<tr><th>Offset</th><th>Code</th><th>Tag</th><th>Children</th><th>Entries</th><th>Attributes</th></tr>
+{{range .Decls}}
+<tr><td>{{.Off | printf "%#x"}}</td><td><a name="code{{.Code}}">{{.Code}}</a></td><td>{{.Tag}}</td><td>{{if .Children}}yes{{else}}no{{end}}</td><td>{{.Count}}</td>
+<td><table>{{range .Attrs}}<tr><td>{{.Attr}}</td><td>{{.FormName}}{{if eq .FormName "DW_FORM_implicit_const"}} {{.Const}}{{end}}</td></tr>{{end}}</table></td></tr>
+{{end}}
+</table></tt>
+</body>
+</html>
+`))
+
+func abbrevHandler(w http.ResponseWriter, r *http.Request) {
+	off := offset(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	loadAbbrevUnits()
+	t := abbrevTables[int(off)]
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	countAbbrevs()
+	must(abbrevTmpl.Execute(w, t))
+}
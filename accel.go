@@ -0,0 +1,610 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// Accelerator tables: .debug_names (DWARFv5 section 6.1.1), .debug_pubnames
+// and .debug_pubtypes (DWARFv4 section 6.1.1) and the GNU variants used by
+// split DWARF.
+
+var DebugNames []byte
+var DebugPubSections []pubSection
+
+func init() {
+	onReset(func() {
+		DebugNames, DebugPubSections = nil, nil
+	})
+}
+
+type pubSection struct {
+	Name string
+	data []byte
+	gnu  bool // entries have a flags byte, .debug_gnu_pubnames and .debug_gnu_pubtypes
+}
+
+const (
+	_DW_IDX_compile_unit = 0x1
+	_DW_IDX_type_unit    = 0x2
+	_DW_IDX_die_offset   = 0x3
+	_DW_IDX_parent       = 0x4
+	_DW_IDX_type_hash    = 0x5
+	_DW_IDX_GNU_internal = 0x2000
+	_DW_IDX_GNU_external = 0x2001
+)
+
+var idxNames = map[uint64]string{
+	_DW_IDX_compile_unit: "DW_IDX_compile_unit",
+	_DW_IDX_type_unit:    "DW_IDX_type_unit",
+	_DW_IDX_die_offset:   "DW_IDX_die_offset",
+	_DW_IDX_parent:       "DW_IDX_parent",
+	_DW_IDX_type_hash:    "DW_IDX_type_hash",
+	_DW_IDX_GNU_internal: "DW_IDX_GNU_internal",
+	_DW_IDX_GNU_external: "DW_IDX_GNU_external",
+}
+
+func loadAccelSections(getSection func(name string) []byte) {
+	DebugNames = getSection("names")
+	DebugPubSections = nil
+	for _, name := range []string{"pubnames", "pubtypes", "gnu_pubnames", "gnu_pubtypes"} {
+		if data := getSection(name); data != nil {
+			DebugPubSections = append(DebugPubSections, pubSection{".debug_" + name, data, strings.HasPrefix(name, "gnu_")})
+		}
+	}
+}
+
+// dieNames maps the offset of every entry to the names it can be indexed
+// under, used to check the entries of the accelerator tables.
+type dieNames map[dwarf.Offset]*dieName
+
+type dieName struct {
+	names []string
+	refs  []dwarf.Offset // DW_AT_specification and DW_AT_abstract_origin
+}
+
+func readDIENames() dieNames {
+	r := dieNames{}
+	rdr := Dwarf.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		dn := &dieName{}
+		for _, attr := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrLinkageName, _DW_AT_MIPS_linkage_name} {
+			if s, ok := e.Val(attr).(string); ok {
+				dn.names = append(dn.names, s)
+			}
+		}
+		for _, attr := range []dwarf.Attr{dwarf.AttrSpecification, dwarf.AttrAbstractOrigin} {
+			if off, ok := e.Val(attr).(dwarf.Offset); ok {
+				dn.refs = append(dn.refs, off)
+			}
+		}
+		r[e.Offset] = dn
+	}
+	return r
+}
+
+const _DW_AT_MIPS_linkage_name = 0x2007
+
+// check returns a description of the problem with an index entry for name
+// pointing to off, or the empty string.
+func (dn dieNames) check(off dwarf.Offset, name string) string {
+	e := dn[off]
+	if e == nil {
+		return fmt.Sprintf("%#x is not the offset of an entry", off)
+	}
+	seen := map[dwarf.Offset]bool{}
+	var names []string
+	var visit func(off dwarf.Offset)
+	visit = func(off dwarf.Offset) {
+		e := dn[off]
+		if e == nil || seen[off] {
+			return
+		}
+		seen[off] = true
+		names = append(names, e.names...)
+		for _, ref := range e.refs {
+			visit(ref)
+		}
+	}
+	visit(off)
+	for _, n := range names {
+		if n == name {
+			return ""
+		}
+	}
+	if len(names) == 0 {
+		return "entry has no name"
+	}
+	return fmt.Sprintf("name does not match the entry (%s)", strings.Join(names, ", "))
+}
+
+// unitDIEOffset converts an offset relative to the unit header at hdrOff
+// to an entry offset. For skeleton units the offset refers to the split unit.
+func unitDIEOffset(hdrOff, off dwarf.Offset) dwarf.Offset {
+	if cuOff, ok := UnitHeaders[hdrOff]; ok {
+		if su := Dwarf.splitForSkeleton(cuOff); su != nil && su.data != nil {
+			return su.base + off
+		}
+	}
+	return hdrOff + off
+}
+
+// pubSet is a set of entries of .debug_pubnames or .debug_pubtypes.
+type pubSet struct {
+	Off        int
+	Length     uint64
+	Version    uint16
+	InfoOffset dwarf.Offset
+	InfoLength uint64
+	Entries    []pubEntry
+	Err        string
+}
+
+type pubEntry struct {
+	Name    string
+	Off     dwarf.Offset // offset relative to the unit header
+	DIE     dwarf.Offset
+	Flags   string // GNU variants only
+	Problem string
+}
+
+const (
+	_GDB_INDEX_SYMBOL_STATIC_SHIFT = 7
+	_GDB_INDEX_SYMBOL_KIND_SHIFT   = 4
+)
+
+var gdbIndexKinds = []string{"none", "type", "variable", "function", "other", "kind 5", "kind 6", "unused"}
+
+func readPubSection(sect pubSection, dn dieNames) []*pubSet {
+	var r []*pubSet
+	data := sect.data
+	for off := 0; off < len(data); {
+		set := &pubSet{Off: off}
+		r = append(r, set)
+		length, dwarf64, _, byteOrder := readDwarfLengthVersion(data[off:])
+		set.Length = length
+		b := &lineBuf{data: data, off: off + 4, bo: byteOrder}
+		offsz := 4
+		if dwarf64 {
+			b.off += 8
+			offsz = 8
+		}
+		end := b.off + int(length)
+		if length == 0 || end > len(data) || end < b.off {
+			set.Err = "truncated set"
+			break
+		}
+		b.data = data[:end]
+		set.Version = b.u16()
+		set.InfoOffset = dwarf.Offset(b.uint(offsz))
+		set.InfoLength = b.uint(offsz)
+		for b.off < end {
+			e := pubEntry{Off: dwarf.Offset(b.uint(offsz))}
+			if e.Off == 0 || b.eof {
+				break
+			}
+			if sect.gnu {
+				flags := b.u8()
+				e.Flags = gdbIndexKinds[(flags>>_GDB_INDEX_SYMBOL_KIND_SHIFT)&7]
+				if flags&(1<<_GDB_INDEX_SYMBOL_STATIC_SHIFT) != 0 {
+					e.Flags += ", static"
+				} else {
+					e.Flags += ", global"
+				}
+			}
+			e.Name = b.cstr()
+			e.DIE = unitDIEOffset(set.InfoOffset, e.Off)
+			e.Problem = dn.check(e.DIE, e.Name)
+			set.Entries = append(set.Entries, e)
+		}
+		off = end
+	}
+	return r
+}
+
+// nameIndex is a name index of .debug_names.
+type nameIndex struct {
+	Off                 int
+	Length              uint64
+	Dwarf64             bool
+	Version             uint16
+	CUs, LocalTUs       []dwarf.Offset
+	ForeignTUs          []uint64
+	BucketCount         uint32
+	NameCount           uint32
+	AbbrevTableSize     uint32
+	Augmentation        string
+	Abbrevs             []*nameAbbrev
+	Names               []*nameIndexName
+	Err                 string
+	Problems            int
+	abbrevByCode        map[uint64]*nameAbbrev
+	entryPool, entryEnd int
+}
+
+type nameAbbrev struct {
+	Code, Tag uint64
+	Attrs     []nameAbbrevAttr
+}
+
+func (a *nameAbbrev) TagName() string {
+	return dwarf.Tag(a.Tag).String()
+}
+
+type nameAbbrevAttr struct {
+	Idx, Form uint64
+}
+
+func (a nameAbbrevAttr) String() string {
+	idx := idxNames[a.Idx]
+	if idx == "" {
+		idx = fmt.Sprintf("DW_IDX_%#x", a.Idx)
+	}
+	form := formNames[a.Form]
+	if form == "" {
+		form = fmt.Sprintf("DW_FORM_%#x", a.Form)
+	}
+	return idx + " " + form
+}
+
+type nameIndexName struct {
+	Index   int
+	Bucket  int
+	Hash    uint32
+	Name    string
+	Entries []*nameIndexEntry
+	Problem string
+}
+
+type nameIndexEntry struct {
+	Off     int // offset in the entry pool
+	Abbrev  *nameAbbrev
+	Attrs   []string
+	DIE     dwarf.Offset
+	HasDIE  bool
+	Problem string
+}
+
+// djbHash is the hash function used by .debug_names.
+func djbHash(s string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(s); i++ {
+		h = h*33 + uint32(s[i])
+	}
+	return h
+}
+
+func readNameIndexes(data []byte, dn dieNames) []*nameIndex {
+	var r []*nameIndex
+	for off := 0; off < len(data); {
+		ni := &nameIndex{Off: off, abbrevByCode: map[uint64]*nameAbbrev{}}
+		r = append(r, ni)
+		length, dwarf64, _, byteOrder := readDwarfLengthVersion(data[off:])
+		ni.Length, ni.Dwarf64 = length, dwarf64
+		b := &lineBuf{data: data, off: off + 4, bo: byteOrder}
+		offsz := 4
+		if dwarf64 {
+			b.off += 8
+			offsz = 8
+		}
+		end := b.off + int(length)
+		if length == 0 || end > len(data) || end < b.off {
+			ni.Err = "truncated name index"
+			break
+		}
+		b.data = data[:end]
+		if err := ni.readIndex(b, offsz, dn); err != nil {
+			ni.Err = err.Error()
+		} else if b.eof {
+			ni.Err = "truncated name index"
+		}
+		off = end
+	}
+	return r
+}
+
+func (ni *nameIndex) readIndex(b *lineBuf, offsz int, dn dieNames) error {
+	ni.Version = b.u16()
+	b.u16() // padding
+	cuCount, localTUCount, foreignTUCount := b.u32(), b.u32(), b.u32()
+	ni.BucketCount, ni.NameCount = b.u32(), b.u32()
+	ni.AbbrevTableSize = b.u32()
+	augSize := b.u32()
+	ni.Augmentation = strings.TrimRight(string(b.bytes(int((augSize+3)&^3))), "\x00")
+	for i := uint32(0); i < cuCount && !b.eof; i++ {
+		ni.CUs = append(ni.CUs, dwarf.Offset(b.uint(offsz)))
+	}
+	for i := uint32(0); i < localTUCount && !b.eof; i++ {
+		ni.LocalTUs = append(ni.LocalTUs, dwarf.Offset(b.uint(offsz)))
+	}
+	for i := uint32(0); i < foreignTUCount && !b.eof; i++ {
+		ni.ForeignTUs = append(ni.ForeignTUs, b.u64())
+	}
+	// the counts are untrusted, check that the arrays fit in the index
+	// before allocating them
+	need := 4*uint64(ni.BucketCount) + 2*uint64(offsz)*uint64(ni.NameCount)
+	if ni.BucketCount > 0 {
+		need += 4 * uint64(ni.NameCount)
+	}
+	if need > uint64(len(b.data)-b.off) {
+		return fmt.Errorf("%d buckets and %d names do not fit in the name index", ni.BucketCount, ni.NameCount)
+	}
+	buckets := make([]uint32, ni.BucketCount)
+	for i := range buckets {
+		buckets[i] = b.u32()
+		if b.eof {
+			return nil
+		}
+	}
+	hashes := make([]uint32, 0, ni.NameCount)
+	if ni.BucketCount > 0 {
+		for i := uint32(0); i < ni.NameCount && !b.eof; i++ {
+			hashes = append(hashes, b.u32())
+		}
+	}
+	strOffs := make([]uint64, 0, ni.NameCount)
+	for i := uint32(0); i < ni.NameCount && !b.eof; i++ {
+		strOffs = append(strOffs, b.uint(offsz))
+	}
+	entryOffs := make([]uint64, 0, ni.NameCount)
+	for i := uint32(0); i < ni.NameCount && !b.eof; i++ {
+		entryOffs = append(entryOffs, b.uint(offsz))
+	}
+	if b.eof {
+		return nil
+	}
+
+	abbrevEnd := b.off + int(ni.AbbrevTableSize)
+	for b.off < abbrevEnd && !b.eof {
+		a := &nameAbbrev{Code: b.uleb()}
+		if a.Code == 0 {
+			break
+		}
+		a.Tag = b.uleb()
+		for !b.eof {
+			attr := nameAbbrevAttr{b.uleb(), b.uleb()}
+			if attr.Idx == 0 && attr.Form == 0 {
+				break
+			}
+			a.Attrs = append(a.Attrs, attr)
+		}
+		ni.Abbrevs = append(ni.Abbrevs, a)
+		ni.abbrevByCode[a.Code] = a
+	}
+	ni.entryPool = abbrevEnd
+	ni.entryEnd = len(b.data)
+
+	// bucket of each name, names in a bucket are consecutive
+	bucketOf := make([]int, ni.NameCount)
+	for i := range bucketOf {
+		bucketOf[i] = -1
+	}
+	for bi, first := range buckets {
+		if first == 0 {
+			continue
+		}
+		for i := int(first) - 1; i < len(bucketOf) && i < len(hashes); i++ {
+			if i > int(first)-1 && hashes[i]%ni.BucketCount != uint32(bi) {
+				break
+			}
+			bucketOf[i] = bi
+		}
+	}
+
+	poolSize := uint64(0)
+	if ni.entryEnd > ni.entryPool {
+		poolSize = uint64(ni.entryEnd - ni.entryPool)
+	}
+	for i := range strOffs {
+		n := &nameIndexName{Index: i + 1, Bucket: bucketOf[i], Name: cstrAt(DebugStr, strOffs[i])}
+		var problems []string
+		if i < len(hashes) {
+			n.Hash = hashes[i]
+			if h := djbHash(n.Name); h != n.Hash {
+				problems = append(problems, fmt.Sprintf("hash of the name is %#x", h))
+			}
+			if n.Bucket < 0 {
+				problems = append(problems, "name is not reachable from any bucket")
+			} else if n.Hash%ni.BucketCount != uint32(n.Bucket) {
+				problems = append(problems, fmt.Sprintf("name is in bucket %d but its hash is in bucket %d", n.Bucket, n.Hash%ni.BucketCount))
+			}
+		}
+		if entryOffs[i] >= poolSize {
+			problems = append(problems, fmt.Sprintf("entry offset %#x is past the end of the entry pool", entryOffs[i]))
+		} else {
+			n.Entries = ni.readEntries(b, offsz, ni.entryPool+int(entryOffs[i]), n.Name, dn)
+		}
+		n.Problem = strings.Join(problems, ", ")
+		if n.Problem != "" {
+			ni.Problems++
+		}
+		for _, e := range n.Entries {
+			if e.Problem != "" {
+				ni.Problems++
+			}
+		}
+		ni.Names = append(ni.Names, n)
+	}
+	return nil
+}
+
+// readEntries reads the series of entries at off in the entry pool.
+func (ni *nameIndex) readEntries(b *lineBuf, offsz int, off int, name string, dn dieNames) []*nameIndexEntry {
+	var r []*nameIndexEntry
+	b.off, b.eof = off, false
+	for b.off < ni.entryEnd {
+		e := &nameIndexEntry{Off: b.off - ni.entryPool}
+		code := b.uleb()
+		if code == 0 || b.eof {
+			break
+		}
+		r = append(r, e)
+		e.Abbrev = ni.abbrevByCode[code]
+		if e.Abbrev == nil {
+			e.Problem = fmt.Sprintf("unknown abbreviation %d", code)
+			break
+		}
+		unit := -1
+		isTU := false
+		var dieOff uint64
+		hasDIEOff := false
+		for _, attr := range e.Abbrev.Attrs {
+			var v uint64
+			switch attr.Form {
+			case 0x0b, 0x11, 0x0c: // DW_FORM_data1, DW_FORM_ref1, DW_FORM_flag
+				v = b.uint(1)
+			case 0x05, 0x12: // DW_FORM_data2, DW_FORM_ref2
+				v = b.uint(2)
+			case 0x06, 0x13: // DW_FORM_data4, DW_FORM_ref4
+				v = b.uint(4)
+			case 0x07, 0x14: // DW_FORM_data8, DW_FORM_ref8
+				v = b.uint(8)
+			case 0x0f, 0x15: // DW_FORM_udata, DW_FORM_ref_udata
+				v = b.uleb()
+			case 0x19: // DW_FORM_flag_present
+				v = 1
+			case 0x1e: // DW_FORM_data16
+				b.bytes(16)
+			default:
+				e.Problem = fmt.Sprintf("unsupported form %#x", attr.Form)
+				return r
+			}
+			idx := idxNames[attr.Idx]
+			if idx == "" {
+				idx = fmt.Sprintf("DW_IDX_%#x", attr.Idx)
+			}
+			switch attr.Idx {
+			case _DW_IDX_compile_unit:
+				unit = int(v)
+			case _DW_IDX_type_unit:
+				unit, isTU = int(v), true
+			case _DW_IDX_die_offset:
+				dieOff, hasDIEOff = v, true
+			}
+			if attr.Idx == _DW_IDX_parent && attr.Form != 0x19 {
+				e.Attrs = append(e.Attrs, fmt.Sprintf("%s entry at %#x", idx, v))
+			} else {
+				e.Attrs = append(e.Attrs, fmt.Sprintf("%s %#x", idx, v))
+			}
+		}
+		if !hasDIEOff {
+			continue
+		}
+		if unit < 0 && !isTU && len(ni.CUs) == 1 {
+			unit = 0
+		}
+		switch {
+		case isTU && unit >= len(ni.LocalTUs):
+			// entry of a foreign type unit, in a .dwo file
+		case isTU:
+			e.DIE, e.HasDIE = unitDIEOffset(ni.LocalTUs[unit], dwarf.Offset(dieOff)), true
+		case unit >= 0 && unit < len(ni.CUs):
+			e.DIE, e.HasDIE = unitDIEOffset(ni.CUs[unit], dwarf.Offset(dieOff)), true
+		default:
+			e.Problem = fmt.Sprintf("bad unit index %d", unit)
+		}
+		if e.HasDIE {
+			e.Problem = dn.check(e.DIE, name)
+		}
+	}
+	return r
+}
+
+var accelTmpl = template.Must(template.New("accel").Parse(`<!doctype html>
+<html>
+<head>
+<title>Accelerator tables</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+{{if not (or .Names .Pub)}}The executable has no accelerator tables{{end}}
+{{range .Names}}
+<h3>.debug_names index at {{.Off | printf "%#x"}}</h3>
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<table class='dwarftbl'>
+<tr><td>Unit length</td><td>{{.Length}}{{if .Dwarf64}} (64-bit DWARF){{end}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Compile units</td><td>{{range .CUs}}{{printf "%#x" .}} {{end}}</td></tr>
+<tr><td>Local type units</td><td>{{range .LocalTUs}}{{printf "%#x" .}} {{end}}</td></tr>
+<tr><td>Foreign type units</td><td>{{range .ForeignTUs}}{{printf "%#x" .}} {{end}}</td></tr>
+<tr><td>Bucket count</td><td>{{.BucketCount}}</td></tr>
+<tr><td>Name count</td><td>{{.NameCount}}</td></tr>
+<tr><td>Abbreviation table size</td><td>{{.AbbrevTableSize}}</td></tr>
+<tr><td>Augmentation</td><td>{{.Augmentation | printf "%q"}}</td></tr>
+<tr><td>Problems</td><td>{{if .Problems}}<b>{{.Problems}}</b>{{else}}none{{end}}</td></tr>
+</table>
+<h4>Abbreviations</h4>
+<table class='dwarftbl'>
+{{range .Abbrevs}}<tr><td>{{.Code}}</td><td>{{.TagName}}</td><td>{{range .Attrs}}{{.}}<br>{{end}}</td></tr>
+{{end}}
+</table>
+<h4>Names</h4>
+<tt><table class='dwarftbl'>
+<tr><th>#</th><th>Bucket</th><th>Hash</th><th>Name</th><th>Entries</th></tr>
+{{range .Names}}
+<tr>
+<td>{{.Index}}</td><td>{{.Bucket}}</td><td>{{.Hash | printf "%#08x"}}</td>
+<td>{{.Name}}{{with .Problem}}<br><b>{{.}}</b>{{end}}</td>
+<td>{{range .Entries}}
+{{.Off | printf "%#x"}}: {{with .Abbrev}}{{.TagName}}{{end}} {{range .Attrs}}{{.}} {{end}}
+{{if .HasDIE}}<a href="/{{.DIE | printf "%x"}}">&lt;{{.DIE | printf "%x"}}&gt;</a>{{end}}
+{{with .Problem}}<b>{{.}}</b>{{end}}<br>
+{{end}}</td>
+</tr>
+{{end}}
+</table></tt>
+<hr/>
+{{end}}
+{{range .Pub}}
+<h3>{{.Name}}</h3>
+{{range .Sets}}
+<h4>Set at {{.Off | printf "%#x"}}, unit at {{.InfoOffset | printf "%#x"}}</h4>
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<table class='dwarftbl'>
+<tr><td>Unit length</td><td>{{.Length}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Debug info length</td><td>{{.InfoLength | printf "%#x"}}</td></tr>
+</table>
+<tt><table class='dwarftbl'>
+<tr><th>Offset</th><th>Entry</th><th>Name</th><th>Flags</th><th></th></tr>
+{{range .Entries}}<tr><td>{{.Off | printf "%#x"}}</td><td><a href="/{{.DIE | printf "%x"}}">&lt;{{.DIE | printf "%x"}}&gt;</a></td><td>{{.Name}}</td><td>{{.Flags}}</td><td>{{with .Problem}}<b>{{.}}</b>{{end}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+<hr/>
+{{end}}
+</body>
+</html>
+`))
+
+func accelHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dn := readDIENames()
+	type pub struct {
+		Name string
+		Sets []*pubSet
+	}
+	var pubs []pub
+	for _, sect := range DebugPubSections {
+		pubs = append(pubs, pub{sect.Name, readPubSection(sect, dn)})
+	}
+	must(accelTmpl.Execute(w, struct {
+		Names []*nameIndex
+		Pub   []pub
+	}{readNameIndexes(DebugNames, dn), pubs}))
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+// arangeSet is a set of address ranges of .debug_aranges, see DWARFv5
+// section 6.1.2.
+type arangeSet struct {
+	Off        int
+	Length     uint64
+	Dwarf64    bool
+	Version    uint16
+	InfoOffset dwarf.Offset // offset of the unit header in .debug_info
+	AddrSize   uint8
+	SegSize    uint8
+	Ranges     [][2]uint64
+	Err        string
+}
+
+// Aranges is the contents of .debug_aranges.
+var Aranges []*arangeSet
+
+type arangeEntry struct {
+	lo, hi uint64
+	cu     *dwarf.Entry
+}
+
+// arangesIndex maps address ranges to compile units, sorted by address.
+var arangesIndex []arangeEntry
+
+func init() {
+	onReset(func() {
+		Aranges, arangesIndex = nil, nil
+	})
+}
+
+func readAranges(data []byte) []*arangeSet {
+	var r []*arangeSet
+	for off := 0; off < len(data); {
+		set := &arangeSet{Off: off}
+		r = append(r, set)
+		length, dwarf64, _, byteOrder := readDwarfLengthVersion(data[off:])
+		set.Length, set.Dwarf64 = length, dwarf64
+		b := &lineBuf{data: data, off: off + 4, bo: byteOrder}
+		offsz := 4
+		if dwarf64 {
+			b.off += 8
+			offsz = 8
+		}
+		end := b.off + int(length)
+		if length == 0 || end > len(data) || end < b.off {
+			set.Err = "truncated set"
+			break
+		}
+		b.data = data[:end]
+		set.Version = b.u16()
+		set.InfoOffset = dwarf.Offset(b.uint(offsz))
+		set.AddrSize = b.u8()
+		set.SegSize = b.u8()
+		if set.AddrSize != 4 && set.AddrSize != 8 {
+			set.Err = fmt.Sprintf("unsupported address size %d", set.AddrSize)
+			off = end
+			continue
+		}
+		// the first tuple is aligned to twice the size of a tuple entry
+		tupsz := 2 * int(set.AddrSize)
+		if set.SegSize != 0 {
+			tupsz = int(set.SegSize) + 2*int(set.AddrSize)
+		}
+		if rem := (b.off - off) % tupsz; rem != 0 {
+			b.off += tupsz - rem
+		}
+		for b.off < end {
+			b.bytes(int(set.SegSize))
+			addr, n := b.uint(int(set.AddrSize)), b.uint(int(set.AddrSize))
+			if b.eof {
+				set.Err = "missing terminator"
+				break
+			}
+			if addr == 0 && n == 0 {
+				break
+			}
+			set.Ranges = append(set.Ranges, [2]uint64{addr, addr + n})
+		}
+		off = end
+	}
+	return r
+}
+
+// Unit returns the compile unit described by set.
+func (set *arangeSet) Unit() *dwarf.Entry {
+	off, ok := UnitHeaders[set.InfoOffset]
+	if !ok {
+		return nil
+	}
+	if su := Dwarf.splitForSkeleton(off); su != nil && su.data != nil {
+		// the ranges of a skeleton unit belong to the split unit
+		off = su.cuOff
+	}
+	for _, cu := range compileUnits {
+		if cu.Offset == off {
+			return cu
+		}
+	}
+	rdr := Dwarf.Reader()
+	rdr.Seek(off)
+	e, _ := rdr.Next()
+	return e
+}
+
+// arangesLookup returns the compile unit containing pc according to
+// .debug_aranges.
+func arangesLookup(pc uint64) *dwarf.Entry {
+	if arangesIndex == nil && len(Aranges) > 0 {
+		arangesIndex = []arangeEntry{}
+		for _, set := range Aranges {
+			cu := set.Unit()
+			if cu == nil {
+				continue
+			}
+			for _, rng := range set.Ranges {
+				arangesIndex = append(arangesIndex, arangeEntry{rng[0], rng[1], cu})
+			}
+		}
+		sort.Slice(arangesIndex, func(i, j int) bool { return arangesIndex[i].lo < arangesIndex[j].lo })
+	}
+	i := sort.Search(len(arangesIndex), func(i int) bool { return pc < arangesIndex[i].lo })
+	if i > 0 && pc < arangesIndex[i-1].hi {
+		return arangesIndex[i-1].cu
+	}
+	return nil
+}
+
+// normalizeRanges returns rngs sorted with overlapping and adjacent ranges
+// merged and empty ranges removed.
+func normalizeRanges(rngs [][2]uint64) [][2]uint64 {
+	rngs = append([][2]uint64(nil), rngs...)
+	sort.Slice(rngs, func(i, j int) bool { return rngs[i][0] < rngs[j][0] })
+	var r [][2]uint64
+	for _, rng := range rngs {
+		if rng[0] >= rng[1] {
+			continue
+		}
+		if len(r) > 0 && rng[0] <= r[len(r)-1][1] {
+			if rng[1] > r[len(r)-1][1] {
+				r[len(r)-1][1] = rng[1]
+			}
+			continue
+		}
+		r = append(r, rng)
+	}
+	return r
+}
+
+// subtractRanges returns the parts of a not covered by b, both must be
+// normalized.
+func subtractRanges(a, b [][2]uint64) [][2]uint64 {
+	var r [][2]uint64
+	for _, rng := range a {
+		lo := rng[0]
+		for _, x := range b {
+			if x[1] <= lo || x[0] >= rng[1] {
+				continue
+			}
+			if x[0] > lo {
+				r = append(r, [2]uint64{lo, x[0]})
+			}
+			lo = x[1]
+		}
+		if lo < rng[1] {
+			r = append(r, [2]uint64{lo, rng[1]})
+		}
+	}
+	return r
+}
+
+type arangesProblem struct {
+	Unit    *dwarf.Entry
+	Problem string
+}
+
+// arangesCheck compares .debug_aranges with the ranges of the compile units.
+func arangesCheck() []arangesProblem {
+	var r []arangesProblem
+	cuRanges := map[dwarf.Offset][][2]uint64{}
+	for _, set := range Aranges {
+		cu := set.Unit()
+		if cu == nil {
+			r = append(r, arangesProblem{nil, fmt.Sprintf("set at %#x references unit %#x which does not exist", set.Off, set.InfoOffset)})
+			continue
+		}
+		cuRanges[cu.Offset] = append(cuRanges[cu.Offset], set.Ranges...)
+	}
+	for _, cu := range compileUnits {
+		rngs, _ := Dwarf.Ranges(cu)
+		rngs = normalizeRanges(rngs)
+		ar, ok := cuRanges[cu.Offset]
+		if !ok {
+			if len(rngs) > 0 {
+				r = append(r, arangesProblem{cu, "compile unit has address ranges but no set in .debug_aranges"})
+			}
+			continue
+		}
+		ar = normalizeRanges(ar)
+		for _, rng := range subtractRanges(ar, rngs) {
+			r = append(r, arangesProblem{cu, fmt.Sprintf("%#x..%#x is in .debug_aranges but not in the ranges of the compile unit", rng[0], rng[1])})
+		}
+		for _, rng := range subtractRanges(rngs, ar) {
+			r = append(r, arangesProblem{cu, fmt.Sprintf("%#x..%#x is in the ranges of the compile unit but not in .debug_aranges", rng[0], rng[1])})
+		}
+	}
+	return r
+}
+
+var arangesTmpl = template.Must(template.New("aranges").Funcs(funcMap).Funcs(template.FuncMap{
+	"RangeLen": func(rng [2]uint64) uint64 { return rng[1] - rng[0] },
+}).Parse(`<!doctype html>
+<html>
+<head>
+<title>.debug_aranges</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>.debug_aranges</h3>
+{{if not .Sets}}
+The executable has no .debug_aranges section
+{{else}}
+<h4>Consistency check</h4>
+{{with .Problems}}
+<table class='dwarftbl'>
+{{range .}}<tr><td>{{with .Unit}}<a href="/{{.Offset | printf "%x"}}">&lt;{{.Offset | printf "%x"}}&gt;</a>{{end}}</td><td>{{.Problem}}</td></tr>
+{{end}}
+</table>
+{{else}}
+No problems found
+{{end}}
+<hr/>
+{{range .Sets}}
+<h4>Set at {{.Off | printf "%#x"}}{{with .Unit}} for <a href="/{{.Offset | printf "%x"}}">&lt;{{.Offset | printf "%x"}}&gt;</a>{{end}}</h4>
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<table class='dwarftbl'>
+<tr><td>Unit length</td><td>{{.Length}}{{if .Dwarf64}} (64-bit DWARF){{end}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Debug info offset</td><td>{{.InfoOffset | printf "%#x"}}</td></tr>
+<tr><td>Address size</td><td>{{.AddrSize}}</td></tr>
+<tr><td>Segment selector size</td><td>{{.SegSize}}</td></tr>
+</table>
+<tt><table class='dwarftbl'>
+<tr><th>Address</th><th>Length</th><th>Range</th></tr>
+{{range .Ranges}}<tr><td>{{index . 0 | printf "%#x"}}</td><td>{{RangeLen . | printf "%#x"}}</td><td>{{FmtRange .}}</td></tr>
+{{end}}
+</table></tt>
+<hr/>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func arangesHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var problems []arangesProblem
+	if len(Aranges) > 0 {
+		problems = arangesCheck()
+	}
+	must(arangesTmpl.Execute(w, struct {
+		Sets     []*arangeSet
+		Problems []arangesProblem
+	}{Aranges, problems}))
+}
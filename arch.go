@@ -0,0 +1,227 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/go-delve/delve/pkg/dwarf/regnum"
+)
+
+// Architecture describes the target architecture of the executable.
+type Architecture struct {
+	Name           string
+	PtrSize        int
+	ByteOrder      binary.ByteOrder
+	Disassemble    DisassembleFunc
+	RegnumToString func(uint64) string
+
+	// DWARF register numbers of the stack pointer, program counter and
+	// return address, noRegnum if the architecture does not have one.
+	SPRegnum, PCRegnum, RARegnum uint64
+
+	// CallPushesRA is true if call instructions push the return address on
+	// the stack instead of saving it in a register.
+	CallPushesRA bool
+
+	// InstrAlign is the minimum size and alignment of an instruction, the
+	// disassembler skips this many bytes when it can not decode one.
+	InstrAlign int
+
+	// CoreRegs are the names of the registers saved in the pr_reg field of
+	// NT_PRSTATUS notes in core files, CorePC and CoreSP are the indexes
+	// of the program counter and stack pointer.
+	CoreRegs       []string
+	CorePC, CoreSP int
+}
+
+// noRegnum is used for registers that do not have a DWARF register number,
+// like the program counter on MIPS.
+const noRegnum = ^uint64(0)
+
+// Arch is the architecture of the executable being explored.
+var Arch *Architecture
+
+func (a *Architecture) String() string {
+	endian := "little endian"
+	if a.ByteOrder == binary.BigEndian {
+		endian = "big endian"
+	}
+	return fmt.Sprintf("%s (%s, %d bit)", a.Name, endian, a.PtrSize*8)
+}
+
+var architectures = map[string]*Architecture{
+	"amd64": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneAmd64, RegnumToString: regnum.AMD64ToName,
+		SPRegnum: regnum.AMD64_Rsp, PCRegnum: regnum.AMD64_Rip, RARegnum: regnum.AMD64_Rip, CallPushesRA: true, InstrAlign: 1,
+		CoreRegs: []string{"R15", "R14", "R13", "R12", "Rbp", "Rbx", "R11", "R10", "R9", "R8", "Rax", "Rcx", "Rdx", "Rsi", "Rdi", "Orig_rax", "Rip", "Cs", "Eflags", "Rsp", "Ss", "Fs_base", "Gs_base", "Ds", "Es", "Fs", "Gs"},
+		CorePC:   16, CoreSP: 19},
+	"386": {PtrSize: 4, ByteOrder: binary.LittleEndian, Disassemble: disassembleOne386, RegnumToString: regnum.I386ToName,
+		SPRegnum: regnum.I386_Esp, PCRegnum: regnum.I386_Eip, RARegnum: regnum.I386_Eip, CallPushesRA: true, InstrAlign: 1,
+		CoreRegs: []string{"Ebx", "Ecx", "Edx", "Esi", "Edi", "Ebp", "Eax", "Xds", "Xes", "Xfs", "Xgs", "Orig_eax", "Eip", "Xcs", "Eflags", "Esp", "Xss"},
+		CorePC:   12, CoreSP: 15},
+	"arm64": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneArm64, RegnumToString: regnum.ARM64ToName,
+		SPRegnum: regnum.ARM64_SP, PCRegnum: regnum.ARM64_PC, RARegnum: regnum.ARM64_LR, InstrAlign: 4,
+		CoreRegs: append(numberedRegs("X", 31), "SP", "PC", "Pstate"),
+		CorePC:   32, CoreSP: 31},
+	"arm": {PtrSize: 4, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneArm, RegnumToString: ARMToName,
+		SPRegnum: 13, PCRegnum: 15, RARegnum: 14, InstrAlign: 4,
+		CoreRegs: append(numberedRegs("R", 16), "Cpsr", "Orig_r0"),
+		CorePC:   15, CoreSP: 13},
+	"ppc64le": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOnePpc64, RegnumToString: regnum.PPC64LEToName,
+		SPRegnum: regnum.PPC64LE_SP, PCRegnum: regnum.PPC64LE_PC, RARegnum: regnum.PPC64LE_LR, InstrAlign: 4,
+		CoreRegs: ppc64CoreRegs, CorePC: 32, CoreSP: 1},
+	"ppc64": {PtrSize: 8, ByteOrder: binary.BigEndian, Disassemble: disassembleOnePpc64, RegnumToString: regnum.PPC64LEToName,
+		SPRegnum: regnum.PPC64LE_SP, PCRegnum: regnum.PPC64LE_PC, RARegnum: regnum.PPC64LE_LR, InstrAlign: 4,
+		CoreRegs: ppc64CoreRegs, CorePC: 32, CoreSP: 1},
+	"riscv64": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneRiscv64, RegnumToString: regnum.RISCV64ToName,
+		SPRegnum: regnum.RISCV64_SP, PCRegnum: regnum.RISCV64_PC, RARegnum: regnum.RISCV64_LR, InstrAlign: 2,
+		CoreRegs: append([]string{"PC"}, numberedRegs("X", 32)[1:]...),
+		CorePC:   0, CoreSP: 2},
+	"loong64": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneLoong64, RegnumToString: regnum.LOONG64ToName,
+		SPRegnum: regnum.LOONG64_SP, PCRegnum: regnum.LOONG64_PC, RARegnum: regnum.LOONG64_LR, InstrAlign: 4,
+		CoreRegs: append(numberedRegs("R", 32), "Orig_a0", "Era", "Badv"),
+		CorePC:   33, CoreSP: 3},
+	"s390x": {PtrSize: 8, ByteOrder: binary.BigEndian, Disassemble: disassembleOneS390x, RegnumToString: S390XToName,
+		SPRegnum: 15, PCRegnum: 65, RARegnum: 14, InstrAlign: 2,
+		// the access registers after the general purpose registers are 32
+		// bit wide and are not read
+		CoreRegs: append([]string{"Pswmask", "Pswaddr"}, numberedRegs("R", 16)...),
+		CorePC:   1, CoreSP: 17},
+	"mips": {PtrSize: 4, ByteOrder: binary.BigEndian, Disassemble: disassembleOneWord, RegnumToString: MIPSToName,
+		SPRegnum: 29, PCRegnum: noRegnum, RARegnum: 31, InstrAlign: 4,
+		CoreRegs: mips32CoreRegs, CorePC: 40, CoreSP: 35},
+	"mipsle": {PtrSize: 4, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneWord, RegnumToString: MIPSToName,
+		SPRegnum: 29, PCRegnum: noRegnum, RARegnum: 31, InstrAlign: 4,
+		CoreRegs: mips32CoreRegs, CorePC: 40, CoreSP: 35},
+	"mips64": {PtrSize: 8, ByteOrder: binary.BigEndian, Disassemble: disassembleOneWord, RegnumToString: MIPSToName,
+		SPRegnum: 29, PCRegnum: noRegnum, RARegnum: 31, InstrAlign: 4,
+		CoreRegs: mips64CoreRegs, CorePC: 34, CoreSP: 29},
+	"mips64le": {PtrSize: 8, ByteOrder: binary.LittleEndian, Disassemble: disassembleOneWord, RegnumToString: MIPSToName,
+		SPRegnum: 29, PCRegnum: noRegnum, RARegnum: 31, InstrAlign: 4,
+		CoreRegs: mips64CoreRegs, CorePC: 34, CoreSP: 29},
+}
+
+// Register layouts of pr_reg shared by several architectures.
+var (
+	ppc64CoreRegs = append(numberedRegs("R", 32), "Nip", "Msr", "Orig_gpr3", "Ctr", "Link", "Xer", "Ccr", "Softe", "Trap", "Dar", "Dsisr", "Result")
+	// on 32 bit MIPS the general purpose registers are preceded by 6
+	// unused words
+	mips32CoreRegs = append(append(numberedRegs("Pad", 6), numberedRegs("R", 32)...), mipsCoreRegsTail...)
+	mips64CoreRegs = append(numberedRegs("R", 32), mipsCoreRegsTail...)
+
+	mipsCoreRegsTail = []string{"Lo", "Hi", "Epc", "Badvaddr", "Status", "Cause"}
+)
+
+func numberedRegs(prefix string, n int) []string {
+	r := make([]string, n)
+	for i := range r {
+		r[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return r
+}
+
+func init() {
+	for name, a := range architectures {
+		a.Name = name
+	}
+	Arch = architectures["amd64"]
+	onReset(func() {
+		Arch = architectures["amd64"]
+	})
+}
+
+// setArch sets Arch to the architecture called name, if name is not known
+// a generic architecture with the specified pointer size and byte order is
+// used instead. The pointer size and byte order read from the file header
+// always take precedence over the ones of the descriptor, for riscv32,
+// 31-bit s390 and big endian arm and arm64.
+func setArch(name string, ptrsz int, byteOrder binary.ByteOrder) {
+	if a := architectures[name]; a != nil {
+		if a.PtrSize != ptrsz || a.ByteOrder != byteOrder {
+			c := *a
+			c.PtrSize, c.ByteOrder = ptrsz, byteOrder
+			a = &c
+		}
+		Arch = a
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown architecture %s\n", name)
+	Arch = &Architecture{Name: name, PtrSize: ptrsz, ByteOrder: byteOrder, Disassemble: disassembleOneWord, SPRegnum: noRegnum, PCRegnum: noRegnum, RARegnum: noRegnum, InstrAlign: 1}
+}
+
+func setArchElf(file *elf.File) {
+	ptrsz := 8
+	if file.Class == elf.ELFCLASS32 {
+		ptrsz = 4
+	}
+	le := file.ByteOrder == binary.LittleEndian
+	var name string
+	switch file.Machine {
+	case elf.EM_X86_64:
+		name = "amd64"
+	case elf.EM_386:
+		name = "386"
+	case elf.EM_AARCH64:
+		name = "arm64"
+	case elf.EM_ARM:
+		name = "arm"
+	case elf.EM_PPC64:
+		name = "ppc64"
+		if le {
+			name = "ppc64le"
+		}
+	case elf.EM_RISCV:
+		name = "riscv64"
+	case elf.EM_LOONGARCH:
+		name = "loong64"
+	case elf.EM_S390:
+		name = "s390x"
+	case elf.EM_MIPS, elf.EM_MIPS_RS3_LE:
+		name = "mips"
+		if ptrsz == 8 {
+			name = "mips64"
+		}
+		if le {
+			name += "le"
+		}
+	default:
+		name = file.Machine.String()
+	}
+	setArch(name, ptrsz, file.ByteOrder)
+}
+
+func setArchMacho(file *macho.File) {
+	ptrsz := 8
+	if file.Magic == macho.Magic32 {
+		ptrsz = 4
+	}
+	setArch(machoCpuName(file.Cpu), ptrsz, file.ByteOrder)
+}
+
+func setArchPE(file *pe.File) {
+	ptrsz := 8
+	if _, ok := file.OptionalHeader.(*pe.OptionalHeader32); ok {
+		ptrsz = 4
+	}
+	var name string
+	switch file.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		name = "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		name = "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		name = "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		name = "arm"
+	case pe.IMAGE_FILE_MACHINE_RISCV64:
+		name = "riscv64"
+	case pe.IMAGE_FILE_MACHINE_LOONGARCH64:
+		name = "loong64"
+	default:
+		name = fmt.Sprintf("pe machine %#x", file.Machine)
+	}
+	setArch(name, ptrsz, binary.LittleEndian)
+}
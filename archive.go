@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ArchiveMember is a member of an ar archive.
+type ArchiveMember struct {
+	Name      string
+	Off, Size int64
+	Kind      string
+	HasDebug  bool
+}
+
+type archive struct {
+	Path    string
+	Members []ArchiveMember
+	Current int // index of the member being explored, -1 if none
+	tmpfile string
+}
+
+// Archive is the ar archive being explored, nil if the file is not an archive.
+var Archive *archive
+
+const arMagic = "!<arch>\n"
+
+func isArchive(path string) bool {
+	fh, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer fh.Close()
+	buf := make([]byte, len(arMagic))
+	_, err = io.ReadFull(fh, buf)
+	return err == nil && string(buf) == arMagic
+}
+
+// readArchive reads the list of members of the ar archive fh, both the GNU
+// and BSD variants are supported.
+func readArchive(fh *os.File) ([]ArchiveMember, error) {
+	fi, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var members []ArchiveMember
+	var longNames []byte
+	off := int64(len(arMagic))
+	hdr := make([]byte, 60)
+	for off+60 <= fi.Size() {
+		if _, err := fh.ReadAt(hdr, off); err != nil {
+			return nil, err
+		}
+		if string(hdr[58:60]) != "`\n" {
+			return nil, fmt.Errorf("bad archive member header at %#x", off)
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad archive member size at %#x: %v", off, err)
+		}
+		m := ArchiveMember{Name: strings.TrimRight(string(hdr[:16]), " "), Off: off + 60, Size: size}
+		off += 60 + size + size%2
+
+		switch {
+		case m.Name == "/" || m.Name == "/SYM64/" || strings.HasPrefix(m.Name, "__.SYMDEF"):
+			// symbol table
+			continue
+		case m.Name == "//":
+			longNames = make([]byte, m.Size)
+			if _, err := fh.ReadAt(longNames, m.Off); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(m.Name, "#1/"):
+			// BSD, the name is stored at the start of the data
+			n, _ := strconv.ParseInt(m.Name[3:], 10, 64)
+			if n > m.Size {
+				n = m.Size
+			}
+			name := make([]byte, n)
+			if _, err := fh.ReadAt(name, m.Off); err != nil {
+				return nil, err
+			}
+			m.Name = strings.TrimRight(string(name), "\x00")
+			m.Off += n
+			m.Size -= n
+			if strings.HasPrefix(m.Name, "__.SYMDEF") {
+				continue
+			}
+		case len(m.Name) > 1 && m.Name[0] == '/':
+			// GNU, the name is stored in the long names member
+			n, err := strconv.Atoi(m.Name[1:])
+			if err == nil && n < len(longNames) {
+				name := longNames[n:]
+				if i := bytes.IndexByte(name, '\n'); i >= 0 {
+					name = name[:i]
+				}
+				m.Name = strings.TrimSuffix(string(name), "/")
+			}
+		default:
+			m.Name = strings.TrimSuffix(m.Name, "/")
+		}
+
+		m.Kind, m.HasDebug = "unknown", false
+		sr := io.NewSectionReader(fh, m.Off, m.Size)
+		if f, err := elf.NewFile(sr); err == nil {
+			m.Kind, m.HasDebug = "ELF "+strings.TrimPrefix(f.Type.String(), "ET_"), hasDebugInfoElf(f)
+		} else if f, err := macho.NewFile(sr); err == nil {
+			m.Kind, m.HasDebug = "Mach-O "+f.Type.String(), hasDebugInfoMacho(f)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// openArchive reads the list of members of the archive at path and opens
+// the one called member, if member is empty the member picker is shown.
+func openArchive(path, member string) {
+	fh, err := os.Open(path)
+	must(err)
+	defer fh.Close()
+	members, err := readArchive(fh)
+	must(err)
+	fmt.Fprintf(os.Stderr, "Found archive with %d members\n", len(members))
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	Archive = &archive{Path: path, Members: members, Current: -1}
+	if member == "" {
+		return
+	}
+	for i := range members {
+		if members[i].Name == member {
+			openArchiveMember(i)
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s has no member %s\n", path, member)
+	os.Exit(1)
+}
+
+// openArchiveMember extracts the i-th member of the archive to a temporary
+// file and opens it, replacing the member currently open.
+func openArchiveMember(i int) {
+	m := &Archive.Members[i]
+	if !m.HasDebug {
+		panic(fmt.Errorf("%s has no debug info", m.Name))
+	}
+	fh, err := os.Open(Archive.Path)
+	must(err)
+	defer fh.Close()
+	tmp, err := os.CreateTemp("", "diexplorer-*-"+filepath.Base(m.Name))
+	must(err)
+	_, err = io.Copy(tmp, io.NewSectionReader(fh, m.Off, m.Size))
+	tmp.Close()
+	must(err)
+
+	if Archive.tmpfile != "" {
+		os.Remove(Archive.tmpfile)
+	}
+	Archive.tmpfile = tmp.Name()
+	Archive.Current = i
+
+	resetState()
+	openFile(tmp.Name())
+
+	abspath, _ := filepath.Abs(tmp.Name())
+	for j := range DataSources {
+		if DataSources[j].Path == abspath {
+			DataSources[j].Path = fmt.Sprintf("%s(%s)", Archive.Path, m.Name)
+		}
+	}
+}
+
+// resetFuncs clear the state that is set when opening a file, each
+// subsystem registers its own with onReset.
+var resetFuncs []func()
+
+func onReset(fn func()) {
+	resetFuncs = append(resetFuncs, fn)
+}
+
+// resetState clears everything that is set when opening a file so that a
+// different archive member can be opened.
+func resetState() {
+	for _, fn := range resetFuncs {
+		fn()
+	}
+}
+
+var membersTmpl = template.Must(template.New("members").Parse(`<!doctype html>
+<html>
+<head>
+<title>Archive {{.Path}}</title>
+</head>
+<body>
+<h3>Archive {{.Path}}</h3>
+<table class='dwarftbl'>
+<tr><th>Member</th><th>Kind</th><th>Size</th></tr>
+{{$cur := .Current}}
+{{range $i, $m := .Members}}
+<tr>
+<td>{{if $m.HasDebug}}<a href="/members/{{$i}}">{{$m.Name}}</a>{{else}}{{$m.Name}}{{end}}{{if eq $i $cur}} (current){{end}}</td>
+<td>{{$m.Kind}}{{if not $m.HasDebug}}, no debug info{{end}}</td>
+<td>{{$m.Size}}</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+func membersHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if Archive == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	if s := strings.TrimPrefix(r.URL.Path, "/members/"); s != "" {
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 || i >= len(Archive.Members) {
+			http.NotFound(w, r)
+			return
+		}
+		openArchiveMember(i)
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	must(membersTmpl.Execute(w, Archive))
+}
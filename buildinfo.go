@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// Build information of Go executables, written by the linker at the start
+// of the .go.buildinfo section, see src/debug/buildinfo in the Go source
+// tree.
+
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+type goBuildInfo struct {
+	Addr     uint64 // address of the header, 0 if the version was read from runtime.buildVersion
+	Version  string
+	Producer string // version in DW_AT_producer, if it is different
+	Info     *debug.BuildInfo
+	Modules  []*goModule
+	Err      string
+}
+
+type goModule struct {
+	debug.Module
+	Main bool
+	CUs  int
+}
+
+var goBuild *goBuildInfo
+
+func init() {
+	onReset(func() {
+		goBuild = nil
+	})
+}
+
+// buildInfo returns the build information of the executable, or nil if it
+// is not a Go executable.
+func buildInfo() *goBuildInfo {
+	if goBuild != nil {
+		return goBuild
+	}
+	for _, sect := range exeSections {
+		switch sect.Name {
+		case ".go.buildinfo", "__go_buildinfo", ".data":
+		default:
+			continue
+		}
+		// the header is aligned to 16 bytes, in PE executables it is
+		// somewhere at the start of .data
+		data := sect.load()
+		for off := 0; off+32 <= len(data) && off < 64<<10; off += 16 {
+			if bytes.HasPrefix(data[off:], buildInfoMagic) {
+				goBuild = readBuildInfo(sect.Addr+uint64(off), data[off:])
+				break
+			}
+		}
+		if goBuild != nil {
+			break
+		}
+	}
+	if goBuild == nil {
+		for _, sym := range tableSymbols {
+			if sym.Name == "runtime.buildVersion" {
+				goBuild = &goBuildInfo{Version: readGoString(sym.Addr, Arch.PtrSize, Arch.ByteOrder)}
+				break
+			}
+		}
+	}
+	if goBuild == nil {
+		return nil
+	}
+	if p := goProducer(); p != "" {
+		ver, ok := Parse(goBuild.Version)
+		pver := ParseProducer(p)
+		if !ok || ver.String() != pver.String() {
+			goBuild.Producer = strings.TrimPrefix(p, producerVersionPrefix)
+		}
+	}
+	goBuild.loadModules()
+	return goBuild
+}
+
+// readGoString reads the string header at addr and the string it points to.
+func readGoString(addr uint64, ptrSize int, bo binary.ByteOrder) string {
+	hdr := readExe(addr, 2*ptrSize)
+	if hdr == nil {
+		return ""
+	}
+	b := &lineBuf{data: hdr, bo: bo}
+	return string(readExe(b.uint(ptrSize), int(b.uint(ptrSize))))
+}
+
+func readBuildInfo(addr uint64, data []byte) *goBuildInfo {
+	bi := &goBuildInfo{Addr: addr}
+	ptrSize, flags := int(data[14]), data[15]
+	var modinfo string
+	if flags&2 != 0 {
+		// Go 1.18 and later, the strings follow the header
+		b := &lineBuf{data: data[32:]}
+		bi.Version = string(b.bytes(int(b.uleb())))
+		modinfo = string(b.bytes(int(b.uleb())))
+		if b.eof {
+			bi.Err = "build info is truncated"
+			return bi
+		}
+	} else {
+		// pointers to runtime.buildVersion and runtime.modinfo
+		var bo binary.ByteOrder = binary.LittleEndian
+		if flags&1 != 0 {
+			bo = binary.BigEndian
+		}
+		b := &lineBuf{data: data[16:], bo: bo}
+		bi.Version = readGoString(b.uint(ptrSize), ptrSize, bo)
+		modinfo = readGoString(b.uint(ptrSize), ptrSize, bo)
+	}
+	// modinfo is surrounded by 16 byte sentinels
+	if len(modinfo) < 33 || modinfo[len(modinfo)-17] != '\n' {
+		return bi
+	}
+	info, err := debug.ParseBuildInfo(modinfo[16 : len(modinfo)-16])
+	if err != nil {
+		bi.Err = err.Error()
+		return bi
+	}
+	info.GoVersion = bi.Version
+	bi.Info = info
+	return bi
+}
+
+// loadModules lists the main module, the dependencies and the standard
+// library and counts the compile units of each one.
+func (bi *goBuildInfo) loadModules() {
+	if bi.Info == nil {
+		return
+	}
+	bi.Modules = append(bi.Modules, &goModule{Module: bi.Info.Main, Main: true})
+	for _, dep := range bi.Info.Deps {
+		bi.Modules = append(bi.Modules, &goModule{Module: *dep})
+	}
+	std := &goModule{Module: debug.Module{Path: "std"}}
+	for _, cu := range compileUnits {
+		if m := bi.moduleOf(cu); m != nil {
+			m.CUs++
+		} else if p, _ := cu.Val(dwarf.AttrProducer).(string); strings.HasPrefix(p, producerVersionPrefix) {
+			std.CUs++
+		}
+	}
+	if std.CUs > 0 {
+		bi.Modules = append(bi.Modules, std)
+	}
+}
+
+// moduleOf returns the module containing the package compiled in cu, nil
+// for the standard library and compile units not compiled by Go.
+func (bi *goBuildInfo) moduleOf(cu *dwarf.Entry) *goModule {
+	name, _ := cu.Val(dwarf.AttrName).(string)
+	if name == "main" && len(bi.Modules) > 0 {
+		return bi.Modules[0]
+	}
+	var r *goModule
+	for _, m := range bi.Modules {
+		if m.Path == "std" || m.Path == "" {
+			continue
+		}
+		if (name == m.Path || strings.HasPrefix(name, m.Path+"/")) && (r == nil || len(m.Path) > len(r.Path)) {
+			r = m
+		}
+	}
+	return r
+}
+
+// inModule returns true if cu belongs to the module called path.
+func (bi *goBuildInfo) inModule(cu *dwarf.Entry, path string) bool {
+	if m := bi.moduleOf(cu); m != nil {
+		return m.Path == path
+	}
+	p, _ := cu.Val(dwarf.AttrProducer).(string)
+	return path == "std" && strings.HasPrefix(p, producerVersionPrefix)
+}
+
+// groupByModule sorts the compile units in nodes by the module they belong
+// to, in the order of bi.Modules, compile units that are not part of any
+// module go last. It returns the module of each group indexed by the
+// position of its first compile unit, the module of the last group has an
+// empty path.
+func (bi *goBuildInfo) groupByModule(nodes []*EntryNode) map[int]*goModule {
+	other := &goModule{}
+	mods := make([]*goModule, len(nodes))
+	idx := map[*goModule]int{other: len(bi.Modules)}
+	std := other
+	for i, m := range bi.Modules {
+		idx[m] = i
+		if m.Path == "std" {
+			std = m
+		}
+	}
+	for i, n := range nodes {
+		mods[i] = other
+		if m := bi.moduleOf(n.E); m != nil {
+			mods[i] = m
+		} else if bi.inModule(n.E, "std") {
+			mods[i] = std
+		}
+	}
+	perm := make([]int, len(nodes))
+	for i := range perm {
+		perm[i] = i
+	}
+	sort.SliceStable(perm, func(i, j int) bool { return idx[mods[perm[i]]] < idx[mods[perm[j]]] })
+	sorted := make([]*EntryNode, len(nodes))
+	groups := map[int]*goModule{}
+	for i, p := range perm {
+		sorted[i] = nodes[p]
+		if i == 0 || mods[p] != mods[perm[i-1]] {
+			groups[i] = mods[p]
+		}
+	}
+	copy(nodes, sorted)
+	return groups
+}
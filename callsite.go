@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+// Call sites and entry values, see DWARFv5 sections 3.4 and 2.5.1.7, GCC
+// emits the equivalent GNU extensions for DWARFv4.
+
+const (
+	_DW_TAG_GNU_call_site           dwarf.Tag = 0x4109
+	_DW_TAG_GNU_call_site_parameter dwarf.Tag = 0x410a
+)
+
+const (
+	_DW_AT_GNU_call_site_value            dwarf.Attr = 0x2111
+	_DW_AT_GNU_call_site_data_value       dwarf.Attr = 0x2112
+	_DW_AT_GNU_call_site_target           dwarf.Attr = 0x2113
+	_DW_AT_GNU_call_site_target_clobbered dwarf.Attr = 0x2114
+	_DW_AT_GNU_tail_call                  dwarf.Attr = 0x2115
+)
+
+const (
+	_DW_OP_entry_value     = 0xa3
+	_DW_OP_GNU_entry_value = 0xf3
+)
+
+type callSite struct {
+	Off      dwarf.Offset
+	Caller   dwarf.Offset // subprogram containing the call site
+	ReturnPC uint64
+	Origin   dwarf.Offset // called subprogram, 0 if unknown
+	Target   []byte       // location of the called subprogram
+	Tail     bool
+	Params   []callSiteParam
+	offsz    int // offset size of the unit containing the call site
+}
+
+type callSiteParam struct {
+	Off                                      dwarf.Offset
+	Location, Value, DataLocation, DataValue []byte
+}
+
+// callSitesByOrigin maps subprograms to the call sites calling them.
+var callSitesByOrigin map[dwarf.Offset][]*callSite
+
+func init() {
+	onReset(func() {
+		callSitesByOrigin = nil
+	})
+}
+
+func isCallSite(tag dwarf.Tag) bool {
+	return tag == dwarf.TagCallSite || tag == _DW_TAG_GNU_call_site
+}
+
+func isCallSiteParam(tag dwarf.Tag) bool {
+	return tag == dwarf.TagCallSiteParameter || tag == _DW_TAG_GNU_call_site_parameter
+}
+
+func newCallSite(e *dwarf.Entry, caller dwarf.Offset, offsz int) *callSite {
+	cs := &callSite{Off: e.Offset, Caller: caller, offsz: offsz}
+	if e.Tag == dwarf.TagCallSite {
+		cs.ReturnPC, _ = e.Val(dwarf.AttrCallReturnPC).(uint64)
+		cs.Origin, _ = e.Val(dwarf.AttrCallOrigin).(dwarf.Offset)
+		cs.Target, _ = e.Val(dwarf.AttrCallTarget).([]byte)
+		if cs.Target == nil {
+			cs.Target, _ = e.Val(dwarf.AttrCallTargetClobbered).([]byte)
+		}
+		cs.Tail, _ = e.Val(dwarf.AttrCallTailCall).(bool)
+	} else {
+		cs.ReturnPC, _ = e.Val(dwarf.AttrLowpc).(uint64)
+		cs.Origin, _ = e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		cs.Target, _ = e.Val(_DW_AT_GNU_call_site_target).([]byte)
+		if cs.Target == nil {
+			cs.Target, _ = e.Val(_DW_AT_GNU_call_site_target_clobbered).([]byte)
+		}
+		cs.Tail, _ = e.Val(_DW_AT_GNU_tail_call).(bool)
+	}
+	return cs
+}
+
+func (cs *callSite) addParam(e *dwarf.Entry) {
+	p := callSiteParam{Off: e.Offset}
+	p.Location, _ = e.Val(dwarf.AttrLocation).([]byte)
+	p.DataLocation, _ = e.Val(dwarf.AttrCallDataLocation).([]byte)
+	if e.Tag == dwarf.TagCallSiteParameter {
+		p.Value, _ = e.Val(dwarf.AttrCallValue).([]byte)
+		p.DataValue, _ = e.Val(dwarf.AttrCallDataValue).([]byte)
+	} else {
+		p.Value, _ = e.Val(_DW_AT_GNU_call_site_value).([]byte)
+		p.DataValue, _ = e.Val(_DW_AT_GNU_call_site_data_value).([]byte)
+	}
+	cs.Params = append(cs.Params, p)
+}
+
+// collectCallSites returns the call sites contained in en, offsz is the
+// offset size of its unit.
+func collectCallSites(en *EntryNode, caller dwarf.Offset, offsz int) []*callSite {
+	var r []*callSite
+	for _, child := range en.Childs {
+		if isCallSite(child.E.Tag) {
+			cs := newCallSite(child.E, caller, offsz)
+			for _, param := range child.Childs {
+				if isCallSiteParam(param.E.Tag) {
+					cs.addParam(param.E)
+				}
+			}
+			r = append(r, cs)
+			continue
+		}
+		r = append(r, collectCallSites(child, caller, offsz)...)
+	}
+	return r
+}
+
+// loadCallSites indexes all call sites by the subprogram they call.
+func loadCallSites() {
+	if callSitesByOrigin != nil {
+		return
+	}
+	callSitesByOrigin = map[dwarf.Offset][]*callSite{}
+	var stack []*dwarf.Entry
+	var cs *callSite
+	offsz := 4
+	rdr := Dwarf.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		if len(stack) == 0 {
+			offsz = unitOffsetSize(e)
+		}
+		switch {
+		case isCallSite(e.Tag):
+			var caller dwarf.Offset
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].Tag == dwarf.TagSubprogram {
+					caller = stack[i].Offset
+					break
+				}
+			}
+			cs = newCallSite(e, caller, offsz)
+			if cs.Origin != 0 {
+				callSitesByOrigin[cs.Origin] = append(callSitesByOrigin[cs.Origin], cs)
+			}
+		case isCallSiteParam(e.Tag):
+			if cs != nil && len(stack) > 0 && stack[len(stack)-1].Offset == cs.Off {
+				cs.addParam(e)
+			}
+		}
+		if e.Children {
+			stack = append(stack, e)
+		}
+	}
+}
+
+// entryName returns the name of the entry at off, following
+// DW_AT_abstract_origin and DW_AT_specification.
+func entryName(off dwarf.Offset) string {
+	for i := 0; i < 4; i++ {
+		rdr := Dwarf.Reader()
+		rdr.Seek(off)
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			return ""
+		}
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			return name
+		}
+		next, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			next, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		}
+		if !ok {
+			return ""
+		}
+		off = next
+	}
+	return ""
+}
+
+// callersOf returns the call sites calling the subprogram e, call sites
+// can reference its declaration or its abstract instance.
+func callersOf(e *dwarf.Entry) []*callSite {
+	loadCallSites()
+	r := callSitesByOrigin[e.Offset]
+	for _, attr := range []dwarf.Attr{dwarf.AttrAbstractOrigin, dwarf.AttrSpecification} {
+		if off, ok := e.Val(attr).(dwarf.Offset); ok {
+			r = append(r, callSitesByOrigin[off]...)
+			rdr := Dwarf.Reader()
+			rdr.Seek(off)
+			if orig, _ := rdr.Next(); orig != nil {
+				if spec, ok := orig.Val(dwarf.AttrSpecification).(dwarf.Offset); ok {
+					r = append(r, callSitesByOrigin[spec]...)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// exprReg returns the register used by the first operation of instrs and
+// whether it is a memory location relative to it.
+func exprReg(instrs []byte) (reg uint64, breg, ok bool) {
+	if len(instrs) == 0 {
+		return 0, false, false
+	}
+	switch op := instrs[0]; {
+	case op >= _DW_OP_reg0 && op <= _DW_OP_reg31:
+		return uint64(op - _DW_OP_reg0), false, true
+	case op >= _DW_OP_breg0 && op <= _DW_OP_breg31:
+		return uint64(op - _DW_OP_breg0), true, true
+	case op == _DW_OP_regx || op == _DW_OP_bregx:
+		reg, _ := leb128.DecodeUnsigned(bytes.NewBuffer(instrs[1:]))
+		return reg, op == _DW_OP_bregx, true
+	}
+	return 0, false, false
+}
+
+// entryValues calls fn for the argument of every DW_OP_entry_value
+// operation of instrs.
+func entryValues(instrs []byte, offsz int, fn func(block []byte)) {
+	walkOps(instrs, offsz, func(opcode byte, args []byte) {
+		if opcode != _DW_OP_entry_value && opcode != _DW_OP_GNU_entry_value {
+			return
+		}
+		in := bytes.NewBuffer(args)
+		sz, _ := leb128.DecodeUnsigned(in)
+		fn(in.Next(int(sz)))
+	})
+}
+
+func exprString(instrs []byte, offsz int) string {
+	var buf bytes.Buffer
+	PrettyPrintOp(&buf, instrs, offsz)
+	return html.EscapeString(strings.TrimSpace(buf.String()))
+}
+
+func fmtCallSiteTarget(cs *callSite) string {
+	var s string
+	if cs.Origin != 0 {
+		s = fmt.Sprintf("<a href='/%x' target='_top'>%s</a>", cs.Origin, html.EscapeString(entryName(cs.Origin)))
+	} else if cs.Target != nil {
+		s = "indirect " + exprString(cs.Target, cs.offsz)
+	} else {
+		s = "unknown"
+	}
+	if cs.Tail {
+		s += " (tail call)"
+	}
+	return s
+}
+
+// entryValueUse is an expression of a subprogram using DW_OP_entry_value.
+type entryValueUse struct {
+	Off   dwarf.Offset
+	Name  string
+	Where string
+}
+
+// collectEntryValues returns the expressions of the variables, parameters
+// and call sites of en using DW_OP_entry_value, keyed by its argument.
+func collectEntryValues(en *EntryNode, cu *dwarf.Entry, debugLoc loclistReader, r map[string][]entryValueUse) {
+	offsz := unitOffsetSize(cu)
+	for _, child := range en.Childs {
+		e := child.E
+		name, _ := e.Val(dwarf.AttrName).(string)
+		if name == "" {
+			if origin, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset); ok {
+				name = entryName(origin)
+			}
+		}
+		add := func(instrs []byte, where string) {
+			entryValues(instrs, offsz, func(block []byte) {
+				r[string(block)] = append(r[string(block)], entryValueUse{e.Offset, name, where})
+			})
+		}
+		switch {
+		case e.Tag == dwarf.TagFormalParameter || e.Tag == dwarf.TagVariable:
+			for _, f := range e.Field {
+				switch {
+				case f.Attr != dwarf.AttrLocation:
+				case f.Class == dwarf.ClassExprLoc || f.Class == dwarf.ClassBlock:
+					add(f.Val.([]byte), "location")
+				case debugLoc == nil:
+				case f.Class == dwarf.ClassLocListPtr || f.Class == dwarf.ClassLocList:
+					debugLoc.Seek(int(loclistOffset(cu, &f)))
+					var lle loclistEntry
+					for debugLoc.Next(&lle) {
+						if lle.isrange {
+							add(lle.instr, fmt.Sprintf("location at %#x-%#x", lle.lowpc, lle.highpc))
+						}
+					}
+				}
+			}
+		case isCallSiteParam(e.Tag):
+			for _, attr := range []dwarf.Attr{dwarf.AttrCallValue, dwarf.AttrCallDataValue, _DW_AT_GNU_call_site_value, _DW_AT_GNU_call_site_data_value} {
+				if instrs, ok := e.Val(attr).([]byte); ok {
+					add(instrs, "value of call site parameter")
+				}
+			}
+		}
+		collectEntryValues(child, cu, debugLoc, r)
+	}
+}
+
+// callSitesSynthesis prints the call sites of the subprogram en and, for
+// every DW_OP_entry_value used by en, the call sites of its callers that
+// provide the value. debugLoc reads the location lists of cu, it can be nil.
+func callSitesSynthesis(out io.Writer, en *EntryNode, cu *dwarf.Entry, debugLoc loclistReader, sites []*callSite) {
+	offsz := unitOffsetSize(cu)
+	if len(sites) > 0 {
+		fmt.Fprintf(out, "<h3>Call Sites</h3>\n<tt><table>\n<tr><td>Entry</td><td>Return PC</td><td>Target</td><td>Parameters</td></tr>\n")
+		for _, cs := range sites {
+			fmt.Fprintf(out, "<tr><td><a name='cs%x'></a>&lt;%x&gt;</td><td><a href='#pc%x'>%#x</a></td><td>%s</td><td><table>", cs.Off, cs.Off, cs.ReturnPC, cs.ReturnPC, fmtCallSiteTarget(cs))
+			for _, p := range cs.Params {
+				fmt.Fprintf(out, "<tr><td>%s</td><td>= %s</td>", exprString(p.Location, cs.offsz), exprString(p.Value, cs.offsz))
+				if p.DataLocation != nil || p.DataValue != nil {
+					fmt.Fprintf(out, "<td>data %s = %s</td>", exprString(p.DataLocation, cs.offsz), exprString(p.DataValue, cs.offsz))
+				}
+				fmt.Fprintf(out, "</tr>")
+			}
+			fmt.Fprintf(out, "</table></td></tr>\n")
+		}
+		fmt.Fprintf(out, "</table></tt>\n")
+	}
+
+	uses := map[string][]entryValueUse{}
+	collectEntryValues(en, cu, debugLoc, uses)
+	if len(uses) == 0 {
+		return
+	}
+	blocks := make([]string, 0, len(uses))
+	for block := range uses {
+		blocks = append(blocks, block)
+	}
+	sort.Strings(blocks)
+	callers := callersOf(en.E)
+
+	fmt.Fprintf(out, "<h3>Entry Values</h3>\n")
+	for _, block := range blocks {
+		fmt.Fprintf(out, "<p><tt>DW_OP_entry_value(%s)</tt> used by:<ul>\n", exprString([]byte(block), offsz))
+		for _, use := range uses[block] {
+			if use.Name != "" {
+				fmt.Fprintf(out, "<li>&lt;%x&gt; %s, %s</li>\n", use.Off, html.EscapeString(use.Name), use.Where)
+			} else {
+				fmt.Fprintf(out, "<li>&lt;%x&gt; %s</li>\n", use.Off, use.Where)
+			}
+		}
+		fmt.Fprintf(out, "</ul>\n")
+
+		reg, breg, ok := exprReg([]byte(block))
+		n := 0
+		for _, cs := range callers {
+			for _, p := range cs.Params {
+				preg, _, pok := exprReg(p.Location)
+				if !ok || !pok || preg != reg {
+					continue
+				}
+				if n == 0 {
+					fmt.Fprintf(out, "Supplied by:<tt><table>\n<tr><td>Caller</td><td>Call site</td><td>Return PC</td><td>Value</td></tr>\n")
+				}
+				n++
+				value := p.Value
+				if breg {
+					value = p.DataValue
+				}
+				fmt.Fprintf(out, "<tr><td><a href='/%x' target='_top'>%s</a></td><td>&lt;%x&gt;</td><td>%#x</td><td>%s</td></tr>\n", cs.Caller, html.EscapeString(entryName(cs.Caller)), cs.Off, cs.ReturnPC, exprString(value, cs.offsz))
+			}
+		}
+		if n > 0 {
+			fmt.Fprintf(out, "</table></tt>\n")
+		} else if len(callers) == 0 {
+			fmt.Fprintf(out, "No call site calling this function was found.\n")
+		} else {
+			fmt.Fprintf(out, "None of the %d call sites calling this function supply the value.\n", len(callers))
+		}
+		fmt.Fprintf(out, "</p>\n")
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// coreFile is a core file loaded together with the executable.
+type coreFile struct {
+	Path    string
+	Threads []*coreThread
+	Bias    uint64 // load address of the executable minus its link address
+
+	segs    []*elf.Prog
+	exeSegs []*elf.Prog
+}
+
+type coreThread struct {
+	Pid  int
+	Regs []uint64
+}
+
+// Core is the core file being explored or nil.
+var Core *coreFile
+
+const (
+	_NT_PRSTATUS = 1
+	_NT_AUXV     = 6
+
+	_AT_ENTRY = 9
+)
+
+// openCore loads the core file at path, exepath is the executable that
+// produced it.
+func openCore(path, exepath string) {
+	file, err := elf.Open(path)
+	must(err)
+	if file.Type != elf.ET_CORE {
+		fmt.Fprintf(os.Stderr, "%s is not a core file\n", path)
+		os.Exit(1)
+	}
+	exe, err := elf.Open(exepath)
+	must(err)
+	if file.Machine != exe.Machine {
+		fmt.Fprintf(os.Stderr, "core file machine %s does not match executable machine %s\n", file.Machine, exe.Machine)
+	}
+	if len(Arch.CoreRegs) == 0 {
+		fmt.Fprintf(os.Stderr, "registers in %s core files are not supported\n", Arch.Name)
+	}
+	fmt.Fprintf(os.Stderr, "Found core file\n")
+	addDataSource("core", path, "")
+
+	Core = &coreFile{Path: path}
+	for _, prog := range file.Progs {
+		if prog.Type == elf.PT_LOAD {
+			Core.segs = append(Core.segs, prog)
+		}
+	}
+	for _, prog := range exe.Progs {
+		if prog.Type == elf.PT_LOAD {
+			Core.exeSegs = append(Core.exeSegs, prog)
+		}
+	}
+
+	for _, prog := range file.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		_, err := prog.ReadAt(data, 0)
+		must(err)
+		for len(data) >= 12 {
+			namesz := uint64(file.ByteOrder.Uint32(data[0:]))
+			descsz := uint64(file.ByteOrder.Uint32(data[4:]))
+			typ := file.ByteOrder.Uint32(data[8:])
+			data = data[12:]
+			descOff := (namesz + 3) &^ 3
+			if descOff+descsz > uint64(len(data)) {
+				break
+			}
+			desc := data[descOff : descOff+descsz]
+			if string(data[:namesz]) == "CORE\x00" {
+				switch typ {
+				case _NT_PRSTATUS:
+					Core.Threads = append(Core.Threads, parsePrStatus(file, desc))
+				case _NT_AUXV:
+					if entry, ok := auxvEntry(file, desc); ok {
+						Core.Bias = entry - exe.Entry
+					}
+				}
+			}
+			next := descOff + (descsz+3)&^3
+			if next > uint64(len(data)) {
+				break
+			}
+			data = data[next:]
+		}
+	}
+}
+
+// parsePrStatus parses the contents of a NT_PRSTATUS note.
+func parsePrStatus(file *elf.File, desc []byte) *coreThread {
+	// offsets of pr_pid and pr_reg in struct elf_prstatus
+	pidOff, regOff, regsz := 24, 72, 4
+	if file.Class == elf.ELFCLASS64 {
+		pidOff, regOff, regsz = 32, 112, 8
+	}
+	t := &coreThread{}
+	if len(desc) >= pidOff+4 {
+		t.Pid = int(int32(file.ByteOrder.Uint32(desc[pidOff:])))
+	}
+	for i := range Arch.CoreRegs {
+		off := regOff + i*regsz
+		if off+regsz > len(desc) {
+			break
+		}
+		if regsz == 8 {
+			t.Regs = append(t.Regs, file.ByteOrder.Uint64(desc[off:]))
+		} else {
+			t.Regs = append(t.Regs, uint64(file.ByteOrder.Uint32(desc[off:])))
+		}
+	}
+	return t
+}
+
+// auxvEntry returns the value of AT_ENTRY in the auxiliary vector auxv.
+func auxvEntry(file *elf.File, auxv []byte) (uint64, bool) {
+	sz := 4
+	if file.Class == elf.ELFCLASS64 {
+		sz = 8
+	}
+	read := func(b []byte) uint64 {
+		if sz == 8 {
+			return file.ByteOrder.Uint64(b)
+		}
+		return uint64(file.ByteOrder.Uint32(b))
+	}
+	for ; len(auxv) >= 2*sz; auxv = auxv[2*sz:] {
+		if read(auxv) == _AT_ENTRY {
+			return read(auxv[sz:]), true
+		}
+	}
+	return 0, false
+}
+
+func (t *coreThread) reg(i int) uint64 {
+	if i < len(t.Regs) {
+		return t.Regs[i]
+	}
+	return 0
+}
+
+func (t *coreThread) PC() uint64 { return t.reg(Arch.CorePC) }
+func (t *coreThread) SP() uint64 { return t.reg(Arch.CoreSP) }
+
+// Function returns the symbol for the function containing the PC of t.
+func (t *coreThread) Function() *Sym {
+	pc := t.PC() - Core.Bias
+	if _, err := findTextSection(pc, pc+1); err != nil {
+		// in a shared library
+		return nil
+	}
+	var lup lookupper
+	lup.lookup(pc)
+	return lup.sym
+}
+
+type coreReg struct {
+	Name  string
+	Value uint64
+}
+
+func (t *coreThread) Registers() []coreReg {
+	r := make([]coreReg, len(t.Regs))
+	for i := range t.Regs {
+		r[i] = coreReg{Arch.CoreRegs[i], t.Regs[i]}
+	}
+	return r
+}
+
+var errNotInCore = errors.New("address not in core file")
+
+// ReadMemory reads len(buf) bytes at addr from the core file, memory that
+// was not dumped is read from the executable.
+func (core *coreFile) ReadMemory(buf []byte, addr uint64) error {
+	for len(buf) > 0 {
+		n, err := readSegs(buf, addr, core.segs, 0, false)
+		if err == errNotInCore {
+			n, err = readSegs(buf, addr, core.exeSegs, core.Bias, true)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read %#x: %v", addr, err)
+		}
+		buf = buf[n:]
+		addr += uint64(n)
+	}
+	return nil
+}
+
+// readSegs reads from the segment in segs containing addr. Core files only
+// contain the first page of file backed mappings, if zeroFill is set the
+// contents of a segment past its size in the file are zero instead.
+func readSegs(buf []byte, addr uint64, segs []*elf.Prog, bias uint64, zeroFill bool) (int, error) {
+	for _, seg := range segs {
+		start := seg.Vaddr + bias
+		if addr < start || addr >= start+seg.Memsz {
+			continue
+		}
+		off := addr - start
+		n := uint64(len(buf))
+		if off+n > seg.Memsz {
+			n = seg.Memsz - off
+		}
+		if off >= seg.Filesz {
+			if !zeroFill {
+				return 0, errNotInCore
+			}
+			clear(buf[:n])
+			return int(n), nil
+		}
+		if off+n > seg.Filesz {
+			n = seg.Filesz - off
+		}
+		if _, err := seg.ReadAt(buf[:n], int64(off)); err != nil {
+			return 0, err
+		}
+		return int(n), nil
+	}
+	return 0, errNotInCore
+}
+
+// CoreValue returns the value in the core file of the global variable
+// described by entryNode.
+func (entryNode *EntryNode) CoreValue() string {
+	if Core == nil || entryNode.E.Tag != dwarf.TagVariable {
+		return ""
+	}
+	addr, ok := varAddrs[entryNode.E.Offset]
+	if !ok {
+		return ""
+	}
+	typOff, ok := entryNode.E.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return ""
+	}
+	typ, err := Dwarf.Type(typOff)
+	if err != nil {
+		return fmt.Sprintf("<could not read type: %v>", err)
+	}
+	var out strings.Builder
+	formatValue(&out, typ, addr+Core.Bias, 0)
+	return out.String()
+}
+
+const (
+	maxValueDepth    = 4
+	maxArrayElements = 16
+	maxStringLen     = 256
+)
+
+// formatValue writes the value of type typ at addr in the core file to out.
+func formatValue(out *strings.Builder, typ dwarf.Type, addr uint64, depth int) {
+	for {
+		switch t := typ.(type) {
+		case *dwarf.TypedefType:
+			typ = t.Type
+			continue
+		case *dwarf.QualType:
+			typ = t.Type
+			continue
+		}
+		break
+	}
+
+	size := typ.Size()
+	if size < 0 {
+		size = 0
+	}
+	var buf []byte
+	switch typ.(type) {
+	case *dwarf.StructType, *dwarf.ArrayType:
+		// read by field or element
+	default:
+		buf = make([]byte, size)
+		if err := Core.ReadMemory(buf, addr); err != nil {
+			fmt.Fprintf(out, "<%v>", err)
+			return
+		}
+	}
+
+	switch t := typ.(type) {
+	case *dwarf.BoolType:
+		fmt.Fprintf(out, "%v", readUintN(buf) != 0)
+	case *dwarf.IntType, *dwarf.CharType:
+		fmt.Fprintf(out, "%d", readIntN(buf))
+	case *dwarf.UintType, *dwarf.UcharType:
+		fmt.Fprintf(out, "%d", readUintN(buf))
+	case *dwarf.AddrType:
+		fmt.Fprintf(out, "%#x", readUintN(buf))
+	case *dwarf.FloatType:
+		formatFloat(out, buf)
+	case *dwarf.ComplexType:
+		out.WriteString("(")
+		formatFloat(out, buf[:len(buf)/2])
+		out.WriteString(" + ")
+		formatFloat(out, buf[len(buf)/2:])
+		out.WriteString("i)")
+	case *dwarf.EnumType:
+		v := readIntN(buf)
+		for _, ev := range t.Val {
+			if ev.Val == v {
+				fmt.Fprintf(out, "%s (%d)", ev.Name, v)
+				return
+			}
+		}
+		fmt.Fprintf(out, "%d", v)
+	case *dwarf.PtrType:
+		ptr := readUintN(buf)
+		formatPointer(out, ptr)
+		elem := t.Type
+		if q, ok := elem.(*dwarf.QualType); ok {
+			elem = q.Type
+		}
+		if c, ok := elem.(*dwarf.CharType); ok && c.Size() == 1 && ptr != 0 {
+			out.WriteString(" ")
+			formatCString(out, ptr, maxStringLen)
+		}
+	case *dwarf.StructType:
+		formatStruct(out, t, addr, depth)
+	case *dwarf.ArrayType:
+		if depth >= maxValueDepth {
+			out.WriteString("[...]")
+			return
+		}
+		if c, ok := t.Type.(*dwarf.CharType); ok && c.Size() == 1 && t.Count > 0 {
+			formatCString(out, addr, t.Count)
+			return
+		}
+		elemSize := t.Type.Size()
+		out.WriteString("[")
+		for i := int64(0); i < t.Count; i++ {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			if i >= maxArrayElements {
+				fmt.Fprintf(out, "...+%d more", t.Count-i)
+				break
+			}
+			formatValue(out, t.Type, addr+uint64(i*elemSize), depth+1)
+		}
+		out.WriteString("]")
+	default:
+		fmt.Fprintf(out, "%x", buf)
+	}
+}
+
+func formatStruct(out *strings.Builder, t *dwarf.StructType, addr uint64, depth int) {
+	field := func(name string) *dwarf.StructField {
+		for _, f := range t.Field {
+			if f.Name == name {
+				return f
+			}
+		}
+		return nil
+	}
+	readField := func(f *dwarf.StructField) uint64 {
+		buf := make([]byte, f.Type.Size())
+		if Core.ReadMemory(buf, addr+uint64(f.ByteOffset)) != nil {
+			return 0
+		}
+		return readUintN(buf)
+	}
+
+	// Go strings and slices
+	if str, n := field("str"), field("len"); t.StructName == "string" && str != nil && n != nil && len(t.Field) == 2 {
+		formatGoString(out, readField(str), readField(n))
+		return
+	}
+	if arr, n, c := field("array"), field("len"), field("cap"); strings.HasPrefix(t.StructName, "[]") && arr != nil && n != nil && c != nil {
+		ptr, l := readField(arr), readField(n)
+		fmt.Fprintf(out, "%s len: %d, cap: %d ", t.StructName, l, readField(c))
+		if pt, ok := arr.Type.(*dwarf.PtrType); ok && ptr != 0 && depth < maxValueDepth {
+			formatValue(out, &dwarf.ArrayType{Type: pt.Type, Count: int64(l), CommonType: dwarf.CommonType{ByteSize: int64(l) * pt.Type.Size()}}, ptr, depth+1)
+		} else {
+			formatPointer(out, ptr)
+		}
+		return
+	}
+
+	if t.StructName != "" {
+		out.WriteString(t.StructName)
+	}
+	if depth >= maxValueDepth {
+		out.WriteString(" {...}")
+		return
+	}
+	out.WriteString(" {")
+	for i, f := range t.Field {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		fmt.Fprintf(out, "%s: ", f.Name)
+		if f.BitSize != 0 {
+			formatBitField(out, f, addr)
+			continue
+		}
+		formatValue(out, f.Type, addr+uint64(f.ByteOffset), depth+1)
+	}
+	out.WriteString("}")
+}
+
+func formatBitField(out *strings.Builder, f *dwarf.StructField, addr uint64) {
+	// bit offsets count from the least significant bit of the first byte
+	// on little endian targets and from the most significant one on big
+	// endian targets
+	bigEndian := Arch.ByteOrder == binary.BigEndian
+	bitOff := f.DataBitOffset
+	if bitOff == 0 && f.ByteSize != 0 {
+		// DWARF2 style bit offset, from the most significant bit of the
+		// storage unit described by DW_AT_byte_size, the bit offset
+		// itself is often 0
+		bitOff = f.ByteOffset*8 + f.BitOffset
+		if !bigEndian {
+			bitOff = f.ByteOffset*8 + f.ByteSize*8 - f.BitOffset - f.BitSize
+		}
+	}
+	var buf [8]byte
+	n := (bitOff%8 + f.BitSize + 7) / 8
+	if n > int64(len(buf)) {
+		fmt.Fprintf(out, "<bit field too large>")
+		return
+	}
+	if err := Core.ReadMemory(buf[:n], addr+uint64(bitOff/8)); err != nil {
+		fmt.Fprintf(out, "<%v>", err)
+		return
+	}
+	v := Arch.ByteOrder.Uint64(buf[:])
+	shift := bitOff % 8
+	if bigEndian {
+		shift = 64 - bitOff%8 - f.BitSize
+	}
+	v = (v >> shift) & (1<<f.BitSize - 1)
+	fmt.Fprintf(out, "%d", v)
+}
+
+func formatPointer(out *strings.Builder, ptr uint64) {
+	fmt.Fprintf(out, "%#x", ptr)
+	if ptr == 0 {
+		return
+	}
+	addr := ptr - Core.Bias
+	var lup lookupper
+	name, base := lup.lookup(addr)
+	switch {
+	case name == "":
+	case base == addr:
+		fmt.Fprintf(out, " (%s)", name)
+	case lup.sym.Size != 0:
+		// symbols without a size only match their first byte, the pointer
+		// could be anywhere past them
+		fmt.Fprintf(out, " (%s+%#x)", name, addr-base)
+	}
+}
+
+func formatGoString(out *strings.Builder, ptr, n uint64) {
+	truncated := n > maxStringLen
+	if truncated {
+		n = maxStringLen
+	}
+	buf := make([]byte, n)
+	if err := Core.ReadMemory(buf, ptr); err != nil {
+		fmt.Fprintf(out, "<%v>", err)
+		return
+	}
+	fmt.Fprintf(out, "%q", buf)
+	if truncated {
+		out.WriteString("...")
+	}
+}
+
+func formatCString(out *strings.Builder, addr uint64, n int64) {
+	if n > maxStringLen {
+		n = maxStringLen
+	}
+	buf := make([]byte, n)
+	if err := Core.ReadMemory(buf, addr); err != nil {
+		fmt.Fprintf(out, "<%v>", err)
+		return
+	}
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	fmt.Fprintf(out, "%q", buf)
+}
+
+func formatFloat(out *strings.Builder, buf []byte) {
+	switch len(buf) {
+	case 4:
+		fmt.Fprintf(out, "%g", math.Float32frombits(uint32(readUintN(buf))))
+	case 8:
+		fmt.Fprintf(out, "%g", math.Float64frombits(readUintN(buf)))
+	default:
+		fmt.Fprintf(out, "%x", buf)
+	}
+}
+
+func readUintN(buf []byte) uint64 {
+	switch len(buf) {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(Arch.ByteOrder.Uint16(buf))
+	case 4:
+		return uint64(Arch.ByteOrder.Uint32(buf))
+	case 8:
+		return Arch.ByteOrder.Uint64(buf)
+	}
+	return 0
+}
+
+func readIntN(buf []byte) int64 {
+	v := readUintN(buf)
+	if n := len(buf); n > 0 && n < 8 {
+		shift := 64 - 8*n
+		return int64(v<<shift) >> shift
+	}
+	return int64(v)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// DebugDirs is the list of directories searched for separate debug info files.
+var DebugDirs = []string{"/usr/lib/debug"}
+
+// DataSource records which file some of the data displayed was read from.
+type DataSource struct {
+	What string
+	Path string
+	How  string
+}
+
+var DataSources []DataSource
+
+func init() {
+	onReset(func() {
+		DataSources = nil
+	})
+}
+
+func addDataSource(what, path, how string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	DataSources = append(DataSources, DataSource{What: what, Path: path, How: how})
+}
+
+const _NT_GNU_BUILD_ID = 3
+
+// elfBuildID returns the contents of the .note.gnu.build-id note of file.
+func elfBuildID(file *elf.File) []byte {
+	sect := file.Section(".note.gnu.build-id")
+	if sect == nil {
+		return nil
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return nil
+	}
+	for len(data) >= 12 {
+		namesz := file.ByteOrder.Uint32(data[0:])
+		descsz := file.ByteOrder.Uint32(data[4:])
+		typ := file.ByteOrder.Uint32(data[8:])
+		data = data[12:]
+		nameEnd := (uint64(namesz) + 3) &^ 3
+		descEnd := nameEnd + (uint64(descsz)+3)&^3
+		if uint64(len(data)) < nameEnd+uint64(descsz) {
+			return nil
+		}
+		if typ == _NT_GNU_BUILD_ID && string(data[:namesz]) == "GNU\x00" {
+			return data[nameEnd : nameEnd+uint64(descsz)]
+		}
+		if uint64(len(data)) < descEnd {
+			return nil
+		}
+		data = data[descEnd:]
+	}
+	return nil
+}
+
+// elfDebuglink returns the file name and CRC stored in the .gnu_debuglink
+// section of file.
+func elfDebuglink(file *elf.File) (string, uint32, bool) {
+	sect := file.Section(".gnu_debuglink")
+	if sect == nil {
+		return "", 0, false
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return "", 0, false
+	}
+	n := bytes.IndexByte(data, 0)
+	if n <= 0 {
+		return "", 0, false
+	}
+	crcOff := (n + 4) &^ 3
+	if crcOff+4 > len(data) {
+		return "", 0, false
+	}
+	return string(data[:n]), file.ByteOrder.Uint32(data[crcOff:]), true
+}
+
+// fileBuildID returns the build-id of the ELF file at path.
+func fileBuildID(path string) ([]byte, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return elfBuildID(file), nil
+}
+
+func fileCRC32(path string) (uint32, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, fh); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// findSeparateDebugFile looks for the detached debug info of the executable
+// at path, first by build-id and then by .gnu_debuglink, following the same
+// search order as gdb. Returns the path of the debug file and a description
+// of how it was found.
+func findSeparateDebugFile(path string, file *elf.File) (string, string) {
+	if id := elfBuildID(file); len(id) >= 2 {
+		s := hex.EncodeToString(id)
+		for _, dir := range DebugDirs {
+			p := filepath.Join(dir, ".build-id", s[:2], s[2:]+".debug")
+			if _, err := os.Stat(p); err != nil {
+				continue
+			}
+			dbgid, err := fileBuildID(p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ignoring %s: %v\n", p, err)
+				continue
+			}
+			if !bytes.Equal(dbgid, id) {
+				fmt.Fprintf(os.Stderr, "ignoring %s: build-id mismatch (%x, expected %s)\n", p, dbgid, s)
+				continue
+			}
+			return p, "found via build-id " + s
+		}
+	}
+
+	name, crc, ok := elfDebuglink(file)
+	if !ok {
+		return "", ""
+	}
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		abspath = path
+	}
+	exedir := filepath.Dir(abspath)
+	candidates := []string{filepath.Join(exedir, name), filepath.Join(exedir, ".debug", name)}
+	for _, dir := range DebugDirs {
+		candidates = append(candidates, filepath.Join(dir, exedir, name), filepath.Join(dir, name))
+	}
+	for _, p := range candidates {
+		if p == abspath {
+			continue
+		}
+		c, err := fileCRC32(p)
+		if err != nil {
+			continue
+		}
+		if c != crc {
+			fmt.Fprintf(os.Stderr, "ignoring %s: CRC mismatch (%#x, expected %#x)\n", p, c, crc)
+			continue
+		}
+		return p, fmt.Sprintf("found via .gnu_debuglink %s, CRC %#x", name, crc)
+	}
+	return "", ""
+}
+
+// hasDebugInfoElf returns true if file contains a .debug_info section.
+func hasDebugInfoElf(file *elf.File) bool {
+	for _, name := range []string{".debug_info", ".zdebug_info"} {
+		if sect := file.Section(name); sect != nil && sect.Type != elf.SHT_NOBITS {
+			return true
+		}
+	}
+	return false
+}
+
+// MachoArch selects the slice of a universal binary to explore.
+var MachoArch string
+
+var machoCpuNames = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+func machoCpuName(cpu macho.Cpu) string {
+	if name, ok := machoCpuNames[cpu]; ok {
+		return name
+	}
+	return cpu.String()
+}
+
+// openMachoFile opens the Mach-O file at path, if it is a universal binary
+// the slice for cpu is returned, if cpu is 0 the slice is selected using
+// MachoArch, defaulting to the architecture diexplorer is running on and
+// then to the first slice. Thin binaries must match cpu or MachoArch, if
+// set. Returns a nil file and a nil error if path is not a Mach-O file.
+func openMachoFile(path string, cpu macho.Cpu) (*macho.File, string, error) {
+	file, err := macho.Open(path)
+	if err == nil {
+		want := machoCpuName(cpu)
+		if cpu == 0 {
+			want = MachoArch
+		}
+		if want != "" && machoCpuName(file.Cpu) != want {
+			return nil, "", fmt.Errorf("%s is %s, not %s", path, machoCpuName(file.Cpu), want)
+		}
+		return file, "", nil
+	}
+	fat, err := macho.OpenFat(path)
+	if err != nil {
+		return nil, "", nil
+	}
+	var names []string
+	for _, arch := range fat.Arches {
+		names = append(names, machoCpuName(arch.Cpu))
+	}
+	want := MachoArch
+	switch {
+	case cpu != 0:
+		want = machoCpuName(cpu)
+	case want == "":
+		want = runtime.GOARCH
+		if !slices.Contains(names, want) {
+			want = names[0]
+		}
+		fmt.Fprintf(os.Stderr, "Universal binary with architectures %s, using %s (select with -arch)\n", strings.Join(names, ", "), want)
+	}
+	for _, arch := range fat.Arches {
+		if machoCpuName(arch.Cpu) == want {
+			return arch.File, "universal binary slice " + want, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s has no %s slice (available: %s)", path, want, strings.Join(names, ", "))
+}
+
+const _LC_UUID = 0x1b
+
+// machoUUID returns the contents of the LC_UUID load command of file.
+func machoUUID(file *macho.File) []byte {
+	for _, l := range file.Loads {
+		raw := l.Raw()
+		if len(raw) >= 24 && file.ByteOrder.Uint32(raw) == _LC_UUID {
+			return raw[8:24]
+		}
+	}
+	return nil
+}
+
+func hasDebugInfoMacho(file *macho.File) bool {
+	return file.Section("__debug_info") != nil || file.Section("__zdebug_info") != nil
+}
+
+// findDSYM looks for the dSYM bundle of the executable at path and returns
+// the slice matching file, checking that its UUID matches. Executables
+// without a UUID can not be matched with their dSYM.
+func findDSYM(path string, file *macho.File) (*macho.File, string, string) {
+	uuid := machoUUID(file)
+	if uuid == nil {
+		fmt.Fprintf(os.Stderr, "%s has no UUID, can not match it with a dSYM bundle\n", path)
+		return nil, "", ""
+	}
+	candidates := []string{filepath.Join(path+".dSYM", "Contents", "Resources", "DWARF", filepath.Base(path))}
+	for _, dir := range DebugDirs {
+		candidates = append(candidates, filepath.Join(dir, filepath.Base(path)+".dSYM", "Contents", "Resources", "DWARF", filepath.Base(path)))
+	}
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		dbgfile, _, err := openMachoFile(p, file.Cpu)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring %s: %v\n", p, err)
+			continue
+		}
+		dbguuid := machoUUID(dbgfile)
+		if !bytes.Equal(uuid, dbguuid) {
+			fmt.Fprintf(os.Stderr, "ignoring %s: UUID mismatch (%x, expected %x)\n", p, dbguuid, uuid)
+			continue
+		}
+		return dbgfile, p, fmt.Sprintf("dSYM bundle, UUID %x", uuid)
+	}
+	return nil, "", ""
+}
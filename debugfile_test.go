@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// machoFixture returns a minimal 64bit Mach-O file for cpu, with a LC_UUID
+// load command if uuid is not nil.
+func machoFixture(cpu macho.Cpu, typ macho.Type, uuid []byte) []byte {
+	var cmds bytes.Buffer
+	ncmds := uint32(0)
+	if uuid != nil {
+		binary.Write(&cmds, binary.LittleEndian, [2]uint32{_LC_UUID, 24})
+		cmds.Write(uuid)
+		ncmds++
+	}
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   cpu,
+		Type:  typ,
+		Ncmd:  ncmds,
+		Cmdsz: uint32(cmds.Len()),
+	})
+	binary.Write(&out, binary.LittleEndian, uint32(0)) // reserved
+	out.Write(cmds.Bytes())
+	return out.Bytes()
+}
+
+// fatFixture returns a universal binary containing slices.
+func fatFixture(slices ...[]byte) []byte {
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, [2]uint32{macho.MagicFat, uint32(len(slices))})
+	off := uint32(8 + 20*len(slices))
+	for _, s := range slices {
+		off = (off + 0xfff) &^ 0xfff
+		cpu := binary.LittleEndian.Uint32(s[4:])
+		binary.Write(&out, binary.BigEndian, [5]uint32{cpu, 0, off, uint32(len(s)), 12})
+		off += uint32(len(s))
+	}
+	for _, s := range slices {
+		out.Write(make([]byte, (out.Len()+0xfff)&^0xfff-out.Len()))
+		out.Write(s)
+	}
+	return out.Bytes()
+}
+
+func writeFixture(t *testing.T, path string, data []byte) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// dsymFixture writes the dSYM bundle of the executable at exe.
+func dsymFixture(t *testing.T, exe string, data []byte) {
+	t.Helper()
+	writeFixture(t, filepath.Join(exe+".dSYM", "Contents", "Resources", "DWARF", filepath.Base(exe)), data)
+}
+
+const _MH_DSYM macho.Type = 0xa
+
+var (
+	uuid1 = bytes.Repeat([]byte{0x11}, 16)
+	uuid2 = bytes.Repeat([]byte{0x22}, 16)
+)
+
+func TestOpenMachoFile(t *testing.T) {
+	dir := t.TempDir()
+	thin := writeFixture(t, filepath.Join(dir, "thin"), machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1))
+	fat := writeFixture(t, filepath.Join(dir, "fat"), fatFixture(
+		machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1),
+		machoFixture(macho.CpuArm64, macho.TypeExec, uuid2)))
+	notMacho := writeFixture(t, filepath.Join(dir, "elf"), []byte("\x7fELF"))
+
+	defer func(arch string) { MachoArch = arch }(MachoArch)
+
+	for _, tc := range []struct {
+		path string
+		arch string
+		cpu  macho.Cpu
+		want macho.Cpu // 0 if an error is expected
+	}{
+		{thin, "", 0, macho.CpuAmd64},
+		{thin, "amd64", 0, macho.CpuAmd64},
+		{thin, "arm64", 0, 0},
+		{thin, "", macho.CpuAmd64, macho.CpuAmd64},
+		{thin, "", macho.CpuArm64, 0},
+		{fat, "amd64", 0, macho.CpuAmd64},
+		{fat, "arm64", 0, macho.CpuArm64},
+		{fat, "ppc", 0, 0},
+		{fat, "amd64", macho.CpuArm64, macho.CpuArm64},
+	} {
+		MachoArch = tc.arch
+		file, _, err := openMachoFile(tc.path, tc.cpu)
+		switch {
+		case tc.want == 0 && err == nil:
+			t.Errorf("%s -arch %q cpu %v: expected an error, got %v", filepath.Base(tc.path), tc.arch, tc.cpu, file.Cpu)
+		case tc.want != 0 && err != nil:
+			t.Errorf("%s -arch %q cpu %v: %v", filepath.Base(tc.path), tc.arch, tc.cpu, err)
+		case tc.want != 0 && file.Cpu != tc.want:
+			t.Errorf("%s -arch %q cpu %v: got %v, expected %v", filepath.Base(tc.path), tc.arch, tc.cpu, file.Cpu, tc.want)
+		}
+	}
+
+	MachoArch = ""
+	if file, _, err := openMachoFile(notMacho, 0); file != nil || err != nil {
+		t.Errorf("not a Mach-O file: got %v %v", file, err)
+	}
+}
+
+func TestFindDSYM(t *testing.T) {
+	dir := t.TempDir()
+	defer func(dirs []string) { DebugDirs = dirs }(DebugDirs)
+	DebugDirs = nil
+
+	for _, tc := range []struct {
+		name     string
+		exe      []byte
+		dsym     []byte
+		cpu      macho.Cpu
+		expected bool
+	}{
+		{"match", machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1), machoFixture(macho.CpuAmd64, _MH_DSYM, uuid1), 0, true},
+		{"mismatch", machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1), machoFixture(macho.CpuAmd64, _MH_DSYM, uuid2), 0, false},
+		{"nouuid", machoFixture(macho.CpuAmd64, macho.TypeExec, nil), machoFixture(macho.CpuAmd64, _MH_DSYM, nil), 0, false},
+		{"dsymnouuid", machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1), machoFixture(macho.CpuAmd64, _MH_DSYM, nil), 0, false},
+		{"wrongcpu", machoFixture(macho.CpuAmd64, macho.TypeExec, uuid1), machoFixture(macho.CpuArm64, _MH_DSYM, uuid1), 0, false},
+		{"universal", machoFixture(macho.CpuArm64, macho.TypeExec, uuid2), fatFixture(
+			machoFixture(macho.CpuAmd64, _MH_DSYM, uuid1),
+			machoFixture(macho.CpuArm64, _MH_DSYM, uuid2)), macho.CpuArm64, true},
+	} {
+		exe := writeFixture(t, filepath.Join(dir, tc.name, "exe"), tc.exe)
+		dsymFixture(t, exe, tc.dsym)
+		file, err := macho.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbgfile, dbgpath, _ := findDSYM(exe, file)
+		if (dbgfile != nil) != tc.expected {
+			t.Errorf("%s: got %q, expected a dSYM: %v", tc.name, dbgpath, tc.expected)
+			continue
+		}
+		if dbgfile != nil && tc.cpu != 0 && dbgfile.Cpu != tc.cpu {
+			t.Errorf("%s: got slice %v, expected %v", tc.name, dbgfile.Cpu, tc.cpu)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// dieField is a field of the encoding of an entry in .debug_info.
+type dieField struct {
+	Off   int // offset in the virtual .debug_info section
+	Bytes []byte
+	Label string
+	Form  string
+	Value string
+
+	attr dwarf.Attr
+	form uint64 // form of the attribute, after resolving DW_FORM_indirect
+	val  []byte // encoding of the value
+}
+
+// maxFieldBytes is the maximum number of bytes shown for a single field.
+const maxFieldBytes = 64
+
+// dieBytes decodes the entry at off field by field, independently of
+// debug/dwarf, the first field is the abbreviation code.
+func dieBytes(off dwarf.Offset) ([]dieField, string) {
+	u, code, d := abbrevFor(off)
+	if u == nil {
+		return nil, "entry not found"
+	}
+	b := &lineBuf{data: u.data[:u.end-u.base], off: int(off - u.base), bo: u.byteOrder}
+	var fields []dieField
+	add := func(start int, label, form, value string) {
+		fields = append(fields, dieField{Off: int(u.base) + start, Bytes: b.data[start:b.off], Label: label, Form: form, Value: value})
+	}
+	start := b.off
+	b.uleb()
+	add(start, "abbrev", "", fmt.Sprintf("%d (LEB128)", code))
+	if d == nil {
+		return fields, "abbreviation not found"
+	}
+	for _, a := range d.Attrs {
+		start := b.off
+		form, formName := a.Form, a.FormName()
+		if form == 0x16 { // DW_FORM_indirect
+			form = b.uleb()
+			formName = fmt.Sprintf("%s %s", formName, abbrevAttr{Form: form}.FormName())
+		}
+		valStart := b.off
+		value, ok := u.readForm(b, form, a)
+		if b.eof {
+			b.off = len(b.data)
+			add(start, a.Attr.String(), formName, "")
+			return fields, "entry extends past the end of the unit"
+		}
+		add(start, a.Attr.String(), formName, value)
+		f := &fields[len(fields)-1]
+		f.attr, f.form, f.val = a.Attr, form, b.data[valStart:b.off]
+		if !ok {
+			return fields, fmt.Sprintf("unknown form %#x", form)
+		}
+	}
+	return fields, ""
+}
+
+// readForm reads a value encoded with form and describes it.
+func (u *abbrevUnit) readForm(b *lineBuf, form uint64, a abbrevAttr) (string, bool) {
+	uleb := func() string { return fmt.Sprintf("%d (LEB128)", b.uleb()) }
+	block := func(n uint64) string {
+		b.bytes(int(n))
+		return fmt.Sprintf("length %d", n)
+	}
+	switch form {
+	case 0x01: // DW_FORM_addr
+		return fmt.Sprintf("%#x", b.uint(u.addrSize)), true
+	case 0x0b, 0x0c, 0x11, 0x25, 0x29: // DW_FORM_data1, flag, ref1, strx1, addrx1
+		return fmt.Sprintf("%#x", b.u8()), true
+	case 0x05, 0x12, 0x26, 0x2a: // DW_FORM_data2, ref2, strx2, addrx2
+		return fmt.Sprintf("%#x", b.u16()), true
+	case 0x27, 0x2b: // DW_FORM_strx3, addrx3
+		return fmt.Sprintf("%#x", b.uint(3)), true
+	case 0x06, 0x13, 0x1c, 0x28, 0x2c: // DW_FORM_data4, ref4, ref_sup4, strx4, addrx4
+		return fmt.Sprintf("%#x", b.u32()), true
+	case 0x07, 0x14, 0x20, 0x24: // DW_FORM_data8, ref8, ref_sig8, ref_sup8
+		return fmt.Sprintf("%#x", b.u64()), true
+	case 0x1e: // DW_FORM_data16
+		return fmt.Sprintf("%x", b.bytes(16)), true
+	case 0x0d: // DW_FORM_sdata
+		return fmt.Sprintf("%d (LEB128)", b.sleb()), true
+	case 0x0f, 0x15, 0x1a, 0x1b, 0x22, 0x23, _DW_FORM_GNU_addr_index, _DW_FORM_GNU_str_index:
+		// DW_FORM_udata, ref_udata, strx, addrx, loclistx, rnglistx
+		return uleb(), true
+	case 0x08: // DW_FORM_string
+		return strconv.Quote(b.cstr()), true
+	case 0x0e, 0x17, 0x1d, 0x1f, 0x1f20, 0x1f21:
+		// DW_FORM_strp, sec_offset, strp_sup, line_strp, GNU_ref_alt, GNU_strp_alt
+		return fmt.Sprintf("%#x", b.uint(u.offsz)), true
+	case 0x10: // DW_FORM_ref_addr
+		if u.version <= 2 {
+			return fmt.Sprintf("%#x", b.uint(u.addrSize)), true
+		}
+		return fmt.Sprintf("%#x", b.uint(u.offsz)), true
+	case 0x0a: // DW_FORM_block1
+		return block(uint64(b.u8())), true
+	case 0x03: // DW_FORM_block2
+		return block(uint64(b.u16())), true
+	case 0x04: // DW_FORM_block4
+		return block(uint64(b.u32())), true
+	case 0x09, 0x18: // DW_FORM_block, exprloc
+		return block(b.uleb()), true
+	case 0x19: // DW_FORM_flag_present
+		return "true", true
+	case _DW_FORM_implicit_const:
+		return fmt.Sprintf("%d (in the abbreviation)", a.Const), true
+	}
+	return "", false
+}
+
+// fmtEntryNodeBytes returns the hidden table of the bytes of e, the row
+// of the i-th attribute has id b<offset>_<i>.
+func fmtEntryNodeBytes(e *dwarf.Entry) string {
+	fields, err := dieBytes(e.Offset)
+	if fields == nil {
+		return ""
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, " (<a href='#' onclick='toggleBytes(this)'>bytes</a>)<div class='diebytes' style='display: none'><table class='dwarftbl'>")
+	for i, f := range fields {
+		hex := fmt.Sprintf("% x", f.Bytes)
+		if len(f.Bytes) > maxFieldBytes {
+			hex = fmt.Sprintf("% x ... (%d bytes)", f.Bytes[:maxFieldBytes], len(f.Bytes))
+		}
+		fmt.Fprintf(&buf, "<tr id='b%x_%d'><td>%#x</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>", e.Offset, i-1, f.Off, hex, f.Label, f.Form, html.EscapeString(f.Value))
+	}
+	fmt.Fprintf(&buf, "</table>")
+	if err != "" {
+		fmt.Fprintf(&buf, "<b>%s</b>", err)
+	}
+	fmt.Fprintf(&buf, "</div>")
+	return buf.String()
+}
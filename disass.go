@@ -2,7 +2,6 @@ package main
 
 import (
 	"debug/dwarf"
-	"encoding/binary"
 	"fmt"
 	"html"
 	"io"
@@ -10,9 +9,12 @@ import (
 	"sort"
 	"strings"
 
+	"golang.org/x/arch/arm/armasm"
 	"golang.org/x/arch/arm64/arm64asm"
+	"golang.org/x/arch/loong64/loong64asm"
 	"golang.org/x/arch/ppc64/ppc64asm"
 	"golang.org/x/arch/riscv64/riscv64asm"
+	"golang.org/x/arch/s390x/s390xasm"
 	"golang.org/x/arch/x86/x86asm"
 )
 
@@ -26,7 +28,7 @@ func (l *lookupper) lookup(addr uint64) (string, uint64) {
 	i := sort.Search(len(Symbols), func(i int) bool { return addr < Symbols[i].Addr })
 	if i > 0 {
 		s := &Symbols[i-1]
-		if s.Addr != 0 && s.Addr <= addr {
+		if (s.Addr != 0 || s.Size != 0) && s.Addr <= addr && (s.Size == 0 || addr < s.Addr+s.Size) {
 			l.sym = s
 			return s.Name, s.Addr
 		}
@@ -127,23 +129,23 @@ func printColor(out io.Writer, name string, pi *int) {
 
 }
 
-func printColors(out io.Writer, en *EntryNode, pi *int, debugLoc loclistReader, loclistEntries []loclistEntry) []loclistEntry {
+func printColors(out io.Writer, en *EntryNode, cu *dwarf.Entry, pi *int, debugLoc loclistReader, loclistEntries []loclistEntry) []loclistEntry {
 	for i := range en.Childs {
 		switch en.Childs[i].E.Tag {
 		case dwarf.TagFormalParameter, dwarf.TagVariable, 0:
 			// nothing to do
 		default:
 			printColor(out, fmt.Sprintf("lb%x", en.Childs[i].E.Offset), pi)
-			loclistEntries = printColors(out, en.Childs[i], pi, debugLoc, loclistEntries)
+			loclistEntries = printColors(out, en.Childs[i], cu, pi, debugLoc, loclistEntries)
 		}
 
 		for j := range en.Childs[i].E.Field {
 			field := en.Childs[i].E.Field[j]
-			if field.Class != dwarf.ClassLocListPtr {
+			if debugLoc == nil || (field.Class != dwarf.ClassLocListPtr && field.Class != dwarf.ClassLocList) {
 				continue
 			}
 
-			debugLoc.Seek(int(field.Val.(int64)))
+			debugLoc.Seek(int(loclistOffset(cu, &field)))
 
 			var lle loclistEntry
 			for debugLoc.Next(&lle) {
@@ -160,7 +162,19 @@ func printColors(out io.Writer, en *EntryNode, pi *int, debugLoc loclistReader,
 type DisassembleFunc func(data []uint8, pc uint64, lookup symLookup) (text string, size uint64)
 
 func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
+	fnname, _ := en.E.Val(dwarf.AttrName).(string)
+
+	if len(en.Ranges) == 0 {
+		disassembleError(out, fnname, fmt.Errorf("function has no address ranges"))
+		return
+	}
 	startPC, endPC := en.Ranges[0][0], en.Ranges[0][1]
+	sect, err := findTextSection(startPC, endPC)
+	if err != nil {
+		disassembleError(out, fnname, err)
+		return
+	}
+
 	lnrdr, err := Dwarf.LineReader(ecu)
 	must(err)
 
@@ -172,8 +186,6 @@ func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
 	isstmt := false
 	prologueend := false
 
-	fnname, _ := en.E.Val(dwarf.AttrName).(string)
-
 	fmt.Fprintf(out, `<!DOCTYPE html>
 <html>
 	<head>
@@ -188,7 +200,8 @@ func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
 `)
 
 	var i int
-	loclistEntries := printColors(out, en, &i, loclistReaderForEntry(en), nil)
+	debugLoc := loclistReaderFor(ecu)
+	loclistEntries := printColors(out, en, ecu, &i, debugLoc, nil)
 
 	fmt.Fprintf(out, `
 			};
@@ -216,17 +229,30 @@ func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
 	</head>
 	<body>
 		<h3>Function %q</h3>
-`, fnname)
+		Section %s (%#x-%#x)
+`, fnname, html.EscapeString(sect.Name), sect.Addr, sect.End())
+
+	sites := collectCallSites(en, en.E.Offset, unitOffsetSize(ecu))
+	sitesByPC := map[uint64][]*callSite{}
+	for _, cs := range sites {
+		sitesByPC[cs.ReturnPC] = append(sitesByPC[cs.ReturnPC], cs)
+	}
 
 	// print disassembly
 	fmt.Fprintf(out, "<h3>Disassembly</h3>\n<tt><table id='disasstable'>\n")
-	fmt.Fprintf(out, "<tr><td>Pos</td><td><a href='#flaghelp'>flags</a></td><td>PC</td><td>Bytes</td><td>Instruction</td></tr>\n")
+	fmt.Fprintf(out, "<tr><td>Pos</td><td><a href='#flaghelp'>flags</a></td><td>PC</td><td>Bytes</td><td>Instruction</td>")
+	pclnCells := pclnColumns(out, startPC)
+	pclnMismatch := pclnMismatches(startPC)
+	fmt.Fprintf(out, "</tr>\n")
 	for pc := startPC; pc < endPC; {
-		i := uint64(pc) - TextStart
+		i := uint64(pc) - sect.Addr
 
 		var lup lookupper
 
-		text, size := DisassembleOne(TextData[i:], pc, lup.lookup)
+		text, size := Arch.Disassemble(sect.Data[i:], pc, lup.lookup)
+		if size == 0 || i+size > uint64(len(sect.Data)) {
+			size = uint64(len(sect.Data)) - i
+		}
 
 		// find file:line
 		for lnevalid && lne.Address < pc {
@@ -249,7 +275,7 @@ func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
 			prologueend = false
 		}
 
-		fmt.Fprintf(out, "<tr class=\"%s\">", strings.Join(findScopesAndLoclists(en, pc, loclistEntries), " "))
+		fmt.Fprintf(out, "<tr id=\"pc%x\" class=\"%s\"%s>", pc, strings.Join(findScopesAndLoclists(en, pc, loclistEntries), " "), pclnMismatch(pc))
 
 		flagstr := ""
 		if isstmt {
@@ -261,23 +287,37 @@ func disassemble(out io.Writer, en *EntryNode, ecu *dwarf.Entry) {
 
 		link := ""
 
-		if lup.sym != nil && lup.sym.Off != en.E.Offset {
+		if lup.sym != nil && !lup.sym.HasDIE() {
+			link = fmt.Sprintf("&nbsp;&nbsp;(%s)", html.EscapeString(lup.sym.Source))
+		} else if lup.sym != nil && lup.sym.Off != en.E.Offset {
 			link = fmt.Sprintf("&nbsp;&nbsp;<a href='/%x'>&gt;&gt;&gt;</a>", lup.sym.Off)
 		}
 
-		fmt.Fprintf(out, "<td>%s:%d</td><td>%s</td><td>%#x</td><td>%x</td><td>%s%s</td>\n", html.EscapeString(filepath.Base(file)), line, flagstr, pc, TextData[i:i+size], html.EscapeString(text), link)
+		for _, cs := range sitesByPC[pc+size] {
+			link += fmt.Sprintf("&nbsp;&nbsp;<a href='#cs%x'>call site</a> %s", cs.Off, fmtCallSiteTarget(cs))
+		}
+
+		fmt.Fprintf(out, "<td>%s:%d</td><td>%s</td><td>%#x</td><td>%x</td><td>%s%s</td>", html.EscapeString(filepath.Base(file)), line, flagstr, pc, sect.Data[i:i+size], html.EscapeString(text), link)
+		pclnCells(pc)
+		fmt.Fprintf(out, "\n")
 
 		fmt.Fprintf(out, "</tr>\n")
 		pc += size
 	}
-	fmt.Fprintf(out, "</table></tt>\n<a name='flaghelp'></a><h3>Flag Help</h3>S - statement<br>P - end of prologue<br></body>\n")
+	fmt.Fprintf(out, "</table></tt>\n")
+	callSitesSynthesis(out, en, ecu, debugLoc, sites)
+	fmt.Fprintf(out, "<a name='flaghelp'></a><h3>Flag Help</h3>S - statement<br>P - end of prologue<br></body>\n")
+}
+
+func disassembleError(out io.Writer, fnname string, err error) {
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html><body><h3>Function %q</h3>\nCan not disassemble: %s</body></html>\n", fnname, html.EscapeString(err.Error()))
 }
 
 func disassembleOneAmd64(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
 	inst, err := x86asm.Decode(data, 64)
 	size = uint64(inst.Len)
 	if err != nil || size == 0 || inst.Op == 0 {
-		return "?", 1
+		return "?", uint64(Arch.InstrAlign)
 	}
 	text = x86asm.GoSyntax(inst, pc, x86asm.SymLookup(lookup))
 	return text, size
@@ -287,7 +327,7 @@ func disassembleOne386(data []uint8, pc uint64, lookup symLookup) (text string,
 	inst, err := x86asm.Decode(data, 32)
 	size = uint64(inst.Len)
 	if err != nil || size == 0 || inst.Op == 0 {
-		return "?", 1
+		return "?", uint64(Arch.InstrAlign)
 	}
 	text = x86asm.GoSyntax(inst, pc, x86asm.SymLookup(lookup))
 	return text, size
@@ -296,7 +336,7 @@ func disassembleOne386(data []uint8, pc uint64, lookup symLookup) (text string,
 func disassembleOneArm64(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
 	inst, err := arm64asm.Decode(data)
 	if err != nil {
-		return "?", 4
+		return "?", uint64(Arch.InstrAlign)
 	}
 	size = 4
 	text = arm64asm.GoSyntax(inst, pc, lookup, nil)
@@ -304,9 +344,9 @@ func disassembleOneArm64(data []uint8, pc uint64, lookup symLookup) (text string
 }
 
 func disassembleOnePpc64(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
-	inst, err := ppc64asm.Decode(data, binary.LittleEndian)
+	inst, err := ppc64asm.Decode(data, Arch.ByteOrder)
 	if err != nil {
-		return "?", 4
+		return "?", uint64(Arch.InstrAlign)
 	}
 	size = 4
 	text = ppc64asm.GoSyntax(inst, pc, lookup)
@@ -315,11 +355,47 @@ func disassembleOnePpc64(data []uint8, pc uint64, lookup symLookup) (text string
 
 func disassembleOneRiscv64(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
 	inst, err := riscv64asm.Decode(data)
+	if err != nil || inst.Len == 0 {
+		return "?", uint64(Arch.InstrAlign)
+	}
+	size = uint64(inst.Len)
+	text = riscv64asm.GoSyntax(inst, pc, lookup, nil)
+	return text, size
+}
+
+func disassembleOneArm(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
+	inst, err := armasm.Decode(data, armasm.ModeARM)
 	if err != nil {
-		return "?", 4
+		return "?", uint64(Arch.InstrAlign)
 	}
 	size = 4
-	text = riscv64asm.GoSyntax(inst, pc, lookup, nil)
+	text = armasm.GoSyntax(inst, pc, lookup, nil)
+	return text, size
+}
+
+func disassembleOneLoong64(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
+	inst, err := loong64asm.Decode(data)
+	if err != nil {
+		return "?", uint64(Arch.InstrAlign)
+	}
+	size = 4
+	text = loong64asm.GoSyntax(inst, pc, lookup)
 	return text, size
+}
 
+func disassembleOneS390x(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
+	inst, err := s390xasm.Decode(data)
+	if err != nil || inst.Len == 0 {
+		return "?", uint64(Arch.InstrAlign)
+	}
+	return s390xasm.GNUSyntax(inst, pc), uint64(inst.Len)
+}
+
+// disassembleOneWord is used for architectures without a disassembler, it
+// prints one 32bit word at a time.
+func disassembleOneWord(data []uint8, pc uint64, lookup symLookup) (text string, size uint64) {
+	if len(data) < 4 {
+		return "?", uint64(len(data))
+	}
+	return fmt.Sprintf(".word %#08x", Arch.ByteOrder.Uint32(data)), 4
 }
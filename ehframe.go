@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/frame"
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+var EhFrame frame.FrameDescriptionEntries
+var EhFrameHdr []ehFrameHdrEntry
+
+// FrameInfo records the section each CIE and FDE was read from and any
+// problem found while cross-checking them.
+var FrameInfo = map[interface{}]*frameEntryInfo{}
+
+func init() {
+	onReset(func() {
+		EhFrame, EhFrameHdr = nil, nil
+		FrameInfo = map[interface{}]*frameEntryInfo{}
+	})
+}
+
+type frameEntryInfo struct {
+	Section string
+	Offset  uint64
+	Problem string
+}
+
+func (fi *frameEntryInfo) addProblem(format string, args ...interface{}) {
+	if fi.Problem != "" {
+		fi.Problem += "; "
+	}
+	fi.Problem += fmt.Sprintf(format, args...)
+}
+
+// ehFrameHdrEntry is an entry of the binary search table of .eh_frame_hdr.
+type ehFrameHdrEntry struct {
+	Loc     uint64
+	FDEAddr uint64
+	FDE     *frame.FrameDescriptionEntry
+	Problem string
+}
+
+const (
+	_DW_EH_PE_absptr  = 0x00
+	_DW_EH_PE_uleb128 = 0x01
+	_DW_EH_PE_udata2  = 0x02
+	_DW_EH_PE_udata4  = 0x03
+	_DW_EH_PE_udata8  = 0x04
+	_DW_EH_PE_sleb128 = 0x09
+	_DW_EH_PE_sdata2  = 0x0a
+	_DW_EH_PE_sdata4  = 0x0b
+	_DW_EH_PE_sdata8  = 0x0c
+	_DW_EH_PE_pcrel   = 0x10
+	_DW_EH_PE_datarel = 0x30
+	_DW_EH_PE_omit    = 0xff
+)
+
+// readEncodedPtr reads a pointer encoded as specified by enc from buf, the
+// pointer is stored at address addr, dataBase is the value used for
+// DW_EH_PE_datarel (the address of .eh_frame_hdr).
+func readEncodedPtr(buf *bytes.Reader, enc uint8, addr, dataBase uint64) (uint64, error) {
+	if enc == _DW_EH_PE_omit {
+		return 0, nil
+	}
+	var ptr uint64
+	var err error
+	read := func(sz int) uint64 {
+		b := make([]byte, sz)
+		if _, err2 := buf.Read(b); err2 != nil {
+			err = err2
+			return 0
+		}
+		switch sz {
+		case 2:
+			return uint64(Arch.ByteOrder.Uint16(b))
+		case 4:
+			return uint64(Arch.ByteOrder.Uint32(b))
+		default:
+			return Arch.ByteOrder.Uint64(b)
+		}
+	}
+	switch enc & 0x0f {
+	case _DW_EH_PE_absptr:
+		ptr = read(Arch.PtrSize)
+	case _DW_EH_PE_uleb128:
+		ptr, _ = leb128.DecodeUnsigned(buf)
+	case _DW_EH_PE_udata2:
+		ptr = read(2)
+	case _DW_EH_PE_udata4:
+		ptr = read(4)
+	case _DW_EH_PE_udata8, _DW_EH_PE_sdata8:
+		ptr = read(8)
+	case _DW_EH_PE_sleb128:
+		n, _ := leb128.DecodeSigned(buf)
+		ptr = uint64(n)
+	case _DW_EH_PE_sdata2:
+		ptr = uint64(int16(read(2)))
+	case _DW_EH_PE_sdata4:
+		ptr = uint64(int32(read(4)))
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	switch enc & 0x70 {
+	case 0:
+	case _DW_EH_PE_pcrel:
+		ptr += addr
+	case _DW_EH_PE_datarel:
+		ptr += dataBase
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	return ptr, err
+}
+
+// frameEntryOffsets walks a frame section, in the byte order returned by
+// fixFrameByteOrder and mapped at addr, and returns the offsets of the FDEs
+// for each start address, in the order they appear, and the offset of the
+// CIE of each FDE.
+func frameEntryOffsets(data []byte, eh bool, addr uint64) (fdes map[uint64][]uint64, cieOf map[uint64]uint64) {
+	fdes, cieOf = map[uint64][]uint64{}, map[uint64]uint64{}
+	cieEnc := map[uint64]uint8{}
+	off := uint64(0)
+	for off+4 <= uint64(len(data)) {
+		length := uint64(binary.LittleEndian.Uint32(data[off:]))
+		hdrsz := uint64(4)
+		idsz := uint64(4)
+		if length == 0xffffffff {
+			if off+12 > uint64(len(data)) {
+				break
+			}
+			length = binary.LittleEndian.Uint64(data[off+4:])
+			hdrsz, idsz = 12, 8
+		}
+		if length == 0 {
+			off += hdrsz
+			continue
+		}
+		if off+hdrsz+idsz > uint64(len(data)) || length < idsz || off+hdrsz+length > uint64(len(data)) {
+			break
+		}
+		entry := data[off+hdrsz : off+hdrsz+length]
+		var id uint64
+		if idsz == 4 {
+			id = uint64(binary.LittleEndian.Uint32(entry))
+		} else {
+			id = binary.LittleEndian.Uint64(entry)
+		}
+		switch {
+		case eh && id == 0:
+			cieEnc[off] = parseCIEAugmentation(entry[idsz:], nil)
+		case !eh && (id == 0xffffffff || id == 0xffffffffffffffff):
+			cieEnc[off] = _DW_EH_PE_absptr
+		default:
+			cie := id
+			if eh {
+				// relative to the CIE pointer itself
+				cie = off + hdrsz - id
+			}
+			cieOf[off] = cie
+			if enc, ok := cieEnc[cie]; ok {
+				begin, ok := readFDEBegin(entry[idsz:], enc, addr+off+hdrsz+idsz)
+				if ok {
+					fdes[begin] = append(fdes[begin], off)
+				}
+			}
+		}
+		off += hdrsz + length
+	}
+	return fdes, cieOf
+}
+
+// readFDEBegin decodes the start address of a FDE, b is the FDE after the
+// CIE pointer, stored at addr.
+func readFDEBegin(b []byte, enc uint8, addr uint64) (uint64, bool) {
+	sz := encodedPtrSize(enc, b)
+	if sz > len(b) {
+		return 0, false
+	}
+	var ptr uint64
+	switch {
+	case sz < 0:
+		buf := bytes.NewBuffer(b)
+		if enc&0x0f == _DW_EH_PE_sleb128 {
+			n, _ := leb128.DecodeSigned(buf)
+			ptr = uint64(n)
+		} else {
+			ptr, _ = leb128.DecodeUnsigned(buf)
+		}
+	case sz == 2:
+		ptr = uint64(binary.LittleEndian.Uint16(b))
+		if enc&0x0f == _DW_EH_PE_sdata2 {
+			ptr = uint64(int16(ptr))
+		}
+	case sz == 4:
+		ptr = uint64(binary.LittleEndian.Uint32(b))
+		if enc&0x0f == _DW_EH_PE_sdata4 {
+			ptr = uint64(int32(ptr))
+		}
+	case sz == 8:
+		ptr = binary.LittleEndian.Uint64(b)
+	default:
+		return 0, false
+	}
+	if enc&0x70 == _DW_EH_PE_pcrel {
+		ptr += addr
+	}
+	return ptr, true
+}
+
+// setFrameInfo records the section and offset of the entries in fdes, data
+// is the section, mapped at addr.
+func setFrameInfo(fdes frame.FrameDescriptionEntries, data []byte, section string, addr uint64) {
+	fdeOffs, cieOf := frameEntryOffsets(data, section == ".eh_frame", addr)
+	for _, fde := range fdes {
+		if fde.CIE != nil && FrameInfo[fde.CIE] == nil {
+			FrameInfo[fde.CIE] = &frameEntryInfo{Section: section}
+		}
+		FrameInfo[fde] = &frameEntryInfo{Section: section}
+		// frame.Parse returns the FDEs in the order they appear in the section
+		offs := fdeOffs[fde.Begin()]
+		if len(offs) == 0 {
+			FrameInfo[fde].addProblem("could not find the FDE in %s", section)
+			continue
+		}
+		FrameInfo[fde].Offset = offs[0]
+		fdeOffs[fde.Begin()] = offs[1:]
+		if fde.CIE != nil {
+			FrameInfo[fde.CIE].Offset = cieOf[offs[0]]
+		}
+	}
+}
+
+// loadEhFrame parses the .eh_frame section, mapped at addr, and the
+// .eh_frame_hdr section, mapped at hdrAddr, and cross-checks them with
+// .debug_frame.
+func loadEhFrame(data []byte, addr uint64, hdr []byte, hdrAddr uint64) {
+	var err error
+	data = fixFrameByteOrder(data, true)
+	EhFrame, err = frame.Parse(data, Arch.ByteOrder, 0, Arch.PtrSize, addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not parse .eh_frame: %v\n", err)
+		return
+	}
+	setFrameInfo(EhFrame, data, ".eh_frame", addr)
+	if hdr != nil {
+		EhFrameHdr, err = parseEhFrameHdr(hdr, hdrAddr, addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not parse .eh_frame_hdr: %v\n", err)
+		}
+	}
+	compareFrames(EhFrame, DebugFrame)
+}
+
+// parseEhFrameHdr decodes the binary search table of .eh_frame_hdr and
+// matches each entry with the FDE it points to.
+func parseEhFrameHdr(hdr []byte, hdrAddr, ehFrameAddr uint64) ([]ehFrameHdrEntry, error) {
+	if len(hdr) < 4 {
+		return nil, fmt.Errorf("section too short")
+	}
+	if hdr[0] != 1 {
+		return nil, fmt.Errorf("unknown version %d", hdr[0])
+	}
+	ehFramePtrEnc, fdeCountEnc, tableEnc := hdr[1], hdr[2], hdr[3]
+	buf := bytes.NewReader(hdr)
+	buf.Seek(4, 0)
+	pos := func() uint64 {
+		return hdrAddr + uint64(len(hdr)-buf.Len())
+	}
+	ehFramePtr, err := readEncodedPtr(buf, ehFramePtrEnc, pos(), hdrAddr)
+	if err != nil {
+		return nil, err
+	}
+	if ehFramePtr != ehFrameAddr {
+		fmt.Fprintf(os.Stderr, ".eh_frame_hdr points to %#x, but .eh_frame is at %#x\n", ehFramePtr, ehFrameAddr)
+	}
+	if fdeCountEnc == _DW_EH_PE_omit || tableEnc == _DW_EH_PE_omit {
+		return nil, nil
+	}
+	count, err := readEncodedPtr(buf, fdeCountEnc, pos(), hdrAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	fdeAt := map[uint64]*frame.FrameDescriptionEntry{}
+	for _, fde := range EhFrame {
+		fdeAt[ehFrameAddr+FrameInfo[fde].Offset] = fde
+	}
+	inTable := map[*frame.FrameDescriptionEntry]bool{}
+
+	var r []ehFrameHdrEntry
+	for i := uint64(0); i < count && buf.Len() > 0; i++ {
+		var e ehFrameHdrEntry
+		e.Loc, err = readEncodedPtr(buf, tableEnc, pos(), hdrAddr)
+		if err != nil {
+			return r, err
+		}
+		e.FDEAddr, err = readEncodedPtr(buf, tableEnc, pos(), hdrAddr)
+		if err != nil {
+			return r, err
+		}
+		e.FDE = fdeAt[e.FDEAddr]
+		switch {
+		case e.FDE == nil:
+			e.Problem = fmt.Sprintf("no FDE at %#x", e.FDEAddr)
+		case e.FDE.Begin() != e.Loc:
+			e.Problem = fmt.Sprintf("FDE at %#x starts at %#x", e.FDEAddr, e.FDE.Begin())
+		}
+		if len(r) > 0 && e.Loc < r[len(r)-1].Loc {
+			e.Problem = "table not sorted"
+		}
+		inTable[e.FDE] = true
+		r = append(r, e)
+	}
+	if uint64(len(r)) != count {
+		fmt.Fprintf(os.Stderr, ".eh_frame_hdr truncated, %d entries of %d\n", len(r), count)
+	}
+	for _, fde := range EhFrame {
+		if !inTable[fde] {
+			FrameInfo[fde].addProblem("missing from .eh_frame_hdr")
+		}
+	}
+	return r, nil
+}
+
+// compareFrames flags the FDEs of a that describe code also described by
+// an FDE of b, but with a different range or different unwind rules.
+func compareFrames(a, b frame.FrameDescriptionEntries) {
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+	sorted := append(frame.FrameDescriptionEntries{}, b...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Begin() < sorted[j].Begin() })
+	for _, fde := range a {
+		i := sort.Search(len(sorted), func(i int) bool { return sorted[i].End() > fde.Begin() })
+		for ; i < len(sorted) && sorted[i].Begin() < fde.End(); i++ {
+			other := sorted[i]
+			if other.Begin() != fde.Begin() || other.End() != fde.End() {
+				FrameInfo[fde].addProblem("range differs from %s FDE %#x..%#x", FrameInfo[other].Section, other.Begin(), other.End())
+				FrameInfo[other].addProblem("range differs from %s FDE %#x..%#x", FrameInfo[fde].Section, fde.Begin(), fde.End())
+				continue
+			}
+			if pc, ok := sameUnwindRules(fde, other); !ok {
+				FrameInfo[fde].addProblem("unwind rules differ from %s FDE at %#x", FrameInfo[other].Section, pc)
+				FrameInfo[other].addProblem("unwind rules differ from %s FDE at %#x", FrameInfo[fde].Section, pc)
+			}
+		}
+	}
+}
+
+// sameUnwindRules compares the rows of the unwind tables of two FDEs
+// covering the same range, returns the address of the first row that
+// differs.
+func sameUnwindRules(a, b *frame.FrameDescriptionEntry) (pc uint64, ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ok = false
+		}
+	}()
+	pcs := append(frameRowAddrs(a), frameRowAddrs(b)...)
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+	if a.CIE.ReturnAddressRegister != b.CIE.ReturnAddressRegister {
+		return a.Begin(), false
+	}
+	for _, pc = range pcs {
+		if pc >= a.End() {
+			break
+		}
+		fa, fb := a.EstablishFrame(pc), b.EstablishFrame(pc)
+		if !reflect.DeepEqual(fa.CFA, fb.CFA) || !reflect.DeepEqual(fa.Regs, fb.Regs) {
+			return pc, false
+		}
+	}
+	return 0, true
+}
+
+// frameRowAddrs returns the addresses where new rows of the unwind table of
+// fde start.
+func frameRowAddrs(fde *frame.FrameDescriptionEntry) []uint64 {
+	in := bytes.NewBuffer(fde.Instructions)
+	loc := fde.Begin()
+	r := []uint64{loc}
+	caf := fde.CIE.CodeAlignmentFactor
+	for {
+		opcode, err := in.ReadByte()
+		if err != nil {
+			break
+		}
+		if _, found := frameOpcodeHigh2[opcode>>6]; found {
+			if opcode>>6 == 0x1 { // DW_CFA_advance_loc
+				loc += uint64(opcode&0x3f) * caf
+				r = append(r, loc)
+			}
+			opcode = opcode & 0xc0
+		} else if _, found := frameOpcodeLow6[opcode&0x3f]; !found {
+			continue
+		}
+		for _, arg := range frameOpcodeArgs[opcode] {
+			var delta uint64
+			switch arg {
+			case 's':
+				leb128.DecodeSigned(in)
+			case 'u', 'r':
+				leb128.DecodeUnsigned(in)
+			case '1':
+				b, _ := in.ReadByte()
+				delta = uint64(b)
+			case '2':
+				delta = uint64(Arch.ByteOrder.Uint16(in.Next(2)))
+			case '4':
+				delta = uint64(Arch.ByteOrder.Uint32(in.Next(4)))
+			case '8':
+				in.Next(8)
+			case 'B':
+				sz, _ := leb128.DecodeUnsigned(in)
+				in.Next(int(sz))
+			}
+			if delta != 0 {
+				loc += delta * caf
+				r = append(r, loc)
+			}
+		}
+	}
+	return r
+}
+
+// fixFrameByteOrder returns a copy of the .debug_frame or .eh_frame section
+// data where the fields frame.Parse always reads as little endian (entry
+// lengths, CIE pointers and FDE address ranges) have been converted from
+// the byte order of the executable. Instructions are left alone, they are
+// decoded using the byte order passed to frame.Parse.
+func fixFrameByteOrder(data []byte, eh bool) []byte {
+	if Arch.ByteOrder == binary.LittleEndian {
+		return data
+	}
+	data = append([]byte(nil), data...)
+	swap := func(b []byte) {
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+	}
+	cieEnc := map[int]uint8{}
+
+	off := 0
+	for off+8 <= len(data) {
+		swap(data[off : off+4])
+		length := int(binary.LittleEndian.Uint32(data[off:]))
+		if length == 0 {
+			off += 4
+			continue
+		}
+		if length == 0xffffffff || off+4+length > len(data) {
+			// 64bit DWARF is not supported by frame.Parse
+			break
+		}
+		entry := data[off+4 : off+4+length]
+		if !eh && Arch.ByteOrder.Uint32(entry) == 0xffffffff || eh && Arch.ByteOrder.Uint32(entry) == 0 {
+			// CIE
+			enc := uint8(_DW_EH_PE_absptr)
+			if eh {
+				enc = parseCIEAugmentation(entry[4:], swap)
+			}
+			cieEnc[off] = enc
+		} else {
+			// FDE
+			swap(entry[:4])
+			cie := int(binary.LittleEndian.Uint32(entry))
+			if eh {
+				// relative to the CIE pointer itself
+				cie = off + 4 - cie
+			}
+			if enc, ok := cieEnc[cie]; ok {
+				rest := entry[4:]
+				for i := 0; i < 2; i++ {
+					sz := encodedPtrSize(enc, rest)
+					if sz < 0 {
+						rest = rest[-sz:]
+						continue
+					}
+					if sz > len(rest) {
+						break
+					}
+					swap(rest[:sz])
+					rest = rest[sz:]
+				}
+			}
+		}
+		off += 4 + length
+	}
+	return data
+}
+
+// encodedPtrSize returns the size of the pointer encoded as specified by
+// enc at the start of b, variable length encodings return minus their
+// size.
+func encodedPtrSize(enc uint8, b []byte) int {
+	switch enc & 0x0f {
+	case _DW_EH_PE_absptr:
+		return Arch.PtrSize
+	case _DW_EH_PE_udata2, _DW_EH_PE_sdata2:
+		return 2
+	case _DW_EH_PE_udata4, _DW_EH_PE_sdata4:
+		return 4
+	case _DW_EH_PE_udata8, _DW_EH_PE_sdata8:
+		return 8
+	case _DW_EH_PE_uleb128, _DW_EH_PE_sleb128:
+		n := 0
+		for n < len(b) && b[n]&0x80 != 0 {
+			n++
+		}
+		return -(n + 1)
+	}
+	return 0
+}
+
+// parseCIEAugmentation returns the encoding of the addresses of the FDEs of
+// a .eh_frame CIE, b is the CIE after the CIE id. If personality is not nil
+// it is called with the bytes of the personality routine pointer.
+func parseCIEAugmentation(b []byte, personality func([]byte)) uint8 {
+	enc := uint8(_DW_EH_PE_absptr)
+	buf := bytes.NewBuffer(b)
+	version, _ := buf.ReadByte()
+	aug, _ := buf.ReadString(0)
+	leb128.DecodeUnsigned(buf) // code alignment factor
+	leb128.DecodeSigned(buf)   // data alignment factor
+	if version == 1 {
+		buf.ReadByte()
+	} else {
+		leb128.DecodeUnsigned(buf)
+	}
+	if len(aug) > 0 && aug[0] == 'z' {
+		leb128.DecodeUnsigned(buf)
+		for _, c := range aug[1 : len(aug)-1] {
+			switch c {
+			case 'R':
+				enc, _ = buf.ReadByte()
+			case 'L':
+				buf.ReadByte()
+			case 'P':
+				penc, _ := buf.ReadByte()
+				rest := buf.Bytes()
+				sz := encodedPtrSize(penc&^0x80, rest)
+				if sz < 0 {
+					// variable length encodings don't need swapping
+					buf.Next(-sz)
+					continue
+				}
+				if sz > len(rest) {
+					return enc
+				}
+				if personality != nil {
+					personality(rest[:sz])
+				}
+				buf.Next(sz)
+			}
+		}
+	}
+	return enc
+}
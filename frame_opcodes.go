@@ -43,24 +43,24 @@ var frameOpcodeArgs = map[uint8]string{
 	0x2:  "1",
 	0x3:  "2",
 	0x4:  "4",
-	0x5:  "uu",
-	0x6:  "u",
-	0x7:  "u",
-	0x8:  "u",
-	0x9:  "uu",
+	0x5:  "ru",
+	0x6:  "r",
+	0x7:  "r",
+	0x8:  "r",
+	0x9:  "rr",
 	0xa:  "",
 	0xb:  "",
-	0xc:  "uu",
-	0xd:  "u",
+	0xc:  "ru",
+	0xd:  "r",
 	0xe:  "u",
 	0xf:  "B",
-	0x10: "uB",
-	0x11: "us",
-	0x12: "us",
+	0x10: "rB",
+	0x11: "rs",
+	0x12: "rs",
 	0x13: "s",
-	0x14: "uu",
-	0x15: "us",
-	0x16: "uB",
+	0x14: "ru",
+	0x15: "rs",
+	0x16: "rB",
 	0x1c: "",
 	0x3f: "",
 }
@@ -4,9 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 
 	"github.com/go-delve/delve/pkg/dwarf/leb128"
-	"github.com/go-delve/delve/pkg/dwarf/op"
 )
 
 //go:generate go run scripts/gen-frame-opcodes.go ./frame_opcodes.txt ./frame_opcodes.go
@@ -35,6 +35,8 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 			if name == "DW_CFA_advance_loc" {
 				loc += uint64(low6)
 				fmt.Fprintf(out, "to %#x ", loc)
+			} else {
+				printRegName(out, uint64(low6))
 			}
 		} else {
 			name, found = frameOpcodeLow6[low6]
@@ -55,9 +57,13 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 			case 'u':
 				n, _ := leb128.DecodeUnsigned(in)
 				fmt.Fprintf(out, "%#x ", n)
+			case 'r':
+				n, _ := leb128.DecodeUnsigned(in)
+				fmt.Fprintf(out, "%#x ", n)
+				printRegName(out, n)
 			case '1':
 				var x uint8
-				binary.Read(in, binary.LittleEndian, &x)
+				binary.Read(in, Arch.ByteOrder, &x)
 				fmt.Fprintf(out, "%#x ", x)
 				if name == "DW_CFA_advance_loc1" {
 					loc += uint64(x)
@@ -65,7 +71,7 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 				}
 			case '2':
 				var x uint16
-				binary.Read(in, binary.LittleEndian, &x)
+				binary.Read(in, Arch.ByteOrder, &x)
 				fmt.Fprintf(out, "%#x ", x)
 				if name == "DW_CFA_advance_loc2" {
 					loc += uint64(x)
@@ -73,7 +79,7 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 				}
 			case '4':
 				var x uint32
-				binary.Read(in, binary.LittleEndian, &x)
+				binary.Read(in, Arch.ByteOrder, &x)
 				fmt.Fprintf(out, "%#x ", x)
 				if name == "DW_CFA_advance_loc4" {
 					loc += uint64(x)
@@ -81,7 +87,7 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 				}
 			case '8':
 				var x uint64
-				binary.Read(in, binary.LittleEndian, &x)
+				binary.Read(in, Arch.ByteOrder, &x)
 				fmt.Fprintf(out, "%#x ", x)
 				if name == "DW_CFA_set_loc" {
 					//TODO: set loc
@@ -92,7 +98,8 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 				data := make([]byte, sz)
 				sz2, _ := in.Read(data)
 				data = data[:sz2]
-				op.PrettyPrint(out, data, RegnumToString)
+				// call frame expressions can not refer to .debug_info
+				PrettyPrintOp(out, data, 4)
 				fmt.Fprintf(out, "")
 			}
 		}
@@ -101,3 +108,9 @@ func PrettyPrintFrameInstr(instrs []uint8, lowpc uint64) string {
 
 	return out.String()
 }
+
+func printRegName(out io.Writer, n uint64) {
+	if Arch.RegnumToString != nil {
+		fmt.Fprintf(out, "(%s) ", Arch.RegnumToString(n))
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Instantiations of generic Go functions and types. The compiler generates
+// one instantiation for every combination of go.shape.* types and passes it
+// a dictionary, describing the actual type arguments, in its .dict
+// parameter. The typedefs with DW_AT_go_dict_index inside an instantiation
+// give the index of the dictionary slot holding their runtime type.
+
+type generic struct {
+	Name  string // name without type arguments
+	Insts []*genericInst
+	Dicts []*goDict // dictionaries not matched to any instantiation
+}
+
+type genericInst struct {
+	Off     dwarf.Offset
+	Tag     dwarf.Tag
+	Name    string
+	Args    []string
+	Size    uint64 // code size of a function, byte size of a type
+	Ranges  [][2]uint64
+	Params  []dictParam
+	DictLen int // number of slots of .dict, 0 if unknown
+	Dicts   []*goDict
+}
+
+// dictParam is a typedef with DW_AT_go_dict_index.
+type dictParam struct {
+	Index    int
+	Off      dwarf.Offset
+	Name     string
+	Type     dwarf.Offset
+	TypeName string
+	Rtype    uint64 // runtime type of Type
+}
+
+// goDict is a dictionary symbol, named pkg..dict.Name[args].
+type goDict struct {
+	Sym  Sym
+	Base string
+	Args []string
+}
+
+var genericsByName map[string]*generic
+var genericOf map[dwarf.Offset]*generic
+
+func init() {
+	onReset(func() {
+		genericsByName, genericOf = nil, nil
+	})
+}
+
+// splitGenericName splits the name of an instantiation into the name
+// without type arguments and the type arguments.
+func splitGenericName(name string) (base string, args []string, ok bool) {
+	for _, prefix := range []string{"go.shape.", "*", "[", "map[", "chan ", "<-chan ", "func(", "struct ", "interface "} {
+		if strings.HasPrefix(name, prefix) {
+			return "", nil, false
+		}
+	}
+	start := strings.Index(name, "[")
+	if start <= 0 || !strings.Contains(name[:start], ".") {
+		return "", nil, false
+	}
+	depth, argStart := 0, start+1
+	for i := start; i < len(name); i++ {
+		switch name[i] {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 1 {
+				args = append(args, name[argStart:i])
+				argStart = i + 1
+			}
+		}
+		if depth == 0 {
+			args = append(args, name[argStart:i])
+			return name[:start] + name[i+1:], args, true
+		}
+	}
+	return "", nil, false
+}
+
+// dictBase returns the name of the dictionaries used by the generic
+// function base, methods use the dictionaries of their receiver type.
+func dictBase(base string) string {
+	s := strings.Replace(strings.Replace(base, "(*", "", 1), ")", "", 1)
+	pkgEnd := strings.LastIndex(s, "/") + 1
+	pkgEnd += strings.Index(s[pkgEnd:], ".")
+	if i := strings.LastIndex(s, "."); i > pkgEnd {
+		return s[:i]
+	}
+	return s
+}
+
+func isShape(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "go.shape.") {
+			return true
+		}
+	}
+	return false
+}
+
+func genericFor(name string) *generic {
+	g := genericsByName[name]
+	if g == nil {
+		g = &generic{Name: name}
+		genericsByName[name] = g
+	}
+	return g
+}
+
+func loadGenerics() {
+	if genericsByName != nil {
+		return
+	}
+	genericsByName = map[string]*generic{}
+	genericOf = map[dwarf.Offset]*generic{}
+	rdr := Dwarf.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 || e.Tag == dwarf.TagCompileUnit {
+			continue
+		}
+		name, _ := e.Val(dwarf.AttrName).(string)
+		base, args, ok := splitGenericName(name)
+		if !ok {
+			if e.Children {
+				rdr.SkipChildren()
+			}
+			continue
+		}
+		inst := &genericInst{Off: e.Offset, Tag: e.Tag, Name: name, Args: args}
+		if e.Tag == dwarf.TagSubprogram {
+			inst.Ranges, _ = Dwarf.Ranges(e)
+			for _, rng := range inst.Ranges {
+				inst.Size += rng[1] - rng[0]
+			}
+			for e.Children {
+				child, err := rdr.Next()
+				if err != nil || child == nil || child.Tag == 0 {
+					break
+				}
+				inst.addChild(child)
+				if child.Children {
+					rdr.SkipChildren()
+				}
+			}
+		} else {
+			if sz, ok := e.Val(dwarf.AttrByteSize).(int64); ok {
+				inst.Size = uint64(sz)
+			}
+			if e.Children {
+				rdr.SkipChildren()
+			}
+		}
+		g := genericFor(base)
+		g.Insts = append(g.Insts, inst)
+		genericOf[inst.Off] = g
+	}
+
+	seen := map[string]bool{}
+	for _, sym := range tableSymbols {
+		i := strings.Index(sym.Name, "..dict.")
+		if i < 0 || seen[sym.Name] {
+			continue
+		}
+		seen[sym.Name] = true
+		base, args, ok := splitGenericName(sym.Name[:i] + "." + sym.Name[i+len("..dict."):])
+		if !ok {
+			continue
+		}
+		d := &goDict{Sym: sym, Base: base, Args: args}
+		matched := false
+		for _, g := range genericsByName {
+			if dictBase(g.Name) != base {
+				continue
+			}
+			for _, inst := range g.Insts {
+				if inst.accepts(d) {
+					inst.Dicts = append(inst.Dicts, d)
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			g := genericFor(base)
+			g.Dicts = append(g.Dicts, d)
+		}
+	}
+
+	for _, g := range genericsByName {
+		sort.SliceStable(g.Insts, func(i, j int) bool { return g.Insts[i].Name < g.Insts[j].Name })
+		sort.Slice(g.Dicts, func(i, j int) bool { return g.Dicts[i].Sym.Name < g.Dicts[j].Sym.Name })
+		for _, inst := range g.Insts {
+			sort.Slice(inst.Dicts, func(i, j int) bool { return inst.Dicts[i].Sym.Name < inst.Dicts[j].Sym.Name })
+		}
+	}
+}
+
+func (inst *genericInst) addChild(e *dwarf.Entry) {
+	switch e.Tag {
+	case dwarf.TagTypedef:
+		idx, ok := e.Val(_DW_AT_go_dict_index).(int64)
+		if !ok {
+			return
+		}
+		p := dictParam{Index: int(idx), Off: e.Offset}
+		p.Name, _ = e.Val(dwarf.AttrName).(string)
+		p.Type, _ = e.Val(dwarf.AttrType).(dwarf.Offset)
+		rdr := Dwarf.Reader()
+		rdr.Seek(p.Type)
+		if typ, _ := rdr.Next(); typ != nil {
+			p.TypeName, _ = typ.Val(dwarf.AttrName).(string)
+			if v, ok := typ.Val(_DW_AT_go_runtime_type).(uint64); ok {
+				if gt := rtypesFor(); gt != nil {
+					p.Rtype = gt.runtimeType(v)
+				}
+			}
+		}
+		inst.Params = append(inst.Params, p)
+	case dwarf.TagFormalParameter:
+		if name, _ := e.Val(dwarf.AttrName).(string); name != ".dict" {
+			return
+		}
+		// the type of .dict is a pointer to an array of uintptr
+		rdr := Dwarf.Reader()
+		typ, _ := e.Val(dwarf.AttrType).(dwarf.Offset)
+		rdr.Seek(typ)
+		ptr, _ := rdr.Next()
+		if ptr == nil {
+			return
+		}
+		typ, _ = ptr.Val(dwarf.AttrType).(dwarf.Offset)
+		rdr.Seek(typ)
+		arr, _ := rdr.Next()
+		if arr == nil || arr.Tag != dwarf.TagArrayType || !arr.Children {
+			return
+		}
+		if sub, _ := rdr.Next(); sub != nil {
+			if n, ok := sub.Val(dwarf.AttrCount).(int64); ok {
+				inst.DictLen = int(n)
+			}
+		}
+	}
+}
+
+func (inst *genericInst) IsShape() bool {
+	return isShape(inst.Args)
+}
+
+// typeKind returns the kind of the type called name, or reflect.Invalid if
+// it is a named type.
+func typeKind(name string) reflect.Kind {
+	name = strings.TrimPrefix(name, "go.shape.")
+	for _, k := range []struct {
+		prefix string
+		kind   reflect.Kind
+	}{
+		{"[]", reflect.Slice}, {"[", reflect.Array}, {"*", reflect.Pointer}, {"map[", reflect.Map},
+		{"chan ", reflect.Chan}, {"<-chan ", reflect.Chan}, {"chan<- ", reflect.Chan}, {"func(", reflect.Func},
+		{"struct {", reflect.Struct}, {"interface {", reflect.Interface},
+	} {
+		if strings.HasPrefix(name, k.prefix) {
+			return k.kind
+		}
+	}
+	for k := reflect.Bool; k <= reflect.UnsafePointer; k++ {
+		if k.String() == name {
+			return k
+		}
+	}
+	return reflect.Invalid
+}
+
+// accepts returns true if d can be passed to inst, that is, if its type
+// arguments have the shapes of inst and the runtime type in every slot
+// referenced by a typedef of inst has the same kind as the shape type and,
+// when the runtime type of the shape is known, the same size and pointers.
+func (inst *genericInst) accepts(d *goDict) bool {
+	gt := rtypesFor()
+	if gt == nil || !inst.IsShape() || len(d.Args) != len(inst.Args) {
+		return false
+	}
+	for i, arg := range d.Args {
+		// unnamed types are their own shape
+		if typeKind(arg) != reflect.Invalid && strings.HasPrefix(inst.Args[i], "go.shape.") && inst.Args[i] != "go.shape."+arg {
+			return false
+		}
+	}
+	n := d.Len(inst)
+	for _, p := range inst.Params {
+		if p.Index < 0 || p.Index >= n {
+			return false
+		}
+		v := d.Slot(p.Index)
+		if !gt.isType(v) {
+			return false
+		}
+		t := gt.readRtype(v)
+		if k := typeKind(p.TypeName); t.Err != "" || k != reflect.Invalid && k != t.Kind() {
+			return false
+		}
+		if p.Rtype != 0 {
+			s := gt.readRtype(p.Rtype)
+			if s.Err != "" || t.Kind() != s.Kind() || t.Size != s.Size || t.PtrBytes != s.PtrBytes {
+				return false
+			}
+		}
+		if strings.HasPrefix(p.TypeName, "go.shape.") && t.TFlag&_TFlagNamed == 0 && p.TypeName != "go.shape."+t.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of slots of d, the size of dictionary symbols is
+// not known for all executable formats.
+func (d *goDict) Len(inst *genericInst) int {
+	if d.Sym.Size != 0 {
+		return int(d.Sym.Size) / Arch.PtrSize
+	}
+	if inst != nil {
+		return inst.DictLen
+	}
+	return 0
+}
+
+// Slot returns the contents of the i-th slot of d.
+func (d *goDict) Slot(i int) uint64 {
+	p := Arch.PtrSize
+	buf := readExe(d.Sym.Addr+uint64(i*p), p)
+	if buf == nil {
+		return 0
+	}
+	return (&lineBuf{data: buf, bo: Arch.ByteOrder}).uint(p)
+}
+
+func fmtDictSlot(v uint64) template.HTML {
+	if gt := rtypesFor(); gt != nil && gt.isType(v) {
+		return gt.link(v)
+	}
+	if v == 0 {
+		return "0"
+	}
+	var lup lookupper
+	name, start := lup.lookup(v)
+	switch {
+	case name == "":
+		return template.HTML(fmt.Sprintf("%#x", v))
+	case start != v:
+		return template.HTML(fmt.Sprintf("%#x %s+%#x", v, template.HTMLEscapeString(name), v-start))
+	}
+	return template.HTML(fmt.Sprintf("%#x %s", v, template.HTMLEscapeString(name)))
+}
+
+// dictRow is a slot of the dictionaries of an instantiation.
+type dictRow struct {
+	Index  int
+	Params []dictParam
+	Slots  []template.HTML
+}
+
+// maxDictSlots limits the slots shown for instantiations whose dictionary
+// length is not known.
+const maxDictSlots = 1024
+
+// dictLen returns the number of slots of the dictionaries of inst, 0 if it
+// is not known.
+func (inst *genericInst) dictLen() int {
+	n := inst.DictLen
+	for _, d := range inst.Dicts {
+		if l := d.Len(inst); l > n {
+			n = l
+		}
+	}
+	return n
+}
+
+// BadParams returns the typedefs of inst whose DW_AT_go_dict_index is
+// outside of the dictionary.
+func (inst *genericInst) BadParams() []dictParam {
+	n := inst.dictLen()
+	if n == 0 {
+		n = maxDictSlots
+	}
+	var r []dictParam
+	for _, p := range inst.Params {
+		if p.Index < 0 || p.Index >= n {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+func (inst *genericInst) DictRows() []dictRow {
+	n := inst.dictLen()
+	known := n != 0
+	for _, p := range inst.Params {
+		if !known && p.Index >= 0 && p.Index < maxDictSlots && p.Index+1 > n {
+			n = p.Index + 1
+		}
+	}
+	rows := make([]dictRow, n)
+	for i := range rows {
+		rows[i].Index = i
+		for _, d := range inst.Dicts {
+			slot := template.HTML("")
+			if i < d.Len(inst) {
+				slot = fmtDictSlot(d.Slot(i))
+			}
+			rows[i].Slots = append(rows[i].Slots, slot)
+		}
+	}
+	for _, p := range inst.Params {
+		if p.Index >= 0 && p.Index < n {
+			rows[p.Index].Params = append(rows[p.Index].Params, p)
+		}
+	}
+	return rows
+}
+
+func (d *goDict) SlotsHTML() []template.HTML {
+	var r []template.HTML
+	for i := 0; i < d.Len(nil); i++ {
+		r = append(r, fmtDictSlot(d.Slot(i)))
+	}
+	return r
+}
+
+// genericLink returns a link to the page of the generic function or type
+// that e instantiates.
+func genericLink(e *dwarf.Entry) string {
+	name, _ := e.Val(dwarf.AttrName).(string)
+	if _, _, ok := splitGenericName(name); !ok {
+		return ""
+	}
+	return fmt.Sprintf(" (<a href=\"/generic/%x\">generic</a>)", e.Offset)
+}
+
+var genericsTmpl = template.Must(template.New("generics").Parse(`<!doctype html>
+<html>
+<head>
+<title>Generic functions and types</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>Generic functions and types</h3>
+<tt><table class='dwarftbl'>
+<tr><th>Name</th><th>Instantiations</th><th>Unmatched dictionaries</th></tr>
+{{range .}}<tr><td>{{if .Insts}}<a href="/generic/{{(index .Insts 0).Off | printf "%x"}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{len .Insts}}</td><td>{{len .Dicts}}</td></tr>
+{{end}}
+</table></tt>
+</body>
+</html>
+`))
+
+func genericsHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	loadGenerics()
+	var gs []*generic
+	for _, g := range genericsByName {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].Name < gs[j].Name })
+	must(genericsTmpl.Execute(w, gs))
+}
+
+var genericTmpl = template.Must(template.New("generic").Parse(`<!doctype html>
+<html>
+<head>
+<title>Generic {{.Name}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3><a href="/generics/">Generic</a> {{.Name}}</h3>
+<tt><table class='dwarftbl'>
+<tr><th>Entry</th><th>Instantiation</th><th>Size</th><th>PC ranges</th><th>Dictionaries</th></tr>
+{{range .Insts}}<tr><td><a href="/{{.Off | printf "%x"}}">&lt;{{.Off | printf "%x"}}&gt;</a></td><td>{{.Name}}</td><td>{{.Size}}</td><td>{{range .Ranges}}{{index . 0 | printf "%#x"}}-{{index . 1 | printf "%#x"}} {{end}}</td><td>{{len .Dicts}}</td></tr>
+{{end}}
+</table></tt>
+{{range .Insts}}{{if .IsShape}}{{if or .Params .Dicts}}
+<hr/>
+<h4><a href="/{{.Off | printf "%x"}}">&lt;{{.Off | printf "%x"}}&gt;</a> {{.Name}}</h4>
+<p>Shape types: {{range $i, $x := .Args}}{{if $i}}, {{end}}{{$x}}{{end}}</p>
+{{if .DictLen}}<p>Dictionary length: {{.DictLen}}</p>{{end}}
+<tt><table class='dwarftbl'>
+<tr><th>Slot</th><th>Typedefs</th>{{range .Dicts}}<th>{{.Sym.Name}}</th>{{end}}</tr>
+{{range .DictRows}}<tr><td>{{.Index}}</td><td>{{range .Params}}<a href="/{{.Off | printf "%x"}}">{{.Name}}</a> = <a href="/{{.Type | printf "%x"}}">{{.TypeName}}</a><br/>{{end}}</td>{{range .Slots}}<td>{{.}}</td>{{end}}</tr>
+{{end}}
+</table></tt>
+{{range .BadParams}}<p><b>Typedef <a href="/{{.Off | printf "%x"}}">&lt;{{.Off | printf "%x"}}&gt;</a> {{.Name}} has dictionary index {{.Index}}, outside of the dictionary</b></p>
+{{end}}{{end}}{{end}}{{end}}
+{{range .Dicts}}
+<hr/>
+<h4>Dictionary {{.Sym.Name}} at {{.Sym.Addr | printf "%#x"}}</h4>
+{{if not .Sym.Size}}<p>The size of the dictionary is not known.</p>{{end}}
+<tt><table class='dwarftbl'>
+{{range $i, $x := .SlotsHTML}}<tr><td>{{$i}}</td><td>{{$x}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+</body>
+</html>
+`))
+
+// genericHandler shows the generic function or type instantiated by the
+// entry at the given offset.
+func genericHandler(w http.ResponseWriter, r *http.Request) {
+	off := offset(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	loadGenerics()
+	g := genericOf[off]
+	if g == nil {
+		http.NotFound(w, r)
+		return
+	}
+	must(genericTmpl.Execute(w, g))
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+// Line number program decoder, see DWARFv5 section 6.2.
+
+var DebugLine, DebugStr, DebugLineStr []byte
+
+func init() {
+	onReset(func() {
+		DebugLine, DebugStr, DebugLineStr = nil, nil, nil
+	})
+}
+
+const (
+	_DW_LNS_copy               = 0x01
+	_DW_LNS_advance_pc         = 0x02
+	_DW_LNS_advance_line       = 0x03
+	_DW_LNS_set_file           = 0x04
+	_DW_LNS_set_column         = 0x05
+	_DW_LNS_negate_stmt        = 0x06
+	_DW_LNS_set_basic_block    = 0x07
+	_DW_LNS_const_add_pc       = 0x08
+	_DW_LNS_fixed_advance_pc   = 0x09
+	_DW_LNS_set_prologue_end   = 0x0a
+	_DW_LNS_set_epilogue_begin = 0x0b
+	_DW_LNS_set_isa            = 0x0c
+
+	_DW_LNE_end_sequence      = 0x01
+	_DW_LNE_set_address       = 0x02
+	_DW_LNE_define_file       = 0x03
+	_DW_LNE_set_discriminator = 0x04
+
+	_DW_LNCT_path            = 0x1
+	_DW_LNCT_directory_index = 0x2
+	_DW_LNCT_timestamp       = 0x3
+	_DW_LNCT_size            = 0x4
+	_DW_LNCT_MD5             = 0x5
+	_DW_LNCT_LLVM_source     = 0x2001
+)
+
+var lnctNames = map[uint64]string{
+	_DW_LNCT_path:            "DW_LNCT_path",
+	_DW_LNCT_directory_index: "DW_LNCT_directory_index",
+	_DW_LNCT_timestamp:       "DW_LNCT_timestamp",
+	_DW_LNCT_size:            "DW_LNCT_size",
+	_DW_LNCT_MD5:             "DW_LNCT_MD5",
+	_DW_LNCT_LLVM_source:     "DW_LNCT_LLVM_source",
+}
+
+var formNames = map[uint64]string{
+	0x01:   "DW_FORM_addr",
+	0x03:   "DW_FORM_block2",
+	0x04:   "DW_FORM_block4",
+	0x05:   "DW_FORM_data2",
+	0x06:   "DW_FORM_data4",
+	0x07:   "DW_FORM_data8",
+	0x08:   "DW_FORM_string",
+	0x09:   "DW_FORM_block",
+	0x0a:   "DW_FORM_block1",
+	0x0b:   "DW_FORM_data1",
+	0x0c:   "DW_FORM_flag",
+	0x0d:   "DW_FORM_sdata",
+	0x0e:   "DW_FORM_strp",
+	0x0f:   "DW_FORM_udata",
+	0x10:   "DW_FORM_ref_addr",
+	0x11:   "DW_FORM_ref1",
+	0x12:   "DW_FORM_ref2",
+	0x13:   "DW_FORM_ref4",
+	0x14:   "DW_FORM_ref8",
+	0x15:   "DW_FORM_ref_udata",
+	0x16:   "DW_FORM_indirect",
+	0x17:   "DW_FORM_sec_offset",
+	0x18:   "DW_FORM_exprloc",
+	0x19:   "DW_FORM_flag_present",
+	0x1a:   "DW_FORM_strx",
+	0x1b:   "DW_FORM_addrx",
+	0x1c:   "DW_FORM_ref_sup4",
+	0x1d:   "DW_FORM_strp_sup",
+	0x1e:   "DW_FORM_data16",
+	0x1f:   "DW_FORM_line_strp",
+	0x20:   "DW_FORM_ref_sig8",
+	0x21:   "DW_FORM_implicit_const",
+	0x22:   "DW_FORM_loclistx",
+	0x23:   "DW_FORM_rnglistx",
+	0x24:   "DW_FORM_ref_sup8",
+	0x25:   "DW_FORM_strx1",
+	0x26:   "DW_FORM_strx2",
+	0x27:   "DW_FORM_strx3",
+	0x28:   "DW_FORM_strx4",
+	0x29:   "DW_FORM_addrx1",
+	0x2a:   "DW_FORM_addrx2",
+	0x2b:   "DW_FORM_addrx3",
+	0x2c:   "DW_FORM_addrx4",
+	0x1f01: "DW_FORM_GNU_addr_index",
+	0x1f02: "DW_FORM_GNU_str_index",
+	0x1f20: "DW_FORM_GNU_ref_alt",
+	0x1f21: "DW_FORM_GNU_strp_alt",
+}
+
+// lineProgram is a decoded line number program.
+type lineProgram struct {
+	Off     int
+	Unit    *dwarf.Entry
+	Length  uint64
+	Dwarf64 bool
+	Version uint16
+
+	AddressSize, SegSelectorSize uint8
+	HeaderLength                 uint64
+	MinInstLength                uint8
+	MaxOpsPerInst                uint8
+	DefaultIsStmt                bool
+	LineBase                     int8
+	LineRange                    uint8
+	OpcodeBase                   uint8
+	StdOpcodeLengths             []uint8
+
+	DirFormat, FileFormat []string // entry formats, DWARFv5 only
+	DirColumns            []string
+	FileColumns           []string
+	Dirs, Files           [][]string
+
+	Ops []lineOp
+	Err string
+
+	fileNames []string
+
+	strRefs, lineStrRefs []uint64 // offsets of the strings used by the header
+}
+
+// lineOp is an opcode of the line number program and the state of the
+// line number state machine after executing it.
+type lineOp struct {
+	Off  int
+	Text string
+	Row  lineState
+	Emit bool // a row is appended to the line table
+}
+
+type lineState struct {
+	Address                                      uint64
+	OpIndex                                      uint64
+	File, Line, Column                           uint64
+	IsStmt, BasicBlock, EndSequence, PrologueEnd bool
+	EpilogueBegin                                bool
+	ISA, Discriminator                           uint64
+}
+
+func (s lineState) Flags() string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{{s.IsStmt, "S"}, {s.BasicBlock, "B"}, {s.PrologueEnd, "P"}, {s.EpilogueBegin, "E"}, {s.EndSequence, "end"}} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// lineBuf reads the contents of .debug_line, reading past the end of the
+// data returns zeroes and sets eof.
+type lineBuf struct {
+	data []byte
+	off  int
+	bo   binary.ByteOrder
+	eof  bool
+}
+
+func (b *lineBuf) bytes(n int) []byte {
+	if n < 0 || b.off+n > len(b.data) {
+		b.eof = true
+		b.off = len(b.data)
+		return make([]byte, 16)
+	}
+	r := b.data[b.off : b.off+n]
+	b.off += n
+	return r
+}
+
+func (b *lineBuf) u8() uint8   { return b.bytes(1)[0] }
+func (b *lineBuf) u16() uint16 { return b.bo.Uint16(b.bytes(2)) }
+func (b *lineBuf) u32() uint32 { return b.bo.Uint32(b.bytes(4)) }
+func (b *lineBuf) u64() uint64 { return b.bo.Uint64(b.bytes(8)) }
+
+func (b *lineBuf) uint(sz int) uint64 {
+	switch sz {
+	case 1:
+		return uint64(b.u8())
+	case 2:
+		return uint64(b.u16())
+	case 3:
+		x := b.bytes(3)
+		if b.bo == binary.BigEndian {
+			return uint64(x[0])<<16 | uint64(x[1])<<8 | uint64(x[2])
+		}
+		return uint64(x[2])<<16 | uint64(x[1])<<8 | uint64(x[0])
+	case 4:
+		return uint64(b.u32())
+	default:
+		return b.u64()
+	}
+}
+
+func (b *lineBuf) uleb() uint64 {
+	if b.off >= len(b.data) {
+		b.eof = true
+		return 0
+	}
+	buf := bytes.NewBuffer(b.data[b.off:])
+	v, n := leb128.DecodeUnsigned(buf)
+	b.off += int(n)
+	return v
+}
+
+func (b *lineBuf) sleb() int64 {
+	if b.off >= len(b.data) {
+		b.eof = true
+		return 0
+	}
+	buf := bytes.NewBuffer(b.data[b.off:])
+	v, n := leb128.DecodeSigned(buf)
+	b.off += int(n)
+	return v
+}
+
+func (b *lineBuf) cstr() string {
+	i := bytes.IndexByte(b.data[b.off:], 0)
+	if i < 0 {
+		b.eof = true
+		b.off = len(b.data)
+		return ""
+	}
+	s := string(b.data[b.off : b.off+i])
+	b.off += i + 1
+	return s
+}
+
+func cstrAt(data []byte, off uint64) string {
+	if off >= uint64(len(data)) {
+		return fmt.Sprintf("<bad offset %#x>", off)
+	}
+	s := data[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// stmtListOffset returns the offset in .debug_line of the line number
+// program of the compile unit cu, split units use the one of their skeleton.
+func stmtListOffset(cu *dwarf.Entry) (int64, bool) {
+	if su := Dwarf.splitFor(cu.Offset); su != nil {
+		cu = su.Skeleton
+	}
+	off, ok := cu.Val(dwarf.AttrStmtList).(int64)
+	return off, ok
+}
+
+// readLineProgram decodes the line number program at offset off of
+// .debug_line.
+func readLineProgram(off int64, cu *dwarf.Entry) *lineProgram {
+	lp := &lineProgram{Off: int(off), Unit: cu}
+	if off < 0 || off >= int64(len(DebugLine)) {
+		lp.Err = fmt.Sprintf("offset %#x outside of .debug_line", off)
+		return lp
+	}
+
+	var byteOrder binary.ByteOrder
+	lp.Length, lp.Dwarf64, _, byteOrder = readDwarfLengthVersion(DebugLine[off:])
+	b := &lineBuf{data: DebugLine, off: int(off) + 4, bo: byteOrder}
+	offsz := 4
+	if lp.Dwarf64 {
+		b.off += 8
+		offsz = 8
+	}
+	end := b.off + int(lp.Length)
+	if end > len(DebugLine) || end < b.off {
+		lp.Err = fmt.Sprintf("unit length %#x past the end of .debug_line", lp.Length)
+		end = len(DebugLine)
+	}
+	b.data = DebugLine[:end]
+
+	lp.Version = b.u16()
+	lp.AddressSize = uint8(Arch.PtrSize)
+	if lp.Version >= 5 {
+		lp.AddressSize = b.u8()
+		lp.SegSelectorSize = b.u8()
+	}
+	lp.HeaderLength = b.uint(offsz)
+	progStart := b.off + int(lp.HeaderLength)
+	lp.MinInstLength = b.u8()
+	lp.MaxOpsPerInst = 1
+	if lp.Version >= 4 {
+		lp.MaxOpsPerInst = b.u8()
+	}
+	lp.DefaultIsStmt = b.u8() != 0
+	lp.LineBase = int8(b.u8())
+	lp.LineRange = b.u8()
+	lp.OpcodeBase = b.u8()
+	for i := 1; i < int(lp.OpcodeBase); i++ {
+		lp.StdOpcodeLengths = append(lp.StdOpcodeLengths, b.u8())
+	}
+
+	if lp.Version >= 5 {
+		lp.DirColumns, lp.Dirs = lp.readEntryTable(b, offsz, &lp.DirFormat)
+		lp.FileColumns, lp.Files = lp.readEntryTable(b, offsz, &lp.FileFormat)
+		for _, file := range lp.Files {
+			lp.fileNames = append(lp.fileNames, lp.entryPath(lp.FileColumns, file))
+		}
+	} else {
+		lp.DirColumns = []string{"Name"}
+		lp.Dirs = [][]string{{"(compilation directory)"}}
+		for {
+			dir := b.cstr()
+			if dir == "" || b.eof {
+				break
+			}
+			lp.Dirs = append(lp.Dirs, []string{dir})
+		}
+		lp.FileColumns = []string{"Name", "Directory", "Modification time", "Length"}
+		lp.fileNames = []string{"(none)"}
+		lp.Files = [][]string{{"(none)", "", "", ""}}
+		for {
+			name := b.cstr()
+			if name == "" || b.eof {
+				break
+			}
+			lp.addFile(name, b.uleb(), b.uleb(), b.uleb())
+		}
+	}
+
+	if b.eof {
+		lp.Err = "header truncated"
+		return lp
+	}
+	if b.off != progStart {
+		lp.Err = fmt.Sprintf("header_length says the program starts at %#x but the header ends at %#x", progStart, b.off)
+		b.off = progStart
+	}
+
+	lp.run(b)
+	return lp
+}
+
+func (lp *lineProgram) addFile(name string, dir, mtime, length uint64) {
+	lp.Files = append(lp.Files, []string{name, fmt.Sprint(dir), fmt.Sprint(mtime), fmt.Sprint(length)})
+	lp.fileNames = append(lp.fileNames, name)
+}
+
+// readEntryTable reads a DWARFv5 directory or file name table.
+func (lp *lineProgram) readEntryTable(b *lineBuf, offsz int, formatNames *[]string) ([]string, [][]string) {
+	type format struct{ lnct, form uint64 }
+	formats := make([]format, b.u8())
+	columns := make([]string, len(formats))
+	for i := range formats {
+		formats[i] = format{b.uleb(), b.uleb()}
+		columns[i] = lnctNames[formats[i].lnct]
+		if columns[i] == "" {
+			columns[i] = fmt.Sprintf("DW_LNCT_%#x", formats[i].lnct)
+		}
+		form := formNames[formats[i].form]
+		if form == "" {
+			form = fmt.Sprintf("DW_FORM_%#x", formats[i].form)
+		}
+		*formatNames = append(*formatNames, columns[i]+" "+form)
+	}
+
+	n := b.uleb()
+	var entries [][]string
+	for i := uint64(0); i < n && !b.eof; i++ {
+		entry := make([]string, len(formats))
+		for j, f := range formats {
+			switch f.form {
+			case 0x08: // DW_FORM_string
+				entry[j] = b.cstr()
+			case 0x0e: // DW_FORM_strp
+				off := b.uint(offsz)
+				lp.strRefs = append(lp.strRefs, off)
+				entry[j] = cstrAt(DebugStr, off)
+			case 0x1f: // DW_FORM_line_strp
+				off := b.uint(offsz)
+				lp.lineStrRefs = append(lp.lineStrRefs, off)
+				entry[j] = cstrAt(DebugLineStr, off)
+			case 0x1a: // DW_FORM_strx
+				entry[j] = fmt.Sprintf("strx %d", b.uleb())
+			case 0x25, 0x26, 0x27, 0x28: // DW_FORM_strx1-4
+				entry[j] = fmt.Sprintf("strx %d", b.uint(int(f.form-0x24)))
+			case 0x0b, 0x05, 0x06, 0x07: // DW_FORM_data1, 2, 4, 8
+				entry[j] = fmt.Sprint(b.uint(map[uint64]int{0x0b: 1, 0x05: 2, 0x06: 4, 0x07: 8}[f.form]))
+			case 0x0f: // DW_FORM_udata
+				entry[j] = fmt.Sprint(b.uleb())
+			case 0x1e: // DW_FORM_data16
+				entry[j] = fmt.Sprintf("%x", b.bytes(16))
+			case 0x09: // DW_FORM_block
+				entry[j] = fmt.Sprintf("%x", b.bytes(int(b.uleb())))
+			default:
+				entry[j] = "?"
+				b.eof = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return columns, entries
+}
+
+// entryPath returns the path of a DWARFv5 file entry, joined to its
+// directory.
+func (lp *lineProgram) entryPath(columns []string, entry []string) string {
+	var name, dir string
+	for i, col := range columns {
+		switch col {
+		case "DW_LNCT_path":
+			name = entry[i]
+		case "DW_LNCT_directory_index":
+			dir = entry[i]
+		}
+	}
+	var idx int
+	if _, err := fmt.Sscan(dir, &idx); err == nil && idx < len(lp.Dirs) && !filepath.IsAbs(name) {
+		if d := lp.entryPath(lp.DirColumns, lp.Dirs[idx]); d != "" {
+			name = filepath.Join(d, name)
+		}
+	}
+	return name
+}
+
+// run executes the line number program, recording every opcode.
+func (lp *lineProgram) run(b *lineBuf) {
+	var st lineState
+	reset := func() {
+		st = lineState{File: 1, Line: 1, IsStmt: lp.DefaultIsStmt}
+	}
+	reset()
+	if lp.LineRange == 0 {
+		lp.Err = "line_range is zero"
+		return
+	}
+	maxOps := uint64(lp.MaxOpsPerInst)
+	if maxOps == 0 {
+		maxOps = 1
+	}
+	advance := func(opAdvance uint64) uint64 {
+		addrAdvance := uint64(lp.MinInstLength) * ((st.OpIndex + opAdvance) / maxOps)
+		st.Address += addrAdvance
+		st.OpIndex = (st.OpIndex + opAdvance) % maxOps
+		return addrAdvance
+	}
+
+	for b.off < len(b.data) && !b.eof {
+		op := lineOp{Off: b.off}
+		opcode := b.u8()
+		switch {
+		case opcode >= lp.OpcodeBase:
+			adj := uint64(opcode - lp.OpcodeBase)
+			addrAdvance := advance(adj / uint64(lp.LineRange))
+			lineAdvance := int64(lp.LineBase) + int64(adj%uint64(lp.LineRange))
+			st.Line += uint64(lineAdvance)
+			op.Text = fmt.Sprintf("Special opcode %d: advance address by %d, advance line by %d", adj, addrAdvance, lineAdvance)
+			op.Emit = true
+		case opcode == 0:
+			n := b.uleb()
+			end := b.off + int(n)
+			if n == 0 {
+				op.Text = "Extended opcode with length 0"
+				break
+			}
+			sub := b.u8()
+			switch sub {
+			case _DW_LNE_end_sequence:
+				st.EndSequence = true
+				op.Text = "DW_LNE_end_sequence"
+				op.Emit = true
+			case _DW_LNE_set_address:
+				st.Address = b.uint(int(n - 1))
+				st.OpIndex = 0
+				op.Text = fmt.Sprintf("DW_LNE_set_address %#x", st.Address)
+			case _DW_LNE_define_file:
+				name := b.cstr()
+				lp.addFile(name, b.uleb(), b.uleb(), b.uleb())
+				op.Text = fmt.Sprintf("DW_LNE_define_file %q", name)
+			case _DW_LNE_set_discriminator:
+				st.Discriminator = b.uleb()
+				op.Text = fmt.Sprintf("DW_LNE_set_discriminator %d", st.Discriminator)
+			default:
+				op.Text = fmt.Sprintf("Unknown extended opcode %#x, length %d", sub, n)
+			}
+			if b.off != end && !b.eof {
+				op.Text += fmt.Sprintf(" (length %d does not match the operands)", n)
+			}
+			b.off = end
+		default:
+			switch opcode {
+			case _DW_LNS_copy:
+				op.Text = "DW_LNS_copy"
+				op.Emit = true
+			case _DW_LNS_advance_pc:
+				op.Text = fmt.Sprintf("DW_LNS_advance_pc %d", advance(b.uleb()))
+			case _DW_LNS_advance_line:
+				n := b.sleb()
+				st.Line += uint64(n)
+				op.Text = fmt.Sprintf("DW_LNS_advance_line %d", n)
+			case _DW_LNS_set_file:
+				st.File = b.uleb()
+				op.Text = fmt.Sprintf("DW_LNS_set_file %d", st.File)
+			case _DW_LNS_set_column:
+				st.Column = b.uleb()
+				op.Text = fmt.Sprintf("DW_LNS_set_column %d", st.Column)
+			case _DW_LNS_negate_stmt:
+				st.IsStmt = !st.IsStmt
+				op.Text = "DW_LNS_negate_stmt"
+			case _DW_LNS_set_basic_block:
+				st.BasicBlock = true
+				op.Text = "DW_LNS_set_basic_block"
+			case _DW_LNS_const_add_pc:
+				op.Text = fmt.Sprintf("DW_LNS_const_add_pc %d", advance(uint64(255-lp.OpcodeBase)/uint64(lp.LineRange)))
+			case _DW_LNS_fixed_advance_pc:
+				n := b.u16()
+				st.Address += uint64(n)
+				st.OpIndex = 0
+				op.Text = fmt.Sprintf("DW_LNS_fixed_advance_pc %d", n)
+			case _DW_LNS_set_prologue_end:
+				st.PrologueEnd = true
+				op.Text = "DW_LNS_set_prologue_end"
+			case _DW_LNS_set_epilogue_begin:
+				st.EpilogueBegin = true
+				op.Text = "DW_LNS_set_epilogue_begin"
+			case _DW_LNS_set_isa:
+				st.ISA = b.uleb()
+				op.Text = fmt.Sprintf("DW_LNS_set_isa %d", st.ISA)
+			default:
+				// unknown standard opcode, skip its operands
+				args := make([]string, lp.StdOpcodeLengths[opcode-1])
+				for i := range args {
+					args[i] = fmt.Sprint(b.uleb())
+				}
+				op.Text = fmt.Sprintf("Unknown standard opcode %d %s", opcode, strings.Join(args, " "))
+			}
+		}
+		if b.eof {
+			op.Text += " (truncated)"
+		}
+		op.Row = st
+		lp.Ops = append(lp.Ops, op)
+		if op.Emit {
+			st.BasicBlock, st.PrologueEnd, st.EpilogueBegin, st.Discriminator = false, false, false, 0
+			if st.EndSequence {
+				reset()
+			}
+		}
+	}
+}
+
+// FileName returns the name of the file with index i in the file table.
+func (lp *lineProgram) FileName(i uint64) string {
+	if i < uint64(len(lp.fileNames)) {
+		return filepath.Base(lp.fileNames[i])
+	}
+	return "?"
+}
+
+// DisassemblyLink returns a link to the disassembly of the function
+// containing pc.
+func (lp *lineProgram) DisassemblyLink(pc uint64) string {
+	var lup lookupper
+	lup.lookup(pc)
+	if lup.sym == nil || !lup.sym.HasDIE() {
+		return ""
+	}
+	return fmt.Sprintf("/disassemble/%x#pc%x", lup.sym.Off, pc)
+}
+
+var lineProgramTmpl = template.Must(template.New("line").Funcs(funcMap).Parse(`<!doctype html>
+<html>
+<head>
+<title>Line number program at {{.Off | printf "%#x"}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+	.emit {
+		font-weight: bold;
+	}
+</style>
+</head>
+<body>
+<h3>Line number program at {{.Off | printf "%#x"}}{{with .Unit}} for <a href="/{{.Offset | printf "%x"}}">&lt;{{.Offset | printf "%x"}}&gt;</a>{{end}}</h3>
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<table class='dwarftbl'>
+<tr><td>Unit length</td><td>{{.Length}}{{if .Dwarf64}} (64-bit DWARF){{end}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+{{if ge .Version 5}}
+<tr><td>Address size</td><td>{{.AddressSize}}</td></tr>
+<tr><td>Segment selector size</td><td>{{.SegSelectorSize}}</td></tr>
+{{end}}
+<tr><td>Header length</td><td>{{.HeaderLength}}</td></tr>
+<tr><td>Minimum instruction length</td><td>{{.MinInstLength}}</td></tr>
+<tr><td>Maximum operations per instruction</td><td>{{.MaxOpsPerInst}}</td></tr>
+<tr><td>Default is_stmt</td><td>{{.DefaultIsStmt}}</td></tr>
+<tr><td>Line base</td><td>{{.LineBase}}</td></tr>
+<tr><td>Line range</td><td>{{.LineRange}}</td></tr>
+<tr><td>Opcode base</td><td>{{.OpcodeBase}}</td></tr>
+<tr><td>Standard opcode lengths</td><td>{{range $i, $n := .StdOpcodeLengths}}{{if $i}}, {{end}}{{$n}}{{end}}</td></tr>
+{{with .DirFormat}}<tr><td>Directory entry format</td><td>{{range .}}{{.}}<br>{{end}}</td></tr>{{end}}
+{{with .FileFormat}}<tr><td>File name entry format</td><td>{{range .}}{{.}}<br>{{end}}</td></tr>{{end}}
+</table>
+
+<h3>Directories</h3>
+<table class='dwarftbl'>
+<tr><th>#</th>{{range .DirColumns}}<th>{{.}}</th>{{end}}</tr>
+{{range $i, $e := .Dirs}}<tr><td>{{$i}}</td>{{range $e}}<td><tt>{{.}}</tt></td>{{end}}</tr>
+{{end}}
+</table>
+
+<h3>Files</h3>
+<table class='dwarftbl'>
+<tr><th>#</th>{{range .FileColumns}}<th>{{.}}</th>{{end}}</tr>
+{{range $i, $e := .Files}}<tr><td>{{$i}}</td>{{range $e}}<td><tt>{{.}}</tt></td>{{end}}</tr>
+{{end}}
+</table>
+
+<h3>Program</h3>
+<tt><table class='dwarftbl'>
+<tr><th>Offset</th><th>Opcode</th><th>Address</th><th>Op index</th><th>File</th><th>Line</th><th>Column</th><th>Flags</th><th>ISA</th><th>Discriminator</th></tr>
+{{$lp := .}}
+{{range .Ops}}
+<tr{{if .Emit}} class='emit'{{end}}>
+<td>{{.Off | printf "%#x"}}</td>
+<td>{{.Text}}</td>
+{{$addr := .Row.Address | printf "%#x"}}
+<td>{{with $lp.DisassemblyLink .Row.Address}}<a href="{{.}}">{{$addr}}</a>{{else}}{{$addr}}{{end}}</td>
+<td>{{.Row.OpIndex}}</td>
+<td>{{.Row.File}} ({{$lp.FileName .Row.File}})</td>
+<td>{{.Row.Line}}</td>
+<td>{{.Row.Column}}</td>
+<td>{{.Row.Flags}}</td>
+<td>{{.Row.ISA}}</td>
+<td>{{.Row.Discriminator}}</td>
+</tr>
+{{end}}
+</table></tt>
+<p>Rows in bold are appended to the line table. Flags: S - is_stmt, B - basic_block, P - prologue_end, E - epilogue_begin, end - end_sequence</p>
+</body>
+</html>
+`))
+
+func lineHandler(w http.ResponseWriter, r *http.Request) {
+	off := offset(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rdr := Dwarf.Reader()
+	rdr.Seek(off)
+	cu, err := rdr.Next()
+	must(err)
+	if cu == nil || cu.Tag != dwarf.TagCompileUnit && cu.Tag != dwarf.TagSkeletonUnit && cu.Tag != dwarf.TagPartialUnit {
+		http.NotFound(w, r)
+		return
+	}
+	stmtList, ok := stmtListOffset(cu)
+	if !ok {
+		fmt.Fprintf(w, "<!doctype html>\n<html><body>Compile unit <a href=\"/%x\">&lt;%x&gt;</a> has no line number program</body></html>\n", cu.Offset, cu.Offset)
+		return
+	}
+	must(lineProgramTmpl.Execute(w, readLineProgram(stmtList, cu)))
+}
@@ -47,13 +47,13 @@ func (rdr *loclistReader2) read(sz int) []byte {
 func (rdr *loclistReader2) oneAddr() uint64 {
 	switch rdr.ptrSz {
 	case 4:
-		addr := binary.LittleEndian.Uint32(rdr.read(rdr.ptrSz))
+		addr := Arch.ByteOrder.Uint32(rdr.read(rdr.ptrSz))
 		if addr == ^uint32(0) {
 			return ^uint64(0)
 		}
 		return uint64(addr)
 	case 8:
-		addr := uint64(binary.LittleEndian.Uint64(rdr.read(rdr.ptrSz)))
+		addr := Arch.ByteOrder.Uint64(rdr.read(rdr.ptrSz))
 		return addr
 	default:
 		panic("bad address size")
@@ -81,7 +81,7 @@ func (rdr *loclistReader2) Next(e *loclistEntry) bool {
 	e.highpc += rdr.base
 	e.isrange = true
 
-	instrlen := binary.LittleEndian.Uint16(rdr.read(2))
+	instrlen := Arch.ByteOrder.Uint16(rdr.read(2))
 	e.instr = rdr.read(int(instrlen))
 	return true
 }
@@ -93,7 +93,7 @@ type loclistSection5 struct {
 }
 
 func newLoclistSection5(data []byte, ptrsz int) *loclistSection5 {
-	return &loclistSection5{byteOrder: binary.LittleEndian, ptrSz: ptrsz, data: data}
+	return &loclistSection5{byteOrder: Arch.ByteOrder, ptrSz: ptrsz, data: data}
 }
 
 func (sec *loclistSection5) ReaderFor(base uint64, debugAddr *godwarf.DebugAddr) *loclistReader5 {
@@ -113,7 +113,12 @@ type loclistReader5 struct {
 }
 
 func (rdr *loclistReader5) Seek(off int) {
-	rdr.buf.Next(off)
+	if off > len(rdr.sec.data) {
+		off = len(rdr.sec.data)
+	}
+	rdr.buf = bytes.NewBuffer(rdr.sec.data[off:])
+	rdr.atEnd = false
+	rdr.err = nil
 }
 
 const (
@@ -157,7 +162,7 @@ again:
 	case _DW_LLE_startx_endx:
 		startIdx, _ := leb128.DecodeUnsigned(rdr.buf)
 		endIdx, _ := leb128.DecodeUnsigned(rdr.buf)
-		rdr.readInstr()
+		rdr.readInstr(le)
 
 		le.lowpc, rdr.err = rdr.debugAddr.Get(startIdx)
 		if rdr.err == nil {
@@ -171,7 +176,7 @@ again:
 	case _DW_LLE_startx_length:
 		startIdx, _ := leb128.DecodeUnsigned(rdr.buf)
 		length, _ := leb128.DecodeUnsigned(rdr.buf)
-		rdr.readInstr()
+		rdr.readInstr(le)
 
 		le.lowpc, rdr.err = rdr.debugAddr.Get(startIdx)
 		le.highpc = le.lowpc + length
@@ -182,7 +187,7 @@ again:
 	case _DW_LLE_offset_pair:
 		le.lowpc, _ = leb128.DecodeUnsigned(rdr.buf)
 		le.highpc, _ = leb128.DecodeUnsigned(rdr.buf)
-		rdr.readInstr()
+		rdr.readInstr(le)
 
 		le.lowpc += rdr.base
 		le.highpc += rdr.base
@@ -191,7 +196,7 @@ again:
 		return true
 
 	case _DW_LLE_default_location:
-		rdr.readInstr()
+		rdr.readInstr(le)
 		rdr.defaultInstr = rdr.instr
 		le.s = "DW_LLE_default_location"
 		goto again
@@ -204,7 +209,7 @@ again:
 	case _DW_LLE_start_end:
 		le.lowpc, rdr.err = dwarf.ReadUintRaw(rdr.buf, rdr.sec.byteOrder, rdr.sec.ptrSz)
 		le.highpc, rdr.err = dwarf.ReadUintRaw(rdr.buf, rdr.sec.byteOrder, rdr.sec.ptrSz)
-		rdr.readInstr()
+		rdr.readInstr(le)
 		le.isrange = true
 		le.s = "DW_LLE_start_end"
 		return true
@@ -212,7 +217,7 @@ again:
 	case _DW_LLE_start_length:
 		le.lowpc, rdr.err = dwarf.ReadUintRaw(rdr.buf, rdr.sec.byteOrder, rdr.sec.ptrSz)
 		length, _ := leb128.DecodeUnsigned(rdr.buf)
-		rdr.readInstr()
+		rdr.readInstr(le)
 		le.highpc = le.lowpc + length
 		le.isrange = true
 		le.s = "DW_LLE_start_length"
@@ -223,11 +228,81 @@ again:
 		rdr.atEnd = true
 		return false
 	}
-
-	return true
 }
 
-func (rdr *loclistReader5) readInstr() {
+func (rdr *loclistReader5) readInstr(le *loclistEntry) {
 	length, _ := leb128.DecodeUnsigned(rdr.buf)
 	rdr.instr = rdr.buf.Next(int(length))
+	le.instr = rdr.instr
+}
+
+// loclistReaderGNU reads the location lists of pre-standard split units,
+// stored in .debug_loc.dwo, see https://gcc.gnu.org/wiki/DebugFission.
+type loclistReaderGNU struct {
+	data      []byte
+	cur       int
+	debugAddr *godwarf.DebugAddr
+	base      uint64
+}
+
+const (
+	_DW_LLE_GNU_end_of_list_entry            uint8 = 0x0
+	_DW_LLE_GNU_base_address_selection_entry uint8 = 0x1
+	_DW_LLE_GNU_start_end_entry              uint8 = 0x2
+	_DW_LLE_GNU_start_length_entry           uint8 = 0x3
+)
+
+func (rdr *loclistReaderGNU) Seek(off int) {
+	rdr.cur = off
+}
+
+func (rdr *loclistReaderGNU) Next(e *loclistEntry) bool {
+	if rdr.cur >= len(rdr.data) {
+		return false
+	}
+	*e = loclistEntry{}
+	e.seek = rdr.cur
+	buf := bytes.NewBuffer(rdr.data[rdr.cur:])
+	defer func() {
+		rdr.cur = len(rdr.data) - buf.Len()
+	}()
+
+	opcode, _ := buf.ReadByte()
+	switch opcode {
+	case _DW_LLE_GNU_end_of_list_entry:
+		return false
+
+	case _DW_LLE_GNU_base_address_selection_entry:
+		idx, _ := leb128.DecodeUnsigned(buf)
+		rdr.base, _ = rdr.debugAddr.Get(idx)
+		e.s = fmt.Sprintf("Base address: %#x", rdr.base)
+		return true
+
+	case _DW_LLE_GNU_start_end_entry:
+		startIdx, _ := leb128.DecodeUnsigned(buf)
+		endIdx, _ := leb128.DecodeUnsigned(buf)
+		e.lowpc, _ = rdr.debugAddr.Get(startIdx)
+		e.highpc, _ = rdr.debugAddr.Get(endIdx)
+		e.s = "DW_LLE_GNU_start_end_entry"
+
+	case _DW_LLE_GNU_start_length_entry:
+		startIdx, _ := leb128.DecodeUnsigned(buf)
+		e.lowpc, _ = rdr.debugAddr.Get(startIdx)
+		if buf.Len() < 4 {
+			return false
+		}
+		e.highpc = e.lowpc + uint64(Arch.ByteOrder.Uint32(buf.Next(4)))
+		e.s = "DW_LLE_GNU_start_length_entry"
+
+	default:
+		return false
+	}
+
+	if buf.Len() < 2 {
+		return false
+	}
+	instrlen := Arch.ByteOrder.Uint16(buf.Next(2))
+	e.instr = buf.Next(int(instrlen))
+	e.isrange = true
+	return true
 }
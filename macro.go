@@ -0,0 +1,346 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Macro information, see DWARFv5 section 6.3. Units of .debug_macro with
+// version 4 use the GNU extension that was later standardized, whose
+// opcodes up to DW_MACRO_import have the same encoding. Compile units
+// produced with -gstrict-dwarf use .debug_macinfo, see DWARFv4 section 6.3.
+
+var DebugMacro, DebugMacinfo, DebugStrOffsets []byte
+
+func init() {
+	onReset(func() {
+		DebugMacro, DebugMacinfo, DebugStrOffsets = nil, nil, nil
+	})
+}
+
+const _DW_AT_GNU_macros = 0x2119
+
+const (
+	_DW_MACRO_define = 0x01 + iota
+	_DW_MACRO_undef
+	_DW_MACRO_start_file
+	_DW_MACRO_end_file
+	_DW_MACRO_define_strp
+	_DW_MACRO_undef_strp
+	_DW_MACRO_import
+	_DW_MACRO_define_sup
+	_DW_MACRO_undef_sup
+	_DW_MACRO_import_sup
+	_DW_MACRO_define_strx
+	_DW_MACRO_undef_strx
+)
+
+const _DW_MACINFO_vendor_ext = 0xff
+
+var macroOpNames = map[uint8]string{
+	_DW_MACRO_define:       "DW_MACRO_define",
+	_DW_MACRO_undef:        "DW_MACRO_undef",
+	_DW_MACRO_start_file:   "DW_MACRO_start_file",
+	_DW_MACRO_end_file:     "DW_MACRO_end_file",
+	_DW_MACRO_define_strp:  "DW_MACRO_define_strp",
+	_DW_MACRO_undef_strp:   "DW_MACRO_undef_strp",
+	_DW_MACRO_import:       "DW_MACRO_import",
+	_DW_MACRO_define_sup:   "DW_MACRO_define_sup",
+	_DW_MACRO_undef_sup:    "DW_MACRO_undef_sup",
+	_DW_MACRO_import_sup:   "DW_MACRO_import_sup",
+	_DW_MACRO_define_strx:  "DW_MACRO_define_strx",
+	_DW_MACRO_undef_strx:   "DW_MACRO_undef_strx",
+	_DW_MACINFO_vendor_ext: "DW_MACINFO_vendor_ext",
+}
+
+// macroSection is the macro section used by a compile unit and the
+// sections needed to decode it.
+type macroSection struct {
+	Name       string
+	data       []byte
+	macinfo    bool
+	str        []byte
+	strOffsets []byte // starting at the base of the compile unit
+	files      []string
+}
+
+type macroUnit struct {
+	Off     int
+	Unit    *dwarf.Entry
+	Section string
+	Version uint16
+	Flags   uint8
+	Dwarf64 bool
+	LineOff int64 // -1 if the header does not have debug_line_offset
+	Ops     []*macroOp
+	Err     string
+}
+
+type macroOp struct {
+	Off    int
+	Name   string
+	Line   uint64
+	Text   string
+	Import int64 // offset of the imported unit or -1
+	Childs []*macroOp
+}
+
+// macroSectionFor returns the macro section of cu and the offset of its
+// macro unit.
+func macroSectionFor(cu *dwarf.Entry) (*macroSection, int64, bool) {
+	ms := &macroSection{Name: ".debug_macro", data: DebugMacro, str: DebugStr}
+	su := Dwarf.splitFor(cu.Offset)
+	if su != nil {
+		ms = &macroSection{Name: ".debug_macro.dwo", data: su.macro, str: su.str, strOffsets: su.strOffsets}
+	} else if base, ok := cu.Val(dwarf.AttrStrOffsetsBase).(int64); ok && base >= 0 && base <= int64(len(DebugStrOffsets)) {
+		ms.strOffsets = DebugStrOffsets[base:]
+	}
+	if stmtList, ok := stmtListOffset(cu); ok {
+		ms.files = readLineProgram(stmtList, cu).fileNames
+	}
+	for _, attr := range []dwarf.Attr{dwarf.AttrMacros, _DW_AT_GNU_macros} {
+		if off, ok := cu.Val(attr).(int64); ok {
+			return ms, off, true
+		}
+	}
+	if off, ok := cu.Val(dwarf.AttrMacroInfo).(int64); ok {
+		ms.Name, ms.data, ms.macinfo = ".debug_macinfo", DebugMacinfo, true
+		if su != nil {
+			ms.Name, ms.data = ".debug_macinfo.dwo", su.macinfo
+		}
+		return ms, off, true
+	}
+	return nil, 0, false
+}
+
+func (ms *macroSection) fileName(i uint64) string {
+	if i < uint64(len(ms.files)) {
+		return fmt.Sprintf("%d (%s)", i, ms.files[i])
+	}
+	return fmt.Sprint(i)
+}
+
+func (ms *macroSection) strx(i uint64, offsz int) string {
+	if i >= uint64(len(ms.strOffsets)/offsz) {
+		return fmt.Sprintf("(string index %d out of range)", i)
+	}
+	b := &lineBuf{data: ms.strOffsets, off: int(i) * offsz, bo: Arch.ByteOrder}
+	return cstrAt(ms.str, b.uint(offsz))
+}
+
+// readMacroUnit decodes the macro unit at off.
+func (ms *macroSection) readMacroUnit(off int64, cu *dwarf.Entry) *macroUnit {
+	m := &macroUnit{Off: int(off), Unit: cu, Section: ms.Name, LineOff: -1}
+	if off < 0 || off >= int64(len(ms.data)) {
+		m.Err = fmt.Sprintf("offset %#x outside of %s", off, ms.Name)
+		return m
+	}
+	b := &lineBuf{data: ms.data, off: int(off), bo: Arch.ByteOrder}
+	if ms.macinfo {
+		ms.readOps(m, b, 4, nil)
+		return m
+	}
+
+	m.Version = b.u16()
+	m.Flags = b.u8()
+	offsz := 4
+	if m.Flags&1 != 0 {
+		m.Dwarf64 = true
+		offsz = 8
+	}
+	if m.Flags&2 != 0 {
+		m.LineOff = int64(b.uint(offsz))
+	}
+	var operands map[uint8][]byte
+	if m.Flags&4 != 0 {
+		operands = map[uint8][]byte{}
+		for n := b.u8(); n > 0 && !b.eof; n-- {
+			opcode := b.u8()
+			operands[opcode] = b.bytes(int(b.uleb()))
+		}
+	}
+	if b.eof {
+		m.Err = "header truncated"
+		return m
+	}
+	ms.readOps(m, b, offsz, operands)
+	return m
+}
+
+func (ms *macroSection) readOps(m *macroUnit, b *lineBuf, offsz int, operands map[uint8][]byte) {
+	var stack [][]*macroOp
+	ops := []*macroOp{}
+	for {
+		op := &macroOp{Off: b.off, Import: -1}
+		opcode := b.u8()
+		if b.eof {
+			m.Err = "missing end of unit"
+			break
+		}
+		if opcode == 0 {
+			break
+		}
+		op.Name = macroOpNames[opcode]
+		switch {
+		case opcode == _DW_MACRO_define || opcode == _DW_MACRO_undef:
+			op.Line = b.uleb()
+			op.Text = b.cstr()
+		case opcode == _DW_MACRO_start_file:
+			op.Line = b.uleb()
+			op.Text = ms.fileName(b.uleb())
+		case opcode == _DW_MACRO_end_file:
+		case ms.macinfo && opcode == _DW_MACINFO_vendor_ext:
+			op.Line = b.uleb()
+			op.Text = b.cstr()
+		case ms.macinfo:
+			m.Err = fmt.Sprintf("unknown macinfo type %#x at %#x", opcode, op.Off)
+		case opcode == _DW_MACRO_define_strp || opcode == _DW_MACRO_undef_strp:
+			op.Line = b.uleb()
+			op.Text = cstrAt(ms.str, b.uint(offsz))
+		case opcode == _DW_MACRO_define_sup || opcode == _DW_MACRO_undef_sup:
+			op.Line = b.uleb()
+			op.Text = fmt.Sprintf("(offset %#x in the supplementary file)", b.uint(offsz))
+		case opcode == _DW_MACRO_import:
+			op.Import = int64(b.uint(offsz))
+		case opcode == _DW_MACRO_import_sup:
+			op.Text = fmt.Sprintf("(offset %#x in the supplementary file)", b.uint(offsz))
+		case opcode == _DW_MACRO_define_strx || opcode == _DW_MACRO_undef_strx:
+			op.Line = b.uleb()
+			op.Text = ms.strx(b.uleb(), offsz)
+		default:
+			forms, ok := operands[opcode]
+			if !ok {
+				m.Err = fmt.Sprintf("unknown opcode %#x at %#x", opcode, op.Off)
+				break
+			}
+			op.Name = fmt.Sprintf("DW_MACRO_%#x", opcode)
+			u := &abbrevUnit{version: m.Version, addrSize: Arch.PtrSize, offsz: offsz, byteOrder: Arch.ByteOrder}
+			var vals []string
+			for _, form := range forms {
+				v, ok := u.readForm(b, uint64(form), abbrevAttr{})
+				if !ok {
+					m.Err = fmt.Sprintf("unknown form %#x at %#x", form, op.Off)
+					break
+				}
+				vals = append(vals, v)
+			}
+			op.Text = strings.Join(vals, ", ")
+		}
+		if m.Err != "" {
+			break
+		}
+		if b.eof {
+			m.Err = "truncated entry"
+			break
+		}
+		ops = append(ops, op)
+		switch opcode {
+		case _DW_MACRO_start_file:
+			stack = append(stack, ops)
+			ops = []*macroOp{}
+		case _DW_MACRO_end_file:
+			if len(stack) == 0 {
+				op.Text = "(no matching start_file)"
+				break
+			}
+			parent := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			parent[len(parent)-1].Childs = ops
+			ops = parent
+		}
+	}
+	for len(stack) > 0 {
+		parent := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		parent[len(parent)-1].Childs = ops
+		ops = parent
+	}
+	m.Ops = ops
+}
+
+func fmtMacroField(en *EntryNode, f *dwarf.Field, attrName string) template.HTML {
+	off, _ := f.Val.(int64)
+	cu := findCompileUnit(en)
+	if en.E.Tag == dwarf.TagCompileUnit || en.E.Tag == dwarf.TagSkeletonUnit {
+		cu = en.E
+	}
+	if cu == nil {
+		return template.HTML(fmt.Sprintf("<td>%s</td><td>%#x</td>", attrName, off))
+	}
+	return template.HTML(fmt.Sprintf("<td>%s</td><td><a href=\"/macro/%x\">%#x</a></td>", attrName, cu.Offset, off))
+}
+
+var macroTmpl = template.Must(template.New("macro").Funcs(template.FuncMap{
+	"Childs": func(unit *dwarf.Entry, ops []*macroOp) *macroUnit {
+		return &macroUnit{Unit: unit, Ops: ops}
+	},
+}).Parse(`<!doctype html>
+<html>
+<head>
+<title>Macros of {{.Unit.Offset | printf "%x"}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+	.macros div {
+		padding-left: 2em;
+	}
+</style>
+</head>
+<body>
+<h3>{{.Section}} unit at {{.Off | printf "%#x"}} for <a href="/{{.Unit.Offset | printf "%x"}}">&lt;{{.Unit.Offset | printf "%x"}}&gt;</a></h3>
+<table class='dwarftbl'>
+{{if .Version}}
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Flags</td><td>{{.Flags | printf "%#x"}}{{if .Dwarf64}} (64-bit DWARF){{end}}</td></tr>
+{{if ge .LineOff 0}}<tr><td>Line table offset</td><td>{{.LineOff | printf "%#x"}}</td></tr>{{end}}
+{{end}}
+{{if .Err}}<tr><td>Problems</td><td><b>{{.Err}}</b></td></tr>{{end}}
+</table>
+<hr/>
+<tt class='macros'>
+{{template "macroOps" .}}
+</tt>
+</body>
+</html>
+
+{{define "macroOps"}}{{$unit := .Unit}}{{range .Ops}}
+<div>{{.Off | printf "%#x"}} {{.Name}}{{if .Line}} line {{.Line}}{{end}}
+{{if ge .Import 0}}<a href="/macro/{{$unit.Offset | printf "%x"}}?import={{.Import | printf "%x"}}">{{.Import | printf "%#x"}}</a>{{end}}
+{{if eq .Name "DW_MACRO_start_file"}}file {{.Text}}{{else if .Text}}<b>{{.Text}}</b>{{end}}
+{{if .Childs}}{{template "macroOps" (Childs $unit .Childs)}}{{end}}</div>{{end}}{{end}}
+`))
+
+func macroHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	off := offset(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rdr := Dwarf.Reader()
+	rdr.Seek(off)
+	cu, err := rdr.Next()
+	must(err)
+	if cu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ms, moff, ok := macroSectionFor(cu)
+	if !ok {
+		fmt.Fprintf(w, "<!doctype html>\n<html><body>Compile unit <a href=\"/%x\">&lt;%x&gt;</a> has no macro information</body></html>\n", cu.Offset, cu.Offset)
+		return
+	}
+	if imp := r.Form.Get("import"); imp != "" && !ms.macinfo {
+		n, err := strconv.ParseInt(imp, 16, 64)
+		must(err)
+		moff = n
+	}
+	must(macroTmpl.Execute(w, ms.readMacroUnit(moff, cu)))
+}
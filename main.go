@@ -4,44 +4,60 @@ import (
 	"bytes"
 	"debug/dwarf"
 	"debug/elf"
-	"debug/macho"
 	"debug/pe"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/go-delve/delve/pkg/dwarf/frame"
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
-	"github.com/go-delve/delve/pkg/dwarf/op"
-	"github.com/go-delve/delve/pkg/dwarf/regnum"
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
 )
 
-var Dwarf *dwarf.Data
+var Dwarf *dwarfData
 var UnitVersions map[dwarf.Offset]uint8
-var TextStart uint64
-var TextData []byte
+var UnitDwarf64 map[dwarf.Offset]bool
+var UnitIDs map[dwarf.Offset]uint64
+var UnitHeaders map[dwarf.Offset]dwarf.Offset // offset of the unit header to offset of its first entry
 var DebugLoc2 *loclistReader2
 var DebugLoc5 *loclistSection5
 var DebugAddr5 *godwarf.DebugAddrSection
 var DebugFrame frame.FrameDescriptionEntries
 var Symbols []Sym
-var DisassembleOne DisassembleFunc
-var RegnumToString func(uint64) string
 var mu sync.Mutex
 
 var ListenAddr = "127.0.0.1:0"
 
+func init() {
+	onReset(func() {
+		Dwarf = nil
+		UnitVersions, UnitDwarf64, UnitIDs, UnitHeaders = nil, nil, nil, nil
+		DebugLoc2, DebugLoc5, DebugAddr5 = nil, nil, nil
+		DebugFrame = nil
+	})
+}
+
 type Sym struct {
-	Name string
-	Addr uint64
-	Off  dwarf.Offset
+	Name   string
+	Addr   uint64
+	Size   uint64 // 0 if unknown
+	Off    dwarf.Offset
+	Source string
+}
+
+func (s *Sym) HasDIE() bool {
+	return s.Source == symSourceDWARF
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: diexplorer <executable file> [listen addr]\n")
+	fmt.Fprintf(os.Stderr, "usage: diexplorer [options] <executable, object file or archive> [listen addr]\n")
+	flag.PrintDefaults()
 	os.Exit(1)
 }
 
@@ -59,33 +75,28 @@ func openPE(path string) {
 		return
 	}
 	fmt.Fprintf(os.Stderr, "Found PE executable\n")
-	var err error
-	Dwarf, err = file.DWARF()
+	addDataSource("code", path, "")
+	addDataSource("DWARF", path, "")
+	dw, err := file.DWARF()
 	must(err)
+	Dwarf = &dwarfData{Data: dw}
 
-	var ptrsz int
+	setArchPE(file)
 
 	var imageBase uint64
 	switch oh := file.OptionalHeader.(type) {
 	case *pe.OptionalHeader32:
-		ptrsz = 4
-		DisassembleOne = disassembleOne386
 		imageBase = uint64(oh.ImageBase)
 	case *pe.OptionalHeader64:
-		ptrsz = 8
-		DisassembleOne = disassembleOneAmd64
 		imageBase = oh.ImageBase
 	default:
 		panic(fmt.Errorf("pe file format not recognized"))
 	}
-	sect := file.Section(".text")
-	if sect == nil {
-		panic(fmt.Errorf("text section not found"))
-	}
-	TextStart = imageBase + uint64(sect.VirtualAddress)
-	TextData, err = sect.Data()
-	must(err)
-	initializeSections(ptrsz, func(name string) []byte {
+	loadTextSectionsPE(file, imageBase)
+	loadSymbolsPE(file, imageBase)
+	loadPclntabPE(file)
+	loadExeSectionsPE(file, imageBase)
+	initializeSections(path, func(name string) []byte {
 		data, _ := GetDebugSectionPE(file, name)
 		return data
 	})
@@ -93,36 +104,48 @@ func openPE(path string) {
 }
 
 func openMacho(path string) {
-	file, _ := macho.Open(path)
+	file, slice, err := openMachoFile(path, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 	if file == nil {
 		return
 	}
 	fmt.Fprintf(os.Stderr, "Found Macho-O executable\n")
-	var err error
-	Dwarf, err = file.DWARF()
-	must(err)
-
-	sect := file.Section("__text")
-	if sect == nil {
-		panic(fmt.Errorf("text section not found"))
+	addDataSource("code", path, slice)
+	dbgfile := file
+	if !hasDebugInfoMacho(file) {
+		if f, dbgpath, how := findDSYM(path, file); f != nil {
+			fmt.Fprintf(os.Stderr, "Reading debug info from %s\n", dbgpath)
+			dbgfile = f
+			addDataSource("DWARF", dbgpath, how)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s has no debug info and no dSYM bundle was found\n", path)
+			os.Exit(1)
+		}
 	}
-	switch file.Cpu {
-	case macho.Cpu386:
-		DisassembleOne = disassembleOne386
-	case macho.CpuArm64:
-		DisassembleOne = disassembleOneArm64
-	case macho.CpuAmd64:
-		fallthrough
-	default:
-		DisassembleOne = disassembleOneAmd64
+	if dbgfile == file {
+		addDataSource("DWARF", path, slice)
 	}
-	TextStart = sect.Addr
-	TextData, err = sect.Data()
+	dw, err := dbgfile.DWARF()
 	must(err)
-	initializeSections(8, func(name string) []byte {
-		data, _ := GetDebugSectionMacho(file, name)
+	Dwarf = &dwarfData{Data: dw}
+
+	setArchMacho(file)
+	loadTextSectionsMacho(file)
+	loadSymbolsMacho(file)
+	loadPclntabMacho(file)
+	loadExeSectionsMacho(file)
+	initializeSections(path, func(name string) []byte {
+		data, _ := GetDebugSectionMacho(dbgfile, name)
 		return data
 	})
+	if sect := file.Section("__eh_frame"); sect != nil {
+		data, err := sect.Data()
+		must(err)
+		loadEhFrame(data, sect.Addr, nil, 0)
+	}
 	return
 }
 
@@ -132,62 +155,83 @@ func openElf(path string) {
 		return
 	}
 
-	var ptrsz int = 8
-	switch file.Machine {
-	case elf.EM_386: // more 32bit arches go here...
-		DisassembleOne = disassembleOne386
-		RegnumToString = regnum.I386ToName
-		ptrsz = 4
-	case elf.EM_X86_64:
-		DisassembleOne = disassembleOneAmd64
-		RegnumToString = regnum.AMD64ToName
-	case elf.EM_AARCH64:
-		DisassembleOne = disassembleOneArm64
-		RegnumToString = regnum.ARM64ToName
-	case elf.EM_PPC64:
-		DisassembleOne = disassembleOnePpc64
-		RegnumToString = regnum.PPC64LEToName
-	case elf.EM_RISCV:
-		DisassembleOne = disassembleOneRiscv64
-		RegnumToString = regnum.RISCV64ToName
-	default:
-		fmt.Printf("unknown machine %s\n", file.Machine)
-	}
+	setArchElf(file)
 
-	fmt.Fprintf(os.Stderr, "Found ELF executable\n")
-	var err error
-	Dwarf, err = file.DWARF()
-	must(err)
-	sect := file.Section(".text")
-	if sect == nil {
-		panic(fmt.Errorf("text section not found"))
+	if file.Type == elf.ET_REL {
+		fmt.Fprintf(os.Stderr, "Found ELF relocatable object\n")
+		layoutObjectElf(file)
+	} else {
+		fmt.Fprintf(os.Stderr, "Found ELF executable\n")
+	}
+	addDataSource("code", path, "")
+	dbgfile := file
+	if !hasDebugInfoElf(file) {
+		if dbgpath, how := findSeparateDebugFile(path, file); dbgpath != "" {
+			fmt.Fprintf(os.Stderr, "Reading debug info from %s\n", dbgpath)
+			var err error
+			dbgfile, err = elf.Open(dbgpath)
+			must(err)
+			addDataSource("DWARF", dbgpath, how)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s has no debug info and no separate debug info file was found\n", path)
+			os.Exit(1)
+		}
+	}
+	if dbgfile == file {
+		addDataSource("DWARF", path, "")
 	}
-	TextStart = sect.Addr
-	TextData, err = sect.Data()
+	dw, err := elfDWARF(dbgfile)
 	must(err)
-	initializeSections(ptrsz, func(name string) []byte {
-		data, _ := GetDebugSectionElf(file, name)
+	Dwarf = &dwarfData{Data: dw}
+	loadTextSectionsElf(file)
+	loadSymbolsElf(file, dbgfile)
+	loadPclntabElf(file)
+	loadExeSectionsElf(file)
+	initializeSections(path, func(name string) []byte {
+		if name == "types" {
+			return getDebugTypesElf(dbgfile)
+		}
+		data, _ := GetDebugSectionElf(dbgfile, name)
 		return data
 	})
+	if sect := file.Section(".eh_frame"); sect != nil && sect.Type != elf.SHT_NOBITS {
+		data, err := sect.Data()
+		must(err)
+		data = relocateElf(file, sect, data)
+		var hdr []byte
+		var hdrAddr uint64
+		if hdrSect := file.Section(".eh_frame_hdr"); hdrSect != nil {
+			hdr, _ = hdrSect.Data()
+			hdrAddr = hdrSect.Addr
+		}
+		loadEhFrame(data, sect.Addr, hdr, hdrAddr)
+	}
 	return
 }
 
-func initializeSections(ptrsz int, getSection func(name string) []byte) {
-	if locData := getSection("loc"); locData != nil {
-		DebugLoc2 = newLoclistReader2(locData, ptrsz)
-	}
-	if locData := getSection("loclists"); locData != nil {
-		DebugLoc5 = newLoclistSection5(locData, ptrsz)
-	}
+func initializeSections(path string, getSection func(name string) []byte) {
+	DebugLoc2 = newLoclistReader2(getSection("loc"), Arch.PtrSize)
+	DebugLoc5 = newLoclistSection5(getSection("loclists"), Arch.PtrSize)
 	if frameData := getSection("frame"); frameData != nil {
-		DebugFrame, _ = frame.Parse(frameData, binary.LittleEndian, 0, ptrsz, 0)
+		frameData = fixFrameByteOrder(frameData, false)
+		DebugFrame, _ = frame.Parse(frameData, Arch.ByteOrder, 0, Arch.PtrSize, 0)
+		setFrameInfo(DebugFrame, frameData, ".debug_frame", 0)
 	}
-	if infoData := getSection("info"); infoData != nil {
-		readUnitVersions(infoData)
+	DebugInfo, DebugAbbrev = getSection("info"), getSection("abbrev")
+	if DebugInfo != nil {
+		readUnitVersions(DebugInfo)
 	}
 	if addrData := getSection("addr"); addrData != nil {
 		DebugAddr5 = godwarf.ParseAddr(addrData)
 	}
+	DebugLine, DebugStr, DebugLineStr = getSection("line"), getSection("str"), getSection("line_str")
+	DebugRanges, DebugRnglists = getSection("ranges"), getSection("rnglists")
+	Aranges = readAranges(getSection("aranges"))
+	loadAccelSections(getSection)
+	loadSplitUnits(path, getSection)
+	DebugMacro, DebugMacinfo, DebugStrOffsets = getSection("macro"), getSection("macinfo"), getSection("str_offsets")
+	DebugTypes = getSection("types")
+	loadTypeUnits()
 }
 
 type EntryNode struct {
@@ -209,7 +253,7 @@ func (en *EntryNode) IsCompileUnit() bool {
 func (entryNode *EntryNode) Frames() []interface{} {
 	var frames []interface{}
 	var cmn *frame.CommonInformationEntry
-	for _, frame := range DebugFrame {
+	for _, frame := range append(DebugFrame[:len(DebugFrame):len(DebugFrame)], EhFrame...) {
 		frameRng := [2]uint64{frame.Begin(), frame.End()}
 		o := false
 		if entryNode.allDebugFrames {
@@ -234,7 +278,16 @@ func (entryNode *EntryNode) Frames() []interface{} {
 	return frames
 }
 
-func toEntryNode(rdr *dwarf.Reader) (node *EntryNode, addOffs []dwarf.Offset) {
+// EhFrameHdr returns the .eh_frame_hdr table when displaying all frame
+// entries.
+func (entryNode *EntryNode) EhFrameHdr() []ehFrameHdrEntry {
+	if !entryNode.allDebugFrames {
+		return nil
+	}
+	return EhFrameHdr
+}
+
+func toEntryNode(rdr *dwarfReader) (node *EntryNode, addOffs []dwarf.Offset) {
 	e, err := rdr.Next()
 	must(err)
 
@@ -252,6 +305,10 @@ func toEntryNode(rdr *dwarf.Reader) (node *EntryNode, addOffs []dwarf.Offset) {
 	for _, field := range e.Field {
 		if field.Class == dwarf.ClassReference {
 			addOffs = append(addOffs, field.Val.(dwarf.Offset))
+		} else if field.Class == dwarf.ClassReferenceSig {
+			if tu := TypeUnits[field.Val.(uint64)]; tu != nil {
+				addOffs = append(addOffs, tu.TypeOff)
+			}
 		} else if field.Attr == dwarf.AttrRanges || field.Attr == dwarf.AttrLowpc || field.Attr == dwarf.AttrHighpc {
 			hasranges = true
 		}
@@ -266,7 +323,7 @@ func toEntryNode(rdr *dwarf.Reader) (node *EntryNode, addOffs []dwarf.Offset) {
 		return node, addOffs
 	}
 
-	if e.Tag == dwarf.TagCompileUnit {
+	if e.Tag == dwarf.TagCompileUnit || e.Tag == dwarf.TagTypeUnit {
 		for {
 			e, err := rdr.Next()
 			must(err)
@@ -308,7 +365,7 @@ func countNodes(nodes []*EntryNode) int {
 
 func allCompileUnits(nodes []*EntryNode) bool {
 	for _, n := range nodes {
-		if n.E.Tag != dwarf.TagCompileUnit {
+		if n.E.Tag != dwarf.TagCompileUnit && n.E.Tag != dwarf.TagTypeUnit {
 			return false
 		}
 	}
@@ -325,7 +382,7 @@ func loclistPrint(off int64, cu *dwarf.Entry, debugLoc loclistReader) string {
 		if e.isrange {
 			fmt.Fprintf(&buf, "<input type='checkbox' id='ll%x' onclick='javascript:window.parent.parent.frames[1].repaint()'></input>", e.seek)
 			fmt.Fprintf(&buf, "%#x %#x ", e.lowpc, e.highpc)
-			op.PrettyPrint(&buf, e.instr, RegnumToString)
+			PrettyPrintOp(&buf, e.instr, unitOffsetSize(cu))
 		}
 		fmt.Fprintf(&buf, "\n")
 	}
@@ -334,6 +391,16 @@ func loclistPrint(off int64, cu *dwarf.Entry, debugLoc loclistReader) string {
 
 var compileUnits []*dwarf.Entry
 
+// varAddrs maps global variables to their address.
+var varAddrs = map[dwarf.Offset]uint64{}
+
+func init() {
+	onReset(func() {
+		Symbols, compileUnits = nil, nil
+		varAddrs = map[dwarf.Offset]uint64{}
+	})
+}
+
 func findSymbols() {
 	rdr := Dwarf.Reader()
 	for {
@@ -344,39 +411,69 @@ func findSymbols() {
 		}
 		switch e.Tag {
 		case dwarf.TagCompileUnit:
+			if su := Dwarf.splitForSkeleton(e.Offset); su != nil && su.data != nil {
+				// pre-standard skeleton units use DW_TAG_compile_unit
+				break
+			}
 			compileUnits = append(compileUnits, e)
 		case dwarf.TagSubprogram:
 			addr, okAddr := e.Val(dwarf.AttrLowpc).(uint64)
 			name, okName := e.Val(dwarf.AttrName).(string)
 			if okAddr && okName {
+				var size uint64
+				if f := e.AttrField(dwarf.AttrHighpc); f != nil {
+					switch f.Class {
+					case dwarf.ClassConstant:
+						size, _ = f.Val.(uint64)
+						if x, ok := f.Val.(int64); ok {
+							size = uint64(x)
+						}
+					case dwarf.ClassAddress:
+						size = f.Val.(uint64) - addr
+					}
+				}
 				Symbols = append(Symbols, Sym{
-					Name: name,
-					Addr: addr,
-					Off:  e.Offset,
+					Name:   name,
+					Addr:   addr,
+					Size:   size,
+					Off:    e.Offset,
+					Source: symSourceDWARF,
 				})
 			}
 		case dwarf.TagVariable:
 			loc, okLoc := e.Val(dwarf.AttrLocation).([]byte)
 			name, okName := e.Val(dwarf.AttrName).(string)
-			if okLoc && okName {
-				if loc[0] != 0x3 {
-					// not DW_OP_addr
-					break
-				}
+			if okLoc && okName && len(loc) > 0 {
 				addr := uint64(0)
-				switch len(loc[1:]) {
-				case 4:
-					addr = uint64(binary.LittleEndian.Uint32(loc[1:]))
-				case 8:
-					addr = binary.LittleEndian.Uint64(loc[1:])
+				switch loc[0] {
+				case 0x3: // DW_OP_addr
+					switch len(loc[1:]) {
+					case 4:
+						addr = uint64(Arch.ByteOrder.Uint32(loc[1:]))
+					case 8:
+						addr = Arch.ByteOrder.Uint64(loc[1:])
+					default:
+						// C bullshit
+						//panic(fmt.Errorf("wrong location %v", loc))
+					}
+				case 0xa1, 0xfb: // DW_OP_addrx, DW_OP_GNU_addr_index
+					if len(compileUnits) > 0 {
+						idx, _ := leb128.DecodeUnsigned(bytes.NewBuffer(loc[1:]))
+						addr, _ = debugAddrFor(compileUnits[len(compileUnits)-1]).Get(idx)
+					}
 				default:
-					// C bullshit
-					//panic(fmt.Errorf("wrong location %v", loc))
+					// not an address
+					loc = nil
 				}
+				if loc == nil {
+					break
+				}
+				varAddrs[e.Offset] = addr
 				Symbols = append(Symbols, Sym{
-					Name: name,
-					Addr: addr,
-					Off:  e.Offset,
+					Name:   name,
+					Addr:   addr,
+					Off:    e.Offset,
+					Source: symSourceDWARF,
 				})
 			}
 		}
@@ -384,6 +481,17 @@ func findSymbols() {
 			rdr.SkipChildren()
 		}
 	}
+	// symbol table entries are only used for addresses not described by DWARF
+	dwarfAddrs := make(map[uint64]bool)
+	for _, sym := range Symbols {
+		dwarfAddrs[sym.Addr] = true
+	}
+	for _, sym := range tableSymbols {
+		if !dwarfAddrs[sym.Addr] {
+			Symbols = append(Symbols, sym)
+			dwarfAddrs[sym.Addr] = true
+		}
+	}
 	sort.Slice(Symbols, func(i, j int) bool {
 		return Symbols[i].Addr < Symbols[j].Addr
 	})
@@ -393,6 +501,10 @@ func findCompileUnit(e *EntryNode) *dwarf.Entry {
 	if len(e.Ranges) > 0 {
 		pc := e.Ranges[0][0]
 
+		if cu := arangesLookup(pc); cu != nil {
+			return cu
+		}
+
 		for i := range compileUnits {
 			ranges, _ := Dwarf.Ranges(compileUnits[i])
 			for _, rng := range ranges {
@@ -406,23 +518,58 @@ func findCompileUnit(e *EntryNode) *dwarf.Entry {
 
 	for i := range compileUnits {
 		if compileUnits[i].Offset > e.E.Offset {
+			if i == 0 {
+				return nil
+			}
 			return compileUnits[i-1]
 		}
 	}
+	if len(compileUnits) > 0 {
+		return compileUnits[len(compileUnits)-1]
+	}
 	return nil
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	debugDirs := flag.String("debug-dir", "", "list of directories to search for separate debug info files, in addition to "+strings.Join(DebugDirs, string(filepath.ListSeparator)))
+	flag.StringVar(&MachoArch, "arch", "", "architecture to use for universal Mach-O binaries (386, amd64, arm64...)")
+	member := flag.String("member", "", "member to explore when opening an archive")
+	core := flag.String("core", "", "core file produced by the executable")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		usage()
 	}
 
-	if len(os.Args) >= 3 {
-		ListenAddr = os.Args[2]
+	if flag.NArg() >= 2 {
+		ListenAddr = flag.Arg(1)
 	}
 
+	if *debugDirs != "" {
+		DebugDirs = append(filepath.SplitList(*debugDirs), DebugDirs...)
+	}
+
+	if isArchive(flag.Arg(0)) {
+		openArchive(flag.Arg(0), *member)
+	} else {
+		openFile(flag.Arg(0))
+	}
+
+	if *core != "" {
+		if Archive != nil || Dwarf == nil {
+			fmt.Fprintf(os.Stderr, "-core can only be used with an executable\n")
+			os.Exit(1)
+		}
+		openCore(*core, flag.Arg(0))
+	}
+
+	serve()
+}
+
+func openFile(path string) {
 	for _, fn := range []openFn{openPE, openElf, openMacho} {
-		fn(os.Args[1])
+		fn(path)
 		if Dwarf != nil {
 			break
 		}
@@ -438,8 +585,6 @@ func main() {
 			}
 		}
 	}
-
-	serve()
 }
 
 type InlinedCall struct {
@@ -529,9 +674,14 @@ func readUnitVersions(data []byte) {
 	)
 
 	UnitVersions = make(map[dwarf.Offset]uint8)
+	UnitDwarf64 = make(map[dwarf.Offset]bool)
+	UnitIDs = make(map[dwarf.Offset]uint64)
+	UnitHeaders = make(map[dwarf.Offset]dwarf.Offset)
+	TypeUnits = make(map[uint64]*typeUnit)
 	off := dwarf.Offset(0)
 	for len(data) > 0 {
-		length, dwarf64, version, _ := readDwarfLengthVersion(data)
+		length, dwarf64, version, byteOrder := readDwarfLengthVersion(data)
+		hdrOff := off
 
 		data = data[4:]
 		off += 4
@@ -556,29 +706,112 @@ func readUnitVersions(data []byte) {
 
 			case _DW_UT_skeleton, _DW_UT_split_compile:
 				headerSize = 4 + secoffsz + 8
+				UnitIDs[off+dwarf.Offset(headerSize)] = byteOrder.Uint64(data[4+secoffsz:])
 
 			case _DW_UT_type, _DW_UT_split_type:
 				headerSize = 4 + secoffsz + 8 + secoffsz
+				readTypeUnitHeader(hdrOff, off+dwarf.Offset(headerSize), data, secoffsz, byteOrder)
 			}
 		}
 
 		UnitVersions[off+dwarf.Offset(headerSize)] = version
+		UnitDwarf64[off+dwarf.Offset(headerSize)] = dwarf64
+		UnitHeaders[hdrOff] = off + dwarf.Offset(headerSize)
 
 		data = data[length:] // skip contents
 		off += dwarf.Offset(length)
 	}
 }
 
-func loclistReaderForEntry(en *EntryNode) loclistReader {
-	const dwarfAttrAddrBase = 0x73
-	cu := findCompileUnit(en)
+// unitOffsetSize returns the size of the section offsets of compile unit cu.
+func unitOffsetSize(cu *dwarf.Entry) int {
+	if cu != nil && UnitDwarf64[cu.Offset] {
+		return 8
+	}
+	return 4
+}
+
+// loclistReaderFor returns a reader for the location lists of compile unit
+// cu, or nil if cu is nil.
+func loclistReaderFor(cu *dwarf.Entry) loclistReader {
+	if cu == nil {
+		return nil
+	}
 	ver := UnitVersions[cu.Offset]
-	ranges, _ := Dwarf.Ranges(cu)
+	var base uint64
+	if ranges, _ := Dwarf.Ranges(cu); len(ranges) > 0 {
+		base = ranges[0][0]
+	}
+	if su := Dwarf.splitFor(cu.Offset); su != nil {
+		if su.version < 5 {
+			return &loclistReaderGNU{data: su.locGNU, debugAddr: debugAddrFor(cu)}
+		}
+		return su.loclists.ReaderFor(base, debugAddrFor(cu))
+	}
 	if ver >= 5 {
-		addrBase := cu.Val(dwarfAttrAddrBase).(int64)
-
-		return DebugLoc5.ReaderFor(ranges[0][0], DebugAddr5.GetSubsection(uint64(addrBase)))
+		return DebugLoc5.ReaderFor(base, debugAddrFor(cu))
 	}
-	DebugLoc2.base = ranges[0][0]
+	DebugLoc2.base = base
 	return DebugLoc2
 }
+
+// debugAddrFor returns the subsection of .debug_addr used by compile unit cu.
+func debugAddrFor(cu *dwarf.Entry) *godwarf.DebugAddr {
+	if su := Dwarf.splitFor(cu.Offset); su != nil {
+		return su.debugAddr
+	}
+	addrBase, _ := cu.Val(dwarf.AttrAddrBase).(int64)
+	return DebugAddr5.GetSubsection(uint64(addrBase))
+}
+
+// loclistOffset returns the offset of the location list referenced by the
+// field f of an entry of compile unit cu. For DW_FORM_loclistx the offset
+// is read from the offsets table at DW_AT_loclists_base.
+func loclistOffset(cu *dwarf.Entry, f *dwarf.Field) int64 {
+	if f.Class != dwarf.ClassLocList {
+		return f.Val.(int64)
+	}
+	if cu == nil {
+		return 0
+	}
+	idx := f.Val.(uint64)
+	var data []byte
+	var base int64
+	if su := Dwarf.splitFor(cu.Offset); su != nil && su.loclists != nil {
+		data, base = su.loclists.data, su.loclistsBase
+	} else {
+		data = DebugLoc5.data
+		base, _ = cu.Val(dwarf.AttrLoclistsBase).(int64)
+	}
+	offsz := listsOffsetSize(data, base)
+	off := base + int64(idx)*offsz
+	if off < 0 || off+offsz > int64(len(data)) {
+		return 0
+	}
+	if offsz == 8 {
+		return base + int64(Arch.ByteOrder.Uint64(data[off:]))
+	}
+	return base + int64(Arch.ByteOrder.Uint32(data[off:]))
+}
+
+// listsOffsetSize returns the size of the entries of the offsets table at
+// base of a .debug_loclists or .debug_rnglists section, which is set by the
+// header of the contribution containing it.
+func listsOffsetSize(data []byte, base int64) int64 {
+	for off := int64(0); off < int64(len(data)); {
+		length, dwarf64, _, _ := readDwarfLengthVersion(data[off:])
+		hdrsz, offsz := int64(4), int64(4)
+		if dwarf64 {
+			hdrsz, offsz = 12, 8
+		}
+		end := off + hdrsz + int64(length)
+		if length == 0 || end > int64(len(data)) {
+			break
+		}
+		if base > off && base <= end {
+			return offsz
+		}
+		off = end
+	}
+	return 4
+}
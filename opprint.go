@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+// dwarfOpcode describes a DWARF expression opcode, the arguments string
+// has one character per argument:
+//
+//	s	SLEB128
+//	u	ULEB128
+//	1	8-bit argument
+//	2	16-bit argument
+//	4	32-bit argument
+//	8	64-bit argument
+//	a	target address
+//	o	section offset
+//	B	a ULEB128 size followed by a block of that size
+//	E	a ULEB128 size followed by a DWARF expression of that size
+//	T	a 1 byte size followed by a block of that size
+type dwarfOpcode struct {
+	name string
+	args string
+}
+
+var dwarfOpcodes = map[byte]dwarfOpcode{
+	0x03: {"DW_OP_addr", "a"},
+	0x06: {"DW_OP_deref", ""},
+	0x08: {"DW_OP_const1u", "1"},
+	0x09: {"DW_OP_const1s", "1"},
+	0x0a: {"DW_OP_const2u", "2"},
+	0x0b: {"DW_OP_const2s", "2"},
+	0x0c: {"DW_OP_const4u", "4"},
+	0x0d: {"DW_OP_const4s", "4"},
+	0x0e: {"DW_OP_const8u", "8"},
+	0x0f: {"DW_OP_const8s", "8"},
+	0x10: {"DW_OP_constu", "u"},
+	0x11: {"DW_OP_consts", "s"},
+	0x12: {"DW_OP_dup", ""},
+	0x13: {"DW_OP_drop", ""},
+	0x14: {"DW_OP_over", ""},
+	0x15: {"DW_OP_pick", "1"},
+	0x16: {"DW_OP_swap", ""},
+	0x17: {"DW_OP_rot", ""},
+	0x18: {"DW_OP_xderef", ""},
+	0x19: {"DW_OP_abs", ""},
+	0x1a: {"DW_OP_and", ""},
+	0x1b: {"DW_OP_div", ""},
+	0x1c: {"DW_OP_minus", ""},
+	0x1d: {"DW_OP_mod", ""},
+	0x1e: {"DW_OP_mul", ""},
+	0x1f: {"DW_OP_neg", ""},
+	0x20: {"DW_OP_not", ""},
+	0x21: {"DW_OP_or", ""},
+	0x22: {"DW_OP_plus", ""},
+	0x23: {"DW_OP_plus_uconst", "u"},
+	0x24: {"DW_OP_shl", ""},
+	0x25: {"DW_OP_shr", ""},
+	0x26: {"DW_OP_shra", ""},
+	0x27: {"DW_OP_xor", ""},
+	0x28: {"DW_OP_bra", "2"},
+	0x29: {"DW_OP_eq", ""},
+	0x2a: {"DW_OP_ge", ""},
+	0x2b: {"DW_OP_gt", ""},
+	0x2c: {"DW_OP_le", ""},
+	0x2d: {"DW_OP_lt", ""},
+	0x2e: {"DW_OP_ne", ""},
+	0x2f: {"DW_OP_skip", "2"},
+	0x90: {"DW_OP_regx", "u"},
+	0x91: {"DW_OP_fbreg", "s"},
+	0x92: {"DW_OP_bregx", "us"},
+	0x93: {"DW_OP_piece", "u"},
+	0x94: {"DW_OP_deref_size", "1"},
+	0x95: {"DW_OP_xderef_size", "1"},
+	0x96: {"DW_OP_nop", ""},
+	0x97: {"DW_OP_push_object_address", ""},
+	0x98: {"DW_OP_call2", "2"},
+	0x99: {"DW_OP_call4", "4"},
+	0x9a: {"DW_OP_call_ref", "o"},
+	0x9b: {"DW_OP_form_tls_address", ""},
+	0x9c: {"DW_OP_call_frame_cfa", ""},
+	0x9d: {"DW_OP_bit_piece", "uu"},
+	0x9e: {"DW_OP_implicit_value", "B"},
+	0x9f: {"DW_OP_stack_value", ""},
+	0xa0: {"DW_OP_implicit_pointer", "os"},
+	0xa1: {"DW_OP_addrx", "u"},
+	0xa2: {"DW_OP_constx", "u"},
+	0xa3: {"DW_OP_entry_value", "E"},
+	0xa4: {"DW_OP_const_type", "uT"},
+	0xa5: {"DW_OP_regval_type", "uu"},
+	0xa6: {"DW_OP_deref_type", "1u"},
+	0xa7: {"DW_OP_xderef_type", "1u"},
+	0xa8: {"DW_OP_convert", "u"},
+	0xa9: {"DW_OP_reinterpret", "u"},
+	0xe0: {"DW_OP_GNU_push_tls_address", ""},
+	0xf0: {"DW_OP_GNU_uninit", ""},
+	0xf1: {"DW_OP_GNU_encoded_addr", ""},
+	0xf2: {"DW_OP_GNU_implicit_pointer", "os"},
+	0xf3: {"DW_OP_GNU_entry_value", "E"},
+	0xf4: {"DW_OP_GNU_const_type", "uT"},
+	0xf5: {"DW_OP_GNU_regval_type", "uu"},
+	0xf6: {"DW_OP_GNU_deref_type", "1u"},
+	0xf7: {"DW_OP_GNU_convert", "u"},
+	0xf9: {"DW_OP_GNU_reinterpret", "u"},
+	0xfa: {"DW_OP_GNU_parameter_ref", "4"},
+	0xfb: {"DW_OP_GNU_addr_index", "u"},
+	0xfc: {"DW_OP_GNU_const_index", "u"},
+	0xfd: {"DW_OP_GNU_variable_value", "o"},
+}
+
+const (
+	_DW_OP_lit0   = 0x30
+	_DW_OP_lit31  = 0x4f
+	_DW_OP_reg0   = 0x50
+	_DW_OP_reg31  = 0x6f
+	_DW_OP_breg0  = 0x70
+	_DW_OP_breg31 = 0x8f
+	_DW_OP_regx   = 0x90
+	_DW_OP_bregx  = 0x92
+)
+
+func dwarfOpcodeFor(opcode byte) (dwarfOpcode, bool) {
+	switch {
+	case opcode >= _DW_OP_lit0 && opcode <= _DW_OP_lit31:
+		return dwarfOpcode{fmt.Sprintf("DW_OP_lit%d", opcode-_DW_OP_lit0), ""}, true
+	case opcode >= _DW_OP_reg0 && opcode <= _DW_OP_reg31:
+		return dwarfOpcode{fmt.Sprintf("DW_OP_reg%d", opcode-_DW_OP_reg0), ""}, true
+	case opcode >= _DW_OP_breg0 && opcode <= _DW_OP_breg31:
+		return dwarfOpcode{fmt.Sprintf("DW_OP_breg%d", opcode-_DW_OP_breg0), "s"}, true
+	}
+	op, ok := dwarfOpcodes[opcode]
+	return op, ok
+}
+
+// PrettyPrintOp prints the DWARF expression instrs to out, using the byte
+// order and pointer size of the executable, offsz is the size of section
+// offsets in the unit containing the expression.
+func PrettyPrintOp(out io.Writer, instrs []byte, offsz int) {
+	in := bytes.NewBuffer(instrs)
+
+	for {
+		opcode, err := in.ReadByte()
+		if err != nil {
+			break
+		}
+		op, found := dwarfOpcodeFor(opcode)
+		if !found {
+			fmt.Fprintf(out, "%#x ", opcode)
+			continue
+		}
+		io.WriteString(out, op.name)
+		if Arch.RegnumToString != nil {
+			if opcode >= _DW_OP_reg0 && opcode <= _DW_OP_reg31 {
+				fmt.Fprintf(out, "(%s)", Arch.RegnumToString(uint64(opcode-_DW_OP_reg0)))
+			} else if opcode >= _DW_OP_breg0 && opcode <= _DW_OP_breg31 {
+				fmt.Fprintf(out, "(%s)", Arch.RegnumToString(uint64(opcode-_DW_OP_breg0)))
+			}
+		}
+		out.Write([]byte{' '})
+
+		for i, arg := range op.args {
+			var n uint64
+			switch arg {
+			case 's':
+				x, _ := leb128.DecodeSigned(in)
+				n = uint64(x)
+				fmt.Fprintf(out, "%#x ", x)
+			case 'u':
+				n, _ = leb128.DecodeUnsigned(in)
+				fmt.Fprintf(out, "%#x ", n)
+			case '1':
+				b, _ := in.ReadByte()
+				fmt.Fprintf(out, "%#x ", b)
+			case '2':
+				fmt.Fprintf(out, "%#x ", readUint(in, 2))
+			case '4':
+				fmt.Fprintf(out, "%#x ", readUint(in, 4))
+			case 'o':
+				fmt.Fprintf(out, "%#x ", readUint(in, offsz))
+			case '8':
+				fmt.Fprintf(out, "%#x ", readUint(in, 8))
+			case 'a':
+				fmt.Fprintf(out, "%#x ", readUint(in, Arch.PtrSize))
+			case 'B':
+				sz, _ := leb128.DecodeUnsigned(in)
+				data := in.Next(int(sz))
+				fmt.Fprintf(out, "%d [%x] ", sz, data)
+			case 'E':
+				sz, _ := leb128.DecodeUnsigned(in)
+				var buf bytes.Buffer
+				PrettyPrintOp(&buf, in.Next(int(sz)), offsz)
+				fmt.Fprintf(out, "(%s) ", strings.TrimSpace(buf.String()))
+			case 'T':
+				sz, _ := in.ReadByte()
+				fmt.Fprintf(out, "%d [%x] ", sz, in.Next(int(sz)))
+			}
+			if Arch.RegnumToString != nil && i == 0 && (opcode == _DW_OP_regx || opcode == _DW_OP_bregx) {
+				fmt.Fprintf(out, "(%s) ", Arch.RegnumToString(n))
+			}
+		}
+	}
+}
+
+// walkOps calls fn for every operation of the DWARF expression instrs with
+// the bytes of its operands, it stops at the first unknown opcode. offsz is
+// the size of section offsets, as for PrettyPrintOp.
+func walkOps(instrs []byte, offsz int, fn func(opcode byte, args []byte)) {
+	in := bytes.NewBuffer(instrs)
+	for in.Len() > 0 {
+		start := len(instrs) - in.Len()
+		opcode, _ := in.ReadByte()
+		op, found := dwarfOpcodeFor(opcode)
+		if !found {
+			return
+		}
+		for _, arg := range op.args {
+			switch arg {
+			case 's':
+				leb128.DecodeSigned(in)
+			case 'u':
+				leb128.DecodeUnsigned(in)
+			case '1':
+				in.Next(1)
+			case '2':
+				in.Next(2)
+			case '4':
+				in.Next(4)
+			case '8':
+				in.Next(8)
+			case 'o':
+				in.Next(offsz)
+			case 'a':
+				in.Next(Arch.PtrSize)
+			case 'B', 'E':
+				sz, _ := leb128.DecodeUnsigned(in)
+				in.Next(int(sz))
+			case 'T':
+				sz, _ := in.ReadByte()
+				in.Next(int(sz))
+			}
+		}
+		fn(opcode, instrs[start+1:len(instrs)-in.Len()])
+	}
+}
+
+// readUint reads an unsigned integer of sz bytes from in using the byte
+// order of the executable.
+func readUint(in *bytes.Buffer, sz int) uint64 {
+	b := in.Next(sz)
+	if len(b) < sz {
+		return 0
+	}
+	switch sz {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(Arch.ByteOrder.Uint16(b))
+	case 4:
+		return uint64(Arch.ByteOrder.Uint32(b))
+	default:
+		return Arch.ByteOrder.Uint64(b)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/frame"
+)
+
+// Consistency checks between the DWARF info and the Go pclntab, which
+// describe the same line numbers and stack frames.
+
+// lineRow is a row of the line number programs of all compile units.
+type lineRow struct {
+	Addr uint64
+	File string
+	Line int
+	End  bool // end of sequence
+}
+
+var lineRows []lineRow
+
+func loadLineRows() {
+	if lineRows != nil {
+		return
+	}
+	lineRows = []lineRow{}
+	for _, cu := range compileUnits {
+		lnrdr, err := Dwarf.LineReader(cu)
+		if err != nil || lnrdr == nil {
+			continue
+		}
+		var lne dwarf.LineEntry
+		for lnrdr.Next(&lne) == nil {
+			row := lineRow{Addr: lne.Address, Line: lne.Line, End: lne.EndSequence}
+			if lne.File != nil {
+				row.File = lne.File.Name
+			}
+			lineRows = append(lineRows, row)
+		}
+	}
+	sort.SliceStable(lineRows, func(i, j int) bool { return lineRows[i].Addr < lineRows[j].Addr })
+}
+
+// lineRowAt returns the row of the line table describing pc.
+func lineRowAt(pc uint64) (lineRow, bool) {
+	loadLineRows()
+	i := sort.Search(len(lineRows), func(i int) bool { return lineRows[i].Addr > pc }) - 1
+	for j := i; j >= 0 && lineRows[j].Addr == lineRows[i].Addr; j-- {
+		if !lineRows[j].End {
+			return lineRows[j], true
+		}
+	}
+	return lineRow{}, false
+}
+
+// pcValueAt returns the value of tbl at pc.
+func pcValueAt(tbl []pcRange, pc uint64) (int32, bool) {
+	j := sort.Search(len(tbl), func(j int) bool { return tbl[j].End > pc })
+	if j >= len(tbl) || tbl[j].Start > pc {
+		return 0, false
+	}
+	return tbl[j].Val, true
+}
+
+// pcMismatch is a range of addresses where DWARF and pclntab disagree.
+type pcMismatch struct {
+	Start, End     uint64
+	Kind           string
+	DWARF, Pclntab string
+}
+
+type funcCheck struct {
+	F          *pclnFunc
+	Mismatches []pcMismatch
+}
+
+type pclnReport struct {
+	Funcs     []*funcCheck // functions with mismatches
+	OnlyPcln  []*pclnFunc
+	OnlyDWARF []Sym
+	Checked   int
+	Lines     int // number of ranges with a different file:line
+	CFAs      int // number of ranges with a different CFA
+}
+
+var pclnCheckReport *pclnReport
+
+func init() {
+	onReset(func() {
+		lineRows, pclnCheckReport = nil, nil
+	})
+}
+
+// checkFunc compares the file:line and CFA of every address of f in DWARF
+// and in pclntab.
+func (t *pclnTable) checkFunc(f *pclnFunc) []pcMismatch {
+	_, tables := t.pclnTables(f)
+	pcsp, pcfile, pcln := tables[0], tables[1], tables[2]
+	end := f.Entry
+	for _, tbl := range tables[:3] {
+		if len(tbl) > 0 && tbl[len(tbl)-1].End > end {
+			end = tbl[len(tbl)-1].End
+		}
+	}
+
+	var r []pcMismatch
+	add := func(pcs []uint64, kind string, check func(pc uint64) (string, string, bool)) {
+		sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+		for i, pc := range pcs {
+			if pc < f.Entry || pc >= end || (i > 0 && pcs[i-1] == pc) {
+				continue
+			}
+			next := end
+			for _, pc2 := range pcs[i+1:] {
+				if pc2 > pc {
+					next = pc2
+					break
+				}
+			}
+			if next > end {
+				next = end
+			}
+			dw, pt, ok := check(pc)
+			if ok {
+				continue
+			}
+			if n := len(r); n > 0 && r[n-1].Kind == kind && r[n-1].End == pc && r[n-1].DWARF == dw && r[n-1].Pclntab == pt {
+				r[n-1].End = next
+				continue
+			}
+			r = append(r, pcMismatch{pc, next, kind, dw, pt})
+		}
+	}
+
+	// file:line
+	loadLineRows()
+	pcs := []uint64{f.Entry}
+	for i := sort.Search(len(lineRows), func(i int) bool { return lineRows[i].Addr >= f.Entry }); i < len(lineRows) && lineRows[i].Addr < end; i++ {
+		pcs = append(pcs, lineRows[i].Addr)
+	}
+	for _, tbl := range [][]pcRange{pcfile, pcln} {
+		for _, rng := range tbl {
+			pcs = append(pcs, rng.Start)
+		}
+	}
+	add(pcs, "line", func(pc uint64) (string, string, bool) {
+		dw, pt := "no row", "no entry"
+		row, ok := lineRowAt(pc)
+		if ok {
+			dw = fmt.Sprintf("%s:%d", row.File, row.Line)
+		}
+		file, okf := pcValueAt(pcfile, pc)
+		line, okl := pcValueAt(pcln, pc)
+		if okf && okl {
+			pt = fmt.Sprintf("%s:%d", t.fileName(f, file), line)
+		}
+		return dw, pt, dw == pt
+	})
+
+	// CFA
+	fde, _ := DebugFrame.FDEForPC(f.Entry)
+	pcs = []uint64{f.Entry}
+	if fde != nil {
+		pcs = append(pcs, frameRowAddrs(fde)...)
+	}
+	for _, rng := range pcsp {
+		pcs = append(pcs, rng.Start)
+	}
+	raSize := int64(0)
+	if Arch.CallPushesRA {
+		raSize = int64(Arch.PtrSize)
+	}
+	add(pcs, "CFA", func(pc uint64) (string, string, bool) {
+		dw, pt := "", "no entry"
+		if sp, ok := pcValueAt(pcsp, pc); ok {
+			pt = fmt.Sprintf("SP+%#x", int64(sp)+raSize)
+		}
+		if fde == nil || !fde.Cover(pc) {
+			return "no frame description entry", pt, false
+		}
+		cfa, ok := establishCFA(fde, pc)
+		switch {
+		case !ok:
+			dw = "could not execute the frame description entry"
+		case cfa.Rule == frame.RuleCFA && cfa.Reg == Arch.SPRegnum:
+			dw = fmt.Sprintf("SP+%#x", cfa.Offset)
+		case cfa.Rule == frame.RuleCFA:
+			dw = fmt.Sprintf("r%d+%#x", cfa.Reg, cfa.Offset)
+		default:
+			dw = "expression"
+		}
+		return dw, pt, dw == pt
+	})
+
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Start < r[j].Start })
+	return r
+}
+
+func establishCFA(fde *frame.FrameDescriptionEntry, pc uint64) (cfa frame.DWRule, ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ok = false
+		}
+	}()
+	return fde.EstablishFrame(pc).CFA, true
+}
+
+// checkPclntab compares every function of pclntab with the DWARF info.
+func checkPclntab() *pclnReport {
+	if pclnCheckReport != nil {
+		return pclnCheckReport
+	}
+	t := pclntab()
+	rep := &pclnReport{}
+	for _, f := range t.Funcs {
+		if f.DIE() == "" {
+			rep.OnlyPcln = append(rep.OnlyPcln, f)
+		}
+		rep.Checked++
+		if mm := t.checkFunc(f); len(mm) > 0 {
+			rep.Funcs = append(rep.Funcs, &funcCheck{f, mm})
+			for _, m := range mm {
+				if m.Kind == "line" {
+					rep.Lines++
+				} else {
+					rep.CFAs++
+				}
+			}
+		}
+	}
+	for _, sym := range Symbols {
+		if !sym.HasDIE() || sym.Size == 0 {
+			continue
+		}
+		if _, err := findTextSection(sym.Addr, sym.Addr+1); err != nil {
+			continue
+		}
+		if t.funcAt(sym.Addr) == nil {
+			rep.OnlyDWARF = append(rep.OnlyDWARF, sym)
+		}
+	}
+	pclnCheckReport = rep
+	return rep
+}
+
+// pclnMismatches returns a function returning the attributes of the row
+// of pc in the disassembly of the function starting at entry, highlighting
+// it if DWARF and pclntab disagree.
+func pclnMismatches(entry uint64) func(pc uint64) string {
+	var mm []pcMismatch
+	if t := pclntab(); t != nil {
+		if f := t.funcAt(entry); f != nil {
+			mm = t.checkFunc(f)
+		}
+	}
+	return func(pc uint64) string {
+		for _, m := range mm {
+			if pc >= m.Start && pc < m.End {
+				return fmt.Sprintf(" style='color: red' title='%s DWARF: %s pclntab: %s'", m.Kind, html.EscapeString(m.DWARF), html.EscapeString(m.Pclntab))
+			}
+		}
+		return ""
+	}
+}
+
+var pclnCheckTmpl = template.Must(template.New("pccheck").Parse(`<!doctype html>
+<html>
+<head>
+<title>DWARF and pclntab consistency</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>DWARF and <a href="/pclntab/">pclntab</a> consistency</h3>
+{{if .Report}}{{with .Report}}
+<table class='dwarftbl'>
+<tr><td>Functions checked</td><td>{{.Checked}}</td></tr>
+<tr><td>Functions with differences</td><td>{{len .Funcs}}</td></tr>
+<tr><td>Ranges with a different file:line</td><td>{{.Lines}}</td></tr>
+<tr><td>Ranges with a different CFA</td><td>{{.CFAs}}</td></tr>
+<tr><td>Functions only in pclntab</td><td>{{len .OnlyPcln}}</td></tr>
+<tr><td>Functions only in DWARF</td><td>{{len .OnlyDWARF}}</td></tr>
+</table>
+{{end}}{{end}}
+{{range .Funcs}}
+<hr/>
+<h4><a href="/pccheck/{{.F.Entry | printf "%x"}}">{{.F.Name}}</a> {{with .F.DIE}}(<a href="/{{.}}">&lt;{{.}}&gt;</a>){{end}}</h4>
+{{if .Mismatches}}
+<tt><table class='dwarftbl'>
+<tr><th>Range</th><th></th><th>DWARF</th><th>pclntab</th></tr>
+{{range .Mismatches}}<tr><td>{{.Start | printf "%#x"}}-{{.End | printf "%#x"}}</td><td>{{.Kind}}</td><td>{{.DWARF}}</td><td>{{.Pclntab}}</td></tr>
+{{end}}
+</table></tt>
+{{else}}
+<p>No differences.</p>
+{{end}}
+{{end}}
+{{with .Report}}
+{{if .OnlyPcln}}
+<hr/>
+<h4>Functions only in pclntab</h4>
+<tt><table class='dwarftbl'>
+{{range .OnlyPcln}}<tr><td><a href="/pcfunc/{{.Entry | printf "%x"}}">{{.Entry | printf "%#x"}}</a></td><td>{{.Name}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+{{if .OnlyDWARF}}
+<hr/>
+<h4>Functions only in DWARF</h4>
+<tt><table class='dwarftbl'>
+{{range .OnlyDWARF}}<tr><td><a href="/{{.Off | printf "%x"}}">{{.Addr | printf "%#x"}}</a></td><td>{{.Name}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// pclnCheckHandler shows the consistency report of the function at the
+// given entry point, or of the whole executable.
+func pclnCheckHandler(w http.ResponseWriter, r *http.Request) {
+	pc := address(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := pclntab()
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var data struct {
+		Report *pclnReport
+		Funcs  []*funcCheck
+	}
+	if pc == 0 {
+		data.Report = checkPclntab()
+		data.Funcs = data.Report.Funcs
+	} else {
+		f := t.funcAt(pc)
+		if f == nil {
+			http.NotFound(w, r)
+			return
+		}
+		data.Funcs = []*funcCheck{{f, t.checkFunc(f)}}
+	}
+	must(pclnCheckTmpl.Execute(w, data))
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Go runtime function table (pclntab), see src/runtime/symtab.go and
+// src/cmd/link/internal/ld/pcln.go in the Go source tree.
+
+var Pclntab []byte
+
+const (
+	go12magic  = 0xfffffffb
+	go116magic = 0xfffffffa
+	go118magic = 0xfffffff0
+	go120magic = 0xfffffff1
+)
+
+type pclnTable struct {
+	Magic            uint32
+	Version          string
+	Quantum, PtrSize int
+	NFunc, NFiles    uint64
+	TextStart        uint64
+	TextStartHdr     uint64       // value of textStart in the header
+	Offsets          []pclnOffset // offsets of the subtables
+	Funcs            []*pclnFunc
+	Files            []pclnFile
+	Err              string
+
+	data        []byte
+	funcnametab []byte
+	cutab       []byte
+	filetab     []byte
+	pctab       []byte
+	funcdata    []byte // the _func records are read from here
+}
+
+type pclnOffset struct {
+	Name string
+	Off  uint64
+}
+
+type pclnFile struct {
+	Off  int
+	Name string
+}
+
+// pclnFunc is a _func record.
+type pclnFunc struct {
+	Off         int // offset of the record
+	Entry, End  uint64
+	Name        string
+	Args        int32
+	Deferreturn uint32
+	StartLine   int32
+	FuncID      uint8
+	Flag        uint8
+	CUOffset    uint32
+	Pcsp        uint32
+	Pcfile      uint32
+	Pcln        uint32
+	Pcdata      []uint32
+	Funcdata    []uint64
+}
+
+// pcRange is a row of a pc-value table, val holds in [Start, End).
+type pcRange struct {
+	Start, End uint64
+	Val        int32
+}
+
+var pcln *pclnTable
+
+func init() {
+	onReset(func() {
+		Pclntab, pcln = nil, nil
+	})
+}
+
+// pclntab returns the decoded runtime function table, or nil if the
+// executable does not have one.
+func pclntab() *pclnTable {
+	if pcln == nil && Pclntab != nil {
+		pcln = readPclntab(Pclntab)
+	}
+	return pcln
+}
+
+func loadPclntabElf(file *elf.File) {
+	if sect := file.Section(".gopclntab"); sect != nil && sect.Type != elf.SHT_NOBITS {
+		Pclntab, _ = sect.Data()
+	}
+}
+
+func loadPclntabMacho(file *macho.File) {
+	if sect := file.Section("__gopclntab"); sect != nil {
+		Pclntab, _ = sect.Data()
+	}
+}
+
+// loadPclntabPE reads the table between the runtime.pclntab and
+// runtime.epclntab symbols, PE executables do not have a separate section
+// for it.
+func loadPclntabPE(file *pe.File) {
+	var start, end *pe.Symbol
+	for _, sym := range file.Symbols {
+		switch sym.Name {
+		case "runtime.pclntab":
+			start = sym
+		case "runtime.epclntab":
+			end = sym
+		}
+	}
+	if start == nil || end == nil || start.SectionNumber != end.SectionNumber || start.SectionNumber <= 0 || int(start.SectionNumber) > len(file.Sections) || start.Value > end.Value {
+		return
+	}
+	data, err := file.Sections[start.SectionNumber-1].Data()
+	if err != nil || int(end.Value) > len(data) {
+		return
+	}
+	Pclntab = data[start.Value:end.Value]
+}
+
+func readPclntab(data []byte) *pclnTable {
+	t := &pclnTable{data: data}
+	if len(data) < 8 || data[4] != 0 || data[5] != 0 {
+		t.Err = "bad header"
+		return t
+	}
+	b := &lineBuf{data: data, bo: Arch.ByteOrder}
+	t.Magic = b.u32()
+	b.u16()
+	t.Quantum, t.PtrSize = int(b.u8()), int(b.u8())
+	if (t.Quantum != 1 && t.Quantum != 2 && t.Quantum != 4) || (t.PtrSize != 4 && t.PtrSize != 8) {
+		t.Err = fmt.Sprintf("bad header (quantum %d, pointer size %d)", t.Quantum, t.PtrSize)
+		return t
+	}
+	word := func() uint64 { return b.uint(t.PtrSize) }
+	sub := func(name string, off uint64) []byte {
+		t.Offsets = append(t.Offsets, pclnOffset{name, off})
+		if off > uint64(len(data)) {
+			t.Err = fmt.Sprintf("%s offset %#x is past the end of the table", name, off)
+			return nil
+		}
+		return data[off:]
+	}
+
+	var functab []byte
+	switch t.Magic {
+	case go12magic:
+		t.Version = "Go 1.2"
+		t.NFunc = word()
+		if t.NFunc > uint64(len(data)) {
+			t.Err = "function table is truncated"
+			return t
+		}
+		t.funcnametab, t.pctab, t.funcdata = data, data, data
+		functab = data[b.off:]
+		b.off += int(t.NFunc*2+1) * t.PtrSize
+		if fileOff := b.u32(); !b.eof {
+			t.filetab = sub("filetab", uint64(fileOff))
+		}
+	case go116magic, go118magic, go120magic:
+		t.Version = map[uint32]string{go116magic: "Go 1.16", go118magic: "Go 1.18", go120magic: "Go 1.20"}[t.Magic]
+		t.NFunc, t.NFiles = word(), word()
+		if t.Magic != go116magic {
+			t.TextStartHdr = word()
+			// the field is not relocated and, since Go 1.22, always 0
+			t.TextStart = goTextStart()
+		}
+		funcnameOff, cuOff, filetabOff, pctabOff, pclnOff := word(), word(), word(), word(), word()
+		t.funcnametab = sub("funcnametab", funcnameOff)
+		t.cutab = sub("cutab", cuOff)
+		t.filetab = sub("filetab", filetabOff)
+		t.pctab = sub("pctab", pctabOff)
+		t.funcdata = sub("functab", pclnOff)
+		functab = t.funcdata
+	default:
+		t.Err = fmt.Sprintf("unknown magic number %#x", t.Magic)
+		return t
+	}
+	if b.eof {
+		t.Err = "header is truncated"
+	}
+	if t.Err != "" {
+		return t
+	}
+
+	t.readFuncs(functab)
+	t.readFiles()
+	return t
+}
+
+func (t *pclnTable) HasTextStart() bool {
+	return t.Magic == go118magic || t.Magic == go120magic
+}
+
+// goTextStart returns the address of runtime.text.
+func goTextStart() uint64 {
+	for _, sym := range tableSymbols {
+		if sym.Name == "runtime.text" {
+			return sym.Addr
+		}
+	}
+	for _, sect := range TextSections {
+		if sect.Name == ".text" || sect.Name == "__TEXT,__text" {
+			return sect.Addr
+		}
+	}
+	return 0
+}
+
+// readFuncs reads the function table and the _func record of every
+// function.
+func (t *pclnTable) readFuncs(functab []byte) {
+	fb := &lineBuf{data: functab, bo: Arch.ByteOrder}
+	field := func() uint64 {
+		if t.Magic == go12magic || t.Magic == go116magic {
+			return fb.uint(t.PtrSize)
+		}
+		return uint64(fb.u32())
+	}
+	if t.NFunc > uint64(len(functab)) {
+		t.Err = "function table is truncated"
+		return
+	}
+	entries := make([]uint64, 0, t.NFunc+1)
+	offs := make([]uint64, 0, t.NFunc)
+	for i := uint64(0); i < t.NFunc && !fb.eof; i++ {
+		entries = append(entries, field())
+		offs = append(offs, field())
+	}
+	entries = append(entries, field())
+	if fb.eof {
+		t.Err = "function table is truncated"
+		return
+	}
+	for i := range entries {
+		entries[i] += t.TextStart
+	}
+	for i, off := range offs {
+		f := t.readFunc(int(off))
+		if f == nil {
+			t.Err = fmt.Sprintf("_func record of function %d at %#x is truncated", i, off)
+			return
+		}
+		f.End = entries[i+1]
+		if f.Entry != entries[i] && t.Err == "" {
+			t.Err = fmt.Sprintf("entry of %s is %#x in the function table and %#x in its _func record", f.Name, entries[i], f.Entry)
+		}
+		t.Funcs = append(t.Funcs, f)
+	}
+}
+
+func (t *pclnTable) readFunc(off int) *pclnFunc {
+	b := &lineBuf{data: t.funcdata, off: off, bo: Arch.ByteOrder}
+	f := &pclnFunc{Off: off}
+	if t.Magic == go12magic || t.Magic == go116magic {
+		f.Entry = b.uint(t.PtrSize)
+	} else {
+		f.Entry = t.TextStart + uint64(b.u32())
+	}
+	nameOff := b.u32()
+	f.Args = int32(b.u32())
+	f.Deferreturn = b.u32()
+	f.Pcsp, f.Pcfile, f.Pcln = b.u32(), b.u32(), b.u32()
+	npcdata := b.u32()
+	if t.Magic != go12magic {
+		f.CUOffset = b.u32()
+	}
+	if t.Magic == go120magic {
+		f.StartLine = int32(b.u32())
+	}
+	f.FuncID, f.Flag = b.u8(), b.u8()
+	b.u8()
+	nfuncdata := b.u8()
+	for i := uint32(0); i < npcdata && !b.eof; i++ {
+		f.Pcdata = append(f.Pcdata, b.u32())
+	}
+	if t.Magic == go12magic || t.Magic == go116magic {
+		// funcdata are pointers, aligned to the pointer size
+		if b.off%t.PtrSize != 0 {
+			b.off += t.PtrSize - b.off%t.PtrSize
+		}
+		for i := uint8(0); i < nfuncdata && !b.eof; i++ {
+			f.Funcdata = append(f.Funcdata, b.uint(t.PtrSize))
+		}
+	} else {
+		// funcdata are offsets from go:func.*, ^0 means no data
+		for i := uint8(0); i < nfuncdata && !b.eof; i++ {
+			f.Funcdata = append(f.Funcdata, uint64(b.u32()))
+		}
+	}
+	if b.eof {
+		return nil
+	}
+	if int(nameOff) < len(t.funcnametab) {
+		f.Name = cstrAt(t.funcnametab, uint64(nameOff))
+	}
+	return f
+}
+
+// readFiles reads the file table, for Go 1.16 and later it is the list of
+// strings of filetab, compilation units select their files through cutab.
+func (t *pclnTable) readFiles() {
+	if t.Magic == go12magic {
+		b := &lineBuf{data: t.filetab, bo: Arch.ByteOrder}
+		t.NFiles = uint64(b.u32())
+		for i := uint64(1); i < t.NFiles && !b.eof; i++ {
+			off := b.u32()
+			t.Files = append(t.Files, pclnFile{int(off), cstrAt(t.data, uint64(off))})
+		}
+		return
+	}
+	for off := 0; off < len(t.filetab) && uint64(len(t.Files)) < t.NFiles; {
+		name := cstrAt(t.filetab, uint64(off))
+		t.Files = append(t.Files, pclnFile{off, name})
+		off += len(name) + 1
+	}
+}
+
+// fileName returns the name of file number i of function f.
+func (t *pclnTable) fileName(f *pclnFunc, i int32) string {
+	if i < 0 {
+		return "?"
+	}
+	if t.Magic == go12magic {
+		if i == 0 || int(i) > len(t.Files) {
+			return "?"
+		}
+		return t.Files[i-1].Name
+	}
+	off := (uint64(f.CUOffset) + uint64(i)) * 4
+	if off+4 > uint64(len(t.cutab)) {
+		return "?"
+	}
+	fileOff := Arch.ByteOrder.Uint32(t.cutab[off:])
+	if fileOff == ^uint32(0) || fileOff >= uint32(len(t.filetab)) {
+		return "?"
+	}
+	return cstrAt(t.filetab, uint64(fileOff))
+}
+
+// pcvalue decodes the pc-value table at off of pctab for function f.
+func (t *pclnTable) pcvalue(f *pclnFunc, off uint32) []pcRange {
+	if off == 0 || int(off) >= len(t.pctab) {
+		return nil
+	}
+	b := &lineBuf{data: t.pctab, off: int(off), bo: Arch.ByteOrder}
+	var r []pcRange
+	pc, val := f.Entry, int32(-1)
+	for first := true; ; first = false {
+		uvdelta := b.uleb()
+		if b.eof || (uvdelta == 0 && !first) {
+			break
+		}
+		if uvdelta&1 != 0 {
+			uvdelta = ^(uvdelta >> 1)
+		} else {
+			uvdelta >>= 1
+		}
+		val += int32(uvdelta)
+		pcdelta := b.uleb()
+		if b.eof {
+			break
+		}
+		r = append(r, pcRange{pc, pc + pcdelta*uint64(t.Quantum), val})
+		pc += pcdelta * uint64(t.Quantum)
+		if pc > f.End && f.End != 0 {
+			break
+		}
+	}
+	return r
+}
+
+// funcAt returns the function with entry point pc.
+func (t *pclnTable) funcAt(pc uint64) *pclnFunc {
+	i := sort.Search(len(t.Funcs), func(i int) bool { return t.Funcs[i].Entry >= pc })
+	if i < len(t.Funcs) && t.Funcs[i].Entry == pc {
+		return t.Funcs[i]
+	}
+	return nil
+}
+
+var pcdataNames = []string{"PCDATA_UnsafePoint", "PCDATA_StackMapIndex", "PCDATA_InlTreeIndex", "PCDATA_ArgLiveIndex"}
+
+var funcdataNames = []string{"FUNCDATA_ArgsPointerMaps", "FUNCDATA_LocalsPointerMaps", "FUNCDATA_StackObjects", "FUNCDATA_InlTree", "FUNCDATA_OpenCodedDeferInfo", "FUNCDATA_ArgInfo", "FUNCDATA_ArgLiveInfo", "FUNCDATA_WrapInfo"}
+
+func tableName(names []string, prefix string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("%s%d", prefix, i)
+}
+
+func (f *pclnFunc) Flags() string {
+	var s []string
+	for i, name := range []string{"TOPFRAME", "SPWRITE", "ASM"} {
+		if f.Flag&(1<<i) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// pclnTables returns the pc-value tables of f: pcsp, pcfile, pcln and
+// every pcdata table.
+func (t *pclnTable) pclnTables(f *pclnFunc) (names []string, tables [][]pcRange) {
+	names = []string{"pcsp", "pcfile", "pcln"}
+	tables = [][]pcRange{t.pcvalue(f, f.Pcsp), t.pcvalue(f, f.Pcfile), t.pcvalue(f, f.Pcln)}
+	for i, off := range f.Pcdata {
+		names = append(names, tableName(pcdataNames, "PCDATA_", i))
+		tables = append(tables, t.pcvalue(f, off))
+	}
+	return names, tables
+}
+
+// fmtPcValue describes the value v of the i-th table returned by
+// pclnTables.
+func (t *pclnTable) fmtPcValue(f *pclnFunc, i int, v int32) string {
+	switch i {
+	case 0:
+		return fmt.Sprintf("%#x", v)
+	case 1:
+		return fmt.Sprintf("%d %s", v, html.EscapeString(t.fileName(f, v)))
+	}
+	return fmt.Sprint(v)
+}
+
+// pclnColumns prints the header cells of the pc-value tables of the
+// function starting at pc in the disassembly, it returns a function that
+// prints the cells for each instruction.
+func pclnColumns(out io.Writer, pc uint64) func(pc uint64) {
+	t := pclntab()
+	if t == nil {
+		return func(uint64) {}
+	}
+	f := t.funcAt(pc)
+	if f == nil {
+		return func(uint64) {}
+	}
+	names, tables := t.pclnTables(f)
+	for _, name := range names {
+		fmt.Fprintf(out, "<td><a href='/pcfunc/%x' target='_top'>%s</a></td>", f.Entry, name)
+	}
+	return func(pc uint64) {
+		for i, tbl := range tables {
+			v, ok := pcValueAt(tbl, pc)
+			switch {
+			case !ok:
+				fmt.Fprintf(out, "<td></td>")
+			case i == 1:
+				fmt.Fprintf(out, "<td>%s</td>", html.EscapeString(filepath.Base(t.fileName(f, v))))
+			default:
+				fmt.Fprintf(out, "<td>%s</td>", t.fmtPcValue(f, i, v))
+			}
+		}
+	}
+}
+
+// DIE returns the subprogram of the DWARF info with the same entry point
+// as f.
+func (f *pclnFunc) DIE() string {
+	i := sort.Search(len(Symbols), func(i int) bool { return Symbols[i].Addr >= f.Entry })
+	for ; i < len(Symbols) && Symbols[i].Addr == f.Entry; i++ {
+		if Symbols[i].HasDIE() {
+			return fmt.Sprintf("%x", Symbols[i].Off)
+		}
+	}
+	return ""
+}
+
+var pclntabTmpl = template.Must(template.New("pclntab").Parse(`<!doctype html>
+<html>
+<head>
+<title>Go function table</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>Go function table (pclntab)</h3>
+<table class='dwarftbl'>
+<tr><td>Format</td><td>{{.Version}} (magic {{.Magic | printf "%#x"}})</td></tr>
+<tr><td>Instruction size quantum</td><td>{{.Quantum}}</td></tr>
+<tr><td>Pointer size</td><td>{{.PtrSize}}</td></tr>
+<tr><td>Functions</td><td>{{.NFunc}}</td></tr>
+<tr><td>Files</td><td>{{.NFiles}}</td></tr>
+{{if .HasTextStart}}<tr><td>Text start</td><td>{{.TextStart | printf "%#x"}} (header {{.TextStartHdr | printf "%#x"}})</td></tr>{{end}}
+{{range .Offsets}}<tr><td>{{.Name}} offset</td><td>{{.Off | printf "%#x"}}</td></tr>
+{{end}}
+{{if .Err}}<tr><td>Problems</td><td><b>{{.Err}}</b></td></tr>{{end}}
+</table>
+<a href="#files">&gt;&gt; File table</a><br/>
+<a href="/pccheck/">&gt;&gt; Consistency with DWARF</a>
+<hr/>
+<tt><table class='dwarftbl'>
+<tr><th>Entry</th><th>End</th><th>_func</th><th>Name</th><th>Args</th><th>Deferreturn</th><th>Start line</th><th>FuncID</th><th>Flags</th><th>DWARF</th></tr>
+{{range .Funcs}}<tr><td><a href="/pcfunc/{{.Entry | printf "%x"}}">{{.Entry | printf "%#x"}}</a></td><td>{{.End | printf "%#x"}}</td><td>{{.Off | printf "%#x"}}</td><td>{{.Name}}</td><td>{{.Args}}</td><td>{{.Deferreturn | printf "%#x"}}</td><td>{{.StartLine}}</td><td>{{.FuncID}}</td><td>{{.Flags}}</td><td>{{with .DIE}}<a href="/{{.}}">&lt;{{.}}&gt;</a>{{end}}</td></tr>
+{{end}}
+</table></tt>
+<hr/>
+<h4><a name="files"></a>File table</h4>
+<tt><table class='dwarftbl'>
+<tr><th>Offset</th><th>Name</th></tr>
+{{range .Files}}<tr><td>{{.Off | printf "%#x"}}</td><td>{{.Name}}</td></tr>
+{{end}}
+</table></tt>
+</body>
+</html>
+`))
+
+func pclntabHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := pclntab()
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	must(pclntabTmpl.Execute(w, t))
+}
+
+type pcTableRow struct {
+	Start, End uint64
+	Val        template.HTML
+}
+
+type pcTable struct {
+	Name string
+	Off  uint32
+	Rows []pcTableRow
+}
+
+var pcfuncTmpl = template.Must(template.New("pcfunc").Parse(`<!doctype html>
+<html>
+<head>
+<title>{{.F.Name}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3><a href="/pclntab/">pclntab</a> entry of {{.F.Name}}</h3>
+<table class='dwarftbl'>
+<tr><td>Entry</td><td>{{.F.Entry | printf "%#x"}}-{{.F.End | printf "%#x"}}</td></tr>
+<tr><td>_func offset</td><td>{{.F.Off | printf "%#x"}}</td></tr>
+<tr><td>Args</td><td>{{.F.Args}}</td></tr>
+<tr><td>Deferreturn</td><td>{{.F.Deferreturn | printf "%#x"}}</td></tr>
+<tr><td>Start line</td><td>{{.F.StartLine}}</td></tr>
+<tr><td>FuncID</td><td>{{.F.FuncID}}</td></tr>
+<tr><td>Flags</td><td>{{.F.Flag | printf "%#x"}} {{.F.Flags}}</td></tr>
+<tr><td>CU offset</td><td>{{.F.CUOffset}}</td></tr>
+{{with .F.DIE}}<tr><td>DWARF</td><td><a href="/{{.}}">&lt;{{.}}&gt;</a></td></tr>{{end}}
+</table>
+<a href="/pccheck/{{.F.Entry | printf "%x"}}">&gt;&gt; Consistency with DWARF</a>
+<h4>Funcdata</h4>
+<tt><table class='dwarftbl'>
+{{range .Funcdata}}<tr><td>{{.Name}}</td><td>{{.Off | printf "%#x"}}</td></tr>
+{{end}}
+</table></tt>
+{{range .Tables}}
+<h4>{{.Name}} (offset {{.Off | printf "%#x"}})</h4>
+<tt><table class='dwarftbl'>
+{{range .Rows}}<tr><td>{{.Start | printf "%#x"}}-{{.End | printf "%#x"}}</td><td>{{.Val}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+</body>
+</html>
+`))
+
+func pcfuncHandler(w http.ResponseWriter, r *http.Request) {
+	pc := address(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	t := pclntab()
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	f := t.funcAt(pc)
+	if f == nil {
+		http.NotFound(w, r)
+		return
+	}
+	names, tables := t.pclnTables(f)
+	offs := append([]uint32{f.Pcsp, f.Pcfile, f.Pcln}, f.Pcdata...)
+	var pcTables []pcTable
+	for i := range tables {
+		tbl := pcTable{Name: names[i], Off: offs[i]}
+		for _, rng := range tables[i] {
+			tbl.Rows = append(tbl.Rows, pcTableRow{rng.Start, rng.End, template.HTML(t.fmtPcValue(f, i, rng.Val))})
+		}
+		pcTables = append(pcTables, tbl)
+	}
+	var funcdata []pclnOffset
+	for i, off := range f.Funcdata {
+		funcdata = append(funcdata, pclnOffset{tableName(funcdataNames, "FUNCDATA_", i), off})
+	}
+	must(pcfuncTmpl.Execute(w, struct {
+		F        *pclnFunc
+		Funcdata []pclnOffset
+		Tables   []pcTable
+	}{f, funcdata, pcTables}))
+}
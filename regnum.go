@@ -0,0 +1,61 @@
+package main
+
+import "fmt"
+
+// Register names for architectures not covered by delve's regnum package.
+
+var s390xFloatRegs = [16]int{0, 2, 4, 6, 1, 3, 5, 7, 8, 10, 12, 14, 9, 11, 13, 15}
+
+func S390XToName(num uint64) string {
+	switch {
+	case num <= 15:
+		return fmt.Sprintf("R%d", num)
+	case num <= 31:
+		return fmt.Sprintf("F%d", s390xFloatRegs[num-16])
+	case num <= 47:
+		return fmt.Sprintf("C%d", num-32)
+	case num <= 63:
+		return fmt.Sprintf("A%d", num-48)
+	case num == 64:
+		return "PSWM"
+	case num == 65:
+		return "PSWA"
+	default:
+		return fmt.Sprintf("Unknown%d", num)
+	}
+}
+
+var mipsGPRNames = [32]string{
+	"ZERO", "AT", "V0", "V1", "A0", "A1", "A2", "A3",
+	"T0", "T1", "T2", "T3", "T4", "T5", "T6", "T7",
+	"S0", "S1", "S2", "S3", "S4", "S5", "S6", "S7",
+	"T8", "T9", "K0", "K1", "GP", "SP", "FP", "RA",
+}
+
+func MIPSToName(num uint64) string {
+	switch {
+	case num <= 31:
+		return mipsGPRNames[num]
+	case num <= 63:
+		return fmt.Sprintf("F%d", num-32)
+	case num == 64:
+		return "HI"
+	case num == 65:
+		return "LO"
+	default:
+		return fmt.Sprintf("Unknown%d", num)
+	}
+}
+
+func ARMToName(num uint64) string {
+	switch {
+	case num <= 15:
+		return fmt.Sprintf("R%d", num)
+	case num >= 64 && num <= 95:
+		return fmt.Sprintf("S%d", num-64)
+	case num >= 256 && num <= 287:
+		return fmt.Sprintf("D%d", num-256)
+	default:
+		return fmt.Sprintf("Unknown%d", num)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"os"
+
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+// objectBaseAddr is the address of the first section of a relocatable
+// object file, it is not 0 so that small immediates in the disassembly are
+// not mistaken for addresses.
+const objectBaseAddr = 0x10000
+
+// layoutObjectElf assigns an address to each allocated section of a
+// relocatable object file, where they are all at address 0, so that
+// functions in different sections do not overlap.
+func layoutObjectElf(file *elf.File) {
+	addr := uint64(objectBaseAddr)
+	for _, sect := range file.Sections {
+		if sect.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		if sect.Addralign > 1 {
+			addr = (addr + sect.Addralign - 1) &^ (sect.Addralign - 1)
+		}
+		sect.Addr = addr
+		addr += sect.Size
+	}
+}
+
+// elfSymbolAddr returns the address of sym, for relocatable object files
+// this is the address assigned to its section by layoutObjectElf plus its
+// value.
+func elfSymbolAddr(file *elf.File, sym *elf.Symbol) uint64 {
+	if file.Type == elf.ET_REL && sym.Section < elf.SHN_LORESERVE && int(sym.Section) < len(file.Sections) {
+		return file.Sections[sym.Section].Addr + sym.Value
+	}
+	return sym.Value
+}
+
+// elfDWARF returns the DWARF data of file, for relocatable object files the
+// relocations of the debug sections are applied first.
+func elfDWARF(file *elf.File) (*dwarf.Data, error) {
+	if file.Type != elf.ET_REL {
+		return file.DWARF()
+	}
+	get := func(name string) []byte {
+		data, _ := GetDebugSectionElf(file, name)
+		return data
+	}
+	dw, err := dwarf.New(get("abbrev"), nil, nil, get("info"), get("line"), nil, get("ranges"), get("str"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"addr", "line_str", "str_offsets", "rnglists"} {
+		if data := get(name); data != nil {
+			if err := dw.AddSection(".debug_"+name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, sect := range file.Sections {
+		if sect.Name != ".debug_types" {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			return nil, err
+		}
+		if err := dw.AddTypes(fmt.Sprintf("types-%d", i), relocateElf(file, sect, data)); err != nil {
+			return nil, err
+		}
+	}
+	return dw, nil
+}
+
+type relocKind uint8
+
+const (
+	relocNone    relocKind = iota
+	relocAbs               // S + A
+	relocPCRel             // S + A - P
+	relocAdd               // location + S + A
+	relocSub               // location - S - A
+	relocSet               // S + A, only the bits covered by the size
+	relocSetULEB           // S + A, as ULEB128
+	relocSubULEB           // location - S - A, as ULEB128
+)
+
+type relocType struct {
+	kind relocKind
+	size int // in bytes, 0 for 6 bit relocations
+}
+
+var relocTypes = map[elf.Machine]map[uint32]relocType{
+	elf.EM_X86_64: {
+		uint32(elf.R_X86_64_NONE):     {relocNone, 0},
+		uint32(elf.R_X86_64_64):       {relocAbs, 8},
+		uint32(elf.R_X86_64_PC32):     {relocPCRel, 4},
+		uint32(elf.R_X86_64_32):       {relocAbs, 4},
+		uint32(elf.R_X86_64_32S):      {relocAbs, 4},
+		uint32(elf.R_X86_64_DTPOFF32): {relocAbs, 4},
+		uint32(elf.R_X86_64_DTPOFF64): {relocAbs, 8},
+		uint32(elf.R_X86_64_PC64):     {relocPCRel, 8},
+	},
+	elf.EM_AARCH64: {
+		uint32(elf.R_AARCH64_NONE):   {relocNone, 0},
+		uint32(elf.R_AARCH64_ABS64):  {relocAbs, 8},
+		uint32(elf.R_AARCH64_ABS32):  {relocAbs, 4},
+		uint32(elf.R_AARCH64_PREL64): {relocPCRel, 8},
+		uint32(elf.R_AARCH64_PREL32): {relocPCRel, 4},
+	},
+	elf.EM_RISCV: {
+		uint32(elf.R_RISCV_NONE):     {relocNone, 0},
+		uint32(elf.R_RISCV_RELAX):    {relocNone, 0},
+		uint32(elf.R_RISCV_64):       {relocAbs, 8},
+		uint32(elf.R_RISCV_32):       {relocAbs, 4},
+		uint32(elf.R_RISCV_32_PCREL): {relocPCRel, 4},
+		uint32(elf.R_RISCV_ADD8):     {relocAdd, 1},
+		uint32(elf.R_RISCV_ADD16):    {relocAdd, 2},
+		uint32(elf.R_RISCV_ADD32):    {relocAdd, 4},
+		uint32(elf.R_RISCV_ADD64):    {relocAdd, 8},
+		uint32(elf.R_RISCV_SUB8):     {relocSub, 1},
+		uint32(elf.R_RISCV_SUB16):    {relocSub, 2},
+		uint32(elf.R_RISCV_SUB32):    {relocSub, 4},
+		uint32(elf.R_RISCV_SUB64):    {relocSub, 8},
+		uint32(elf.R_RISCV_SUB6):     {relocSub, 0},
+		uint32(elf.R_RISCV_SET6):     {relocSet, 0},
+		uint32(elf.R_RISCV_SET8):     {relocSet, 1},
+		uint32(elf.R_RISCV_SET16):    {relocSet, 2},
+		uint32(elf.R_RISCV_SET32):    {relocSet, 4},
+		_R_RISCV_SET_ULEB128:         {relocSetULEB, 0},
+		_R_RISCV_SUB_ULEB128:         {relocSubULEB, 0},
+	},
+}
+
+const (
+	_R_RISCV_SET_ULEB128 = 60
+	_R_RISCV_SUB_ULEB128 = 61
+)
+
+// relocateElf returns a copy of data, the contents of section sect of the
+// relocatable object file, with its relocations applied.
+func relocateElf(file *elf.File, sect *elf.Section, data []byte) []byte {
+	if file.Type != elf.ET_REL {
+		return data
+	}
+	var relsect *elf.Section
+	for _, s := range file.Sections {
+		if (s.Type == elf.SHT_RELA || s.Type == elf.SHT_REL) && int(s.Info) < len(file.Sections) && file.Sections[s.Info] == sect {
+			relsect = s
+			break
+		}
+	}
+	if relsect == nil {
+		return data
+	}
+	rels, err := relsect.Data()
+	if err != nil {
+		return data
+	}
+	syms, _ := file.Symbols()
+	types := relocTypes[file.Machine]
+	if types == nil {
+		fmt.Fprintf(os.Stderr, "relocations for %s are not supported\n", file.Machine)
+		return data
+	}
+
+	data = append([]byte(nil), data...)
+	bo := file.ByteOrder
+	read := func(off uint64, sz int) uint64 {
+		switch sz {
+		case 1:
+			return uint64(data[off])
+		case 2:
+			return uint64(bo.Uint16(data[off:]))
+		case 4:
+			return uint64(bo.Uint32(data[off:]))
+		default:
+			return bo.Uint64(data[off:])
+		}
+	}
+	write := func(off uint64, sz int, v uint64) {
+		switch sz {
+		case 1:
+			data[off] = uint8(v)
+		case 2:
+			bo.PutUint16(data[off:], uint16(v))
+		case 4:
+			bo.PutUint32(data[off:], uint32(v))
+		default:
+			bo.PutUint64(data[off:], v)
+		}
+	}
+
+	is64 := file.Class == elf.ELFCLASS64
+	entsz := 8
+	if is64 {
+		entsz = 16
+	}
+	if relsect.Type == elf.SHT_RELA {
+		entsz += entsz / 2
+	}
+	unsupported := map[uint32]bool{}
+	for ; len(rels) >= entsz; rels = rels[entsz:] {
+		var off, symidx uint64
+		var typ uint32
+		var addend int64
+		if is64 {
+			off = bo.Uint64(rels)
+			info := bo.Uint64(rels[8:])
+			symidx, typ = info>>32, uint32(info)
+			if relsect.Type == elf.SHT_RELA {
+				addend = int64(bo.Uint64(rels[16:]))
+			}
+		} else {
+			off = uint64(bo.Uint32(rels))
+			info := bo.Uint32(rels[4:])
+			symidx, typ = uint64(info>>8), info&0xff
+			if relsect.Type == elf.SHT_RELA {
+				addend = int64(int32(bo.Uint32(rels[8:])))
+			}
+		}
+		rt, ok := types[typ]
+		if !ok {
+			unsupported[typ] = true
+			continue
+		}
+		var s uint64
+		if symidx > 0 && symidx <= uint64(len(syms)) {
+			s = elfSymbolAddr(file, &syms[symidx-1])
+		}
+		sa := s + uint64(addend)
+		if rt.size == 0 {
+			if off >= uint64(len(data)) {
+				continue
+			}
+		} else if off+uint64(rt.size) > uint64(len(data)) {
+			continue
+		}
+		if relsect.Type == elf.SHT_REL && rt.size > 0 && (rt.kind == relocAbs || rt.kind == relocPCRel || rt.kind == relocSet) {
+			// implicit addend
+			sa += read(off, rt.size)
+		}
+		switch rt.kind {
+		case relocAbs:
+			write(off, rt.size, sa)
+		case relocPCRel:
+			write(off, rt.size, sa-(sect.Addr+off))
+		case relocAdd:
+			write(off, rt.size, read(off, rt.size)+sa)
+		case relocSub:
+			if rt.size == 0 {
+				data[off] = data[off]&0xc0 | (data[off]-uint8(sa))&0x3f
+			} else {
+				write(off, rt.size, read(off, rt.size)-sa)
+			}
+		case relocSet:
+			if rt.size == 0 {
+				data[off] = data[off]&0xc0 | uint8(sa)&0x3f
+			} else {
+				write(off, rt.size, sa)
+			}
+		case relocSetULEB, relocSubULEB:
+			v, n := leb128.DecodeUnsigned(bytes.NewBuffer(data[off:]))
+			if rt.kind == relocSetULEB {
+				v = sa
+			} else {
+				v -= sa
+			}
+			putULEB128Padded(data[off:off+uint64(n)], v)
+		}
+	}
+	for typ := range unsupported {
+		fmt.Fprintf(os.Stderr, "%s: unsupported relocation type %d\n", sect.Name, typ)
+	}
+	return data
+}
+
+// putULEB128Padded encodes v as an ULEB128 using exactly len(buf) bytes.
+func putULEB128Padded(buf []byte, v uint64) {
+	for i := range buf {
+		buf[i] = byte(v & 0x7f)
+		v >>= 7
+		if i != len(buf)-1 {
+			buf[i] |= 0x80
+		}
+	}
+}
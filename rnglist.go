@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+var DebugRanges, DebugRnglists []byte
+
+func init() {
+	onReset(func() {
+		DebugRanges, DebugRnglists = nil, nil
+	})
+}
+
+const (
+	_DW_RLE_end_of_list   = 0x0
+	_DW_RLE_base_addressx = 0x1
+	_DW_RLE_startx_endx   = 0x2
+	_DW_RLE_startx_length = 0x3
+	_DW_RLE_offset_pair   = 0x4
+	_DW_RLE_base_address  = 0x5
+	_DW_RLE_start_end     = 0x6
+	_DW_RLE_start_length  = 0x7
+)
+
+// rangeList describes where the range list referenced by an attribute of an
+// entry is stored.
+type rangeList struct {
+	data      []byte // .debug_ranges or .debug_rnglists
+	off       int64
+	idx       int64 // index for DW_FORM_rnglistx, -1 otherwise
+	v5        bool
+	base      uint64 // base address of the compile unit
+	debugAddr *godwarf.DebugAddr
+}
+
+// rangeListFor returns the range list referenced by field f of an entry of
+// compile unit cu.
+func rangeListFor(cu *dwarf.Entry, f *dwarf.Field) *rangeList {
+	rl := &rangeList{idx: -1}
+	var rnglistsBase int64
+	skel := cu
+	if su := Dwarf.splitFor(cu.Offset); su != nil {
+		skel = su.Skeleton
+		rl.v5 = su.version >= 5
+		rl.debugAddr = su.debugAddr
+		if rl.v5 {
+			rl.data = su.rnglists
+			rnglistsBase = int64(len(su.rnglists) - len(skipSectionHeader(su.rnglists, 12)))
+		} else {
+			// pre-standard split units are relative to DW_AT_GNU_ranges_base
+			rl.data = DebugRanges
+			rl.off, _ = su.Skeleton.Val(_DW_AT_GNU_ranges_base).(int64)
+		}
+	} else {
+		rl.v5 = UnitVersions[cu.Offset] >= 5
+		rl.data = DebugRanges
+		if rl.v5 {
+			rl.data = DebugRnglists
+			rl.debugAddr = debugAddrFor(cu)
+			rnglistsBase, _ = cu.Val(dwarf.AttrRnglistsBase).(int64)
+		}
+	}
+	rl.base, _ = skel.Val(dwarf.AttrLowpc).(uint64)
+
+	switch f.Class {
+	case dwarf.ClassRangeListPtr:
+		rl.off += f.Val.(int64)
+	case dwarf.ClassRngList:
+		// debug/dwarf resolves DW_FORM_rnglistx to an offset relative to
+		// the start of the section, or of the offsets table for split units
+		rl.off = int64(f.Val.(uint64))
+		if Dwarf.splitFor(cu.Offset) != nil {
+			rl.off += rnglistsBase
+		}
+		rl.idx = rangeListIndex(rl.data, rnglistsBase, rl.off)
+	}
+	return rl
+}
+
+// rangeListIndex returns the index in the offsets table at base of the
+// range list at off.
+func rangeListIndex(data []byte, base, off int64) int64 {
+	offsz := listsOffsetSize(data, base)
+	for i := int64(0); base+(i+1)*offsz <= off && base+(i+1)*offsz <= int64(len(data)); i++ {
+		var x int64
+		if offsz == 8 {
+			x = int64(Arch.ByteOrder.Uint64(data[base+i*offsz:]))
+		} else {
+			x = int64(Arch.ByteOrder.Uint32(data[base+i*offsz:]))
+		}
+		if base+x == off {
+			return i
+		}
+	}
+	return -1
+}
+
+// rangeListPrint decodes the range list rl entry by entry.
+func rangeListPrint(rl *rangeList) string {
+	var out bytes.Buffer
+	if rl.off < 0 || rl.off >= int64(len(rl.data)) {
+		fmt.Fprintf(&out, "offset %#x outside of the section\n", rl.off)
+		return out.String()
+	}
+	if rl.v5 {
+		rnglistPrint5(&out, rl.data, rl.off, rl.base, rl.debugAddr)
+	} else {
+		rangesPrint4(&out, rl.data, rl.off, rl.base)
+	}
+	return out.String()
+}
+
+// rangesPrint4 decodes a .debug_ranges list, see DWARFv4 section 2.17.3.
+func rangesPrint4(out *bytes.Buffer, data []byte, off int64, base uint64) {
+	ptrsz := int64(Arch.PtrSize)
+	maxAddr := ^uint64(0) >> (64 - 8*ptrsz)
+	read := func(b []byte) uint64 {
+		if ptrsz == 4 {
+			return uint64(Arch.ByteOrder.Uint32(b))
+		}
+		return Arch.ByteOrder.Uint64(b)
+	}
+	for ; off+2*ptrsz <= int64(len(data)); off += 2 * ptrsz {
+		start, end := read(data[off:]), read(data[off+ptrsz:])
+		fmt.Fprintf(out, "%#x: ", off)
+		switch {
+		case start == 0 && end == 0:
+			fmt.Fprintf(out, "end of list\n")
+			return
+		case start == maxAddr:
+			base = end
+			fmt.Fprintf(out, "base address selection %#x\n", base)
+		default:
+			fmt.Fprintf(out, "%#x %#x => [%#x, %#x)\n", start, end, base+start, base+end)
+		}
+	}
+	fmt.Fprintf(out, "missing end of list\n")
+}
+
+// rnglistPrint5 decodes a .debug_rnglists list, see DWARFv5 section 2.17.3,
+// and returns the offset following it.
+func rnglistPrint5(out *bytes.Buffer, data []byte, off int64, base uint64, debugAddr *godwarf.DebugAddr) int64 {
+	buf := bytes.NewBuffer(data[off:])
+	readAddr := func() uint64 {
+		if buf.Len() < Arch.PtrSize {
+			buf.Next(Arch.PtrSize)
+			return 0
+		}
+		if Arch.PtrSize == 4 {
+			return uint64(Arch.ByteOrder.Uint32(buf.Next(4)))
+		}
+		return Arch.ByteOrder.Uint64(buf.Next(8))
+	}
+	getAddr := func(idx uint64) string {
+		if debugAddr == nil {
+			return "?"
+		}
+		addr, err := debugAddr.Get(idx)
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+		return fmt.Sprintf("%#x", addr)
+	}
+	uleb := func() uint64 {
+		v, _ := leb128.DecodeUnsigned(buf)
+		return v
+	}
+	for buf.Len() > 0 {
+		fmt.Fprintf(out, "%#x: ", len(data)-buf.Len())
+		opcode, _ := buf.ReadByte()
+		switch opcode {
+		case _DW_RLE_end_of_list:
+			fmt.Fprintf(out, "DW_RLE_end_of_list\n")
+			return int64(len(data) - buf.Len())
+		case _DW_RLE_base_addressx:
+			idx := uleb()
+			fmt.Fprintf(out, "DW_RLE_base_addressx %d => base address %s\n", idx, getAddr(idx))
+			if debugAddr != nil {
+				base, _ = debugAddr.Get(idx)
+			}
+		case _DW_RLE_startx_endx:
+			start, end := uleb(), uleb()
+			fmt.Fprintf(out, "DW_RLE_startx_endx %d %d => [%s, %s)\n", start, end, getAddr(start), getAddr(end))
+		case _DW_RLE_startx_length:
+			start, length := uleb(), uleb()
+			var s string
+			if debugAddr != nil {
+				if addr, err := debugAddr.Get(start); err == nil {
+					s = fmt.Sprintf(" => [%#x, %#x)", addr, addr+length)
+				}
+			}
+			fmt.Fprintf(out, "DW_RLE_startx_length %d %#x%s\n", start, length, s)
+		case _DW_RLE_offset_pair:
+			start, end := uleb(), uleb()
+			fmt.Fprintf(out, "DW_RLE_offset_pair %#x %#x => [%#x, %#x)\n", start, end, base+start, base+end)
+		case _DW_RLE_base_address:
+			base = readAddr()
+			fmt.Fprintf(out, "DW_RLE_base_address %#x\n", base)
+		case _DW_RLE_start_end:
+			start, end := readAddr(), readAddr()
+			fmt.Fprintf(out, "DW_RLE_start_end %#x %#x => [%#x, %#x)\n", start, end, start, end)
+		case _DW_RLE_start_length:
+			start := readAddr()
+			length := uleb()
+			fmt.Fprintf(out, "DW_RLE_start_length %#x %#x => [%#x, %#x)\n", start, length, start, start+length)
+		default:
+			fmt.Fprintf(out, "unknown opcode %#x\n", opcode)
+			return int64(len(data))
+		}
+	}
+	fmt.Fprintf(out, "missing DW_RLE_end_of_list\n")
+	return int64(len(data))
+}
+
+func fmtRangeListField(en *EntryNode, f *dwarf.Field) template.HTML {
+	cu := findCompileUnit(en)
+	if en.E.Tag == dwarf.TagCompileUnit || en.E.Tag == dwarf.TagSkeletonUnit {
+		cu = en.E
+	}
+	if cu == nil {
+		return template.HTML(fmt.Sprintf("<td>%s</td><td>%v</td>", f.Attr.String(), f.Val))
+	}
+	rl := rangeListFor(cu, f)
+	idx := ""
+	if rl.idx >= 0 {
+		idx = fmt.Sprintf("rnglistx = %#x, ", rl.idx)
+	}
+	return template.HTML(fmt.Sprintf("<td>%s</td><td><pre>%srangelistptr = %#x (<a href='#' onclick='toggleLoclist2(this)'>toggle</a>)</pre><pre class='loclist' style='display: none'>%s</pre></td>", f.Attr.String(), idx, rl.off, html.EscapeString(rangeListPrint(rl))))
+}
+
+// rnglistsUnit is the header of a contribution to .debug_rnglists.
+type rnglistsUnit struct {
+	Section       string
+	Off           int
+	Length        uint64
+	Dwarf64       bool
+	Version       uint16
+	AddrSize      uint8
+	SegSelSize    uint8
+	OffsetEntries []rnglistsOffset
+	Lists         []rnglistsOffset // lists of units without an offsets table
+	Unit          *dwarf.Entry     // compile unit using this offsets table
+	Err           string
+}
+
+type rnglistsOffset struct {
+	Off   uint64 // offset of the list relative to the start of the section
+	Dump  string
+	Index int
+}
+
+// readRnglistsUnits reads the headers and offsets tables of all the
+// contributions to a .debug_rnglists section.
+func readRnglistsUnits(section string, data []byte, unitFor func(base int64) *dwarf.Entry, debugAddrFor func(cu *dwarf.Entry) *godwarf.DebugAddr) []*rnglistsUnit {
+	var r []*rnglistsUnit
+	for off := 0; off < len(data); {
+		u := &rnglistsUnit{Section: section, Off: off}
+		r = append(r, u)
+		length, dwarf64, _, byteOrder := readDwarfLengthVersion(data[off:])
+		u.Length, u.Dwarf64 = length, dwarf64
+		hdrsz, offsz := 4, 4
+		if dwarf64 {
+			hdrsz, offsz = 12, 8
+		}
+		end := off + hdrsz + int(length)
+		if length == 0 || end > len(data) || off+hdrsz+8 > len(data) {
+			u.Err = "truncated unit"
+			break
+		}
+		b := data[off+hdrsz:]
+		u.Version = byteOrder.Uint16(b)
+		u.AddrSize, u.SegSelSize = b[2], b[3]
+		count := int(byteOrder.Uint32(b[4:]))
+		base := off + hdrsz + 8
+		u.Unit = unitFor(int64(base))
+		var base64 uint64
+		var debugAddr *godwarf.DebugAddr
+		if u.Unit != nil {
+			base64, _ = u.Unit.Val(dwarf.AttrLowpc).(uint64)
+			if su := Dwarf.splitFor(u.Unit.Offset); su != nil {
+				base64, _ = su.Skeleton.Val(dwarf.AttrLowpc).(uint64)
+			}
+			debugAddr = debugAddrFor(u.Unit)
+		}
+		for i := 0; i < count; i++ {
+			p := base + i*offsz
+			if p+offsz > end {
+				u.Err = "offsets table truncated"
+				break
+			}
+			var x uint64
+			if dwarf64 {
+				x = byteOrder.Uint64(data[p:])
+			} else {
+				x = uint64(byteOrder.Uint32(data[p:]))
+			}
+			o := rnglistsOffset{Off: uint64(base) + x, Index: i}
+			if o.Off < uint64(end) {
+				var out bytes.Buffer
+				rnglistPrint5(&out, data[:end], int64(o.Off), base64, debugAddr)
+				o.Dump = out.String()
+			}
+			u.OffsetEntries = append(u.OffsetEntries, o)
+		}
+		if count == 0 {
+			// lists are referenced by DW_FORM_sec_offset, decode them in order
+			for p := int64(base); p < int64(end); {
+				var out bytes.Buffer
+				next := rnglistPrint5(&out, data[:end], p, base64, debugAddr)
+				u.Lists = append(u.Lists, rnglistsOffset{Off: uint64(p), Dump: out.String(), Index: -1})
+				p = next
+			}
+		}
+		off = end
+	}
+	return r
+}
+
+var rnglistsTmpl = template.Must(template.New("rnglists").Parse(`<!doctype html>
+<html>
+<head>
+<title>.debug_rnglists</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+	.dwarftbl td pre {
+		margin-top: 0px;
+		margin-bottom: 0px;
+	}
+</style>
+</head>
+<body>
+<h3>.debug_rnglists</h3>
+{{if not .}}The executable has no .debug_rnglists section{{end}}
+{{range .}}
+<h4>{{.Section}} unit at {{.Off | printf "%#x"}}{{with .Unit}} used by <a href="/{{.Offset | printf "%x"}}">&lt;{{.Offset | printf "%x"}}&gt;</a>{{end}}</h4>
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<table class='dwarftbl'>
+<tr><td>Unit length</td><td>{{.Length}}{{if .Dwarf64}} (64-bit DWARF){{end}}</td></tr>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Address size</td><td>{{.AddrSize}}</td></tr>
+<tr><td>Segment selector size</td><td>{{.SegSelSize}}</td></tr>
+<tr><td>Offset entry count</td><td>{{len .OffsetEntries}}</td></tr>
+</table>
+{{with .OffsetEntries}}
+<table class='dwarftbl'>
+<tr><th>Index</th><th>Offset</th><th>Range list</th></tr>
+{{range .}}<tr><td>{{.Index}}</td><td>{{.Off | printf "%#x"}}</td><td><pre>{{.Dump}}</pre></td></tr>
+{{end}}
+</table>
+{{end}}
+{{with .Lists}}
+<table class='dwarftbl'>
+<tr><th>Offset</th><th>Range list</th></tr>
+{{range .}}<tr><td>{{.Off | printf "%#x"}}</td><td><pre>{{.Dump}}</pre></td></tr>
+{{end}}
+</table>
+{{end}}
+<hr/>
+{{end}}
+</body>
+</html>
+`))
+
+func rnglistsHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	units := readRnglistsUnits(".debug_rnglists", DebugRnglists, func(base int64) *dwarf.Entry {
+		for _, cu := range compileUnits {
+			if b, ok := cu.Val(dwarf.AttrRnglistsBase).(int64); ok && b == base && Dwarf.splitFor(cu.Offset) == nil {
+				return cu
+			}
+		}
+		return nil
+	}, debugAddrFor)
+	for _, su := range Dwarf.Splits {
+		if su.data == nil || su.version < 5 || len(su.rnglists) == 0 {
+			continue
+		}
+		cu := &dwarf.Entry{Offset: su.cuOff}
+		units = append(units, readRnglistsUnits(".debug_rnglists.dwo of "+su.Path, su.rnglists, func(int64) *dwarf.Entry { return cu }, func(*dwarf.Entry) *godwarf.DebugAddr { return su.debugAddr })...)
+	}
+	must(rnglistsTmpl.Execute(w, units))
+}
@@ -0,0 +1,793 @@
+package main
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Go runtime type descriptors (abi.Type, see src/internal/abi/type.go in
+// the Go source tree) referenced by DW_AT_go_runtime_type.
+
+// exeSection is an allocated section of the executable, its contents are
+// read the first time they are needed.
+type exeSection struct {
+	Name       string
+	Addr, Size uint64
+	read       func() ([]byte, error)
+	data       []byte
+}
+
+var exeSections []*exeSection
+
+func init() {
+	onReset(func() {
+		exeSections = nil
+	})
+}
+
+func addExeSection(name string, addr, size uint64, read func() ([]byte, error)) {
+	if addr == 0 || size == 0 {
+		return
+	}
+	exeSections = append(exeSections, &exeSection{Name: name, Addr: addr, Size: size, read: read})
+}
+
+func (sect *exeSection) load() []byte {
+	if sect.read != nil {
+		sect.data, _ = sect.read()
+		sect.read = nil
+	}
+	return sect.data
+}
+
+func loadExeSectionsElf(file *elf.File) {
+	for _, sect := range file.Sections {
+		if sect.Flags&elf.SHF_ALLOC != 0 && sect.Type != elf.SHT_NOBITS {
+			addExeSection(sect.Name, sect.Addr, sect.Size, sect.Data)
+		}
+	}
+}
+
+const _S_ZEROFILL = 0x1
+
+func loadExeSectionsMacho(file *macho.File) {
+	for _, sect := range file.Sections {
+		if sect.Flags&0xff != _S_ZEROFILL {
+			addExeSection(sect.Name, sect.Addr, sect.Size, sect.Data)
+		}
+	}
+}
+
+func loadExeSectionsPE(file *pe.File, imageBase uint64) {
+	for _, sect := range file.Sections {
+		size := sect.VirtualSize
+		if size == 0 || size > sect.Size {
+			// the rest of the section is zero filled
+			size = sect.Size
+		}
+		addExeSection(sect.Name, imageBase+uint64(sect.VirtualAddress), uint64(size), sect.Data)
+	}
+}
+
+// readExe returns n bytes of the executable at addr, or nil if they are
+// not contained in a section.
+func readExe(addr uint64, n int) []byte {
+	for _, sect := range exeSections {
+		if addr < sect.Addr || addr >= sect.Addr+sect.Size {
+			continue
+		}
+		data := sect.load()
+		off := addr - sect.Addr
+		if n < 0 || off+uint64(n) > uint64(len(data)) {
+			return nil
+		}
+		return data[off : off+uint64(n)]
+	}
+	return nil
+}
+
+const (
+	_TFlagUncommon       = 1 << 0
+	_TFlagExtraStar      = 1 << 1
+	_TFlagNamed          = 1 << 2
+	_TFlagRegularMemory  = 1 << 3
+	_TFlagGCMaskOnDemand = 1 << 4 // Go 1.24 and later
+	_TFlagDirectIface    = 1 << 5 // Go 1.26 and later
+
+	_KindDirectIface = 1 << 5 // before Go 1.26
+	_KindGCProg      = 1 << 6 // before Go 1.24
+	_KindMask        = (1 << 5) - 1
+
+	_NameFlagExported = 1 << 0
+	_NameFlagTag      = 1 << 1
+	_NameFlagPkgPath  = 1 << 2
+	_NameFlagEmbedded = 1 << 3 // Go 1.19 and later
+)
+
+var tflagNames = []string{"Uncommon", "ExtraStar", "Named", "RegularMemory", "GCMaskOnDemand", "DirectIface"}
+
+// goTypes describes how to read the runtime type descriptors of the
+// executable.
+type goTypes struct {
+	Types, Text  uint64 // nameOff and typeOff are relative to Types, textOff to Text
+	ETypes       uint64 // end of the type descriptors, 0 if unknown
+	Version      string
+	varintNames  bool // Go 1.17 and later
+	embeddedFlag bool // Go 1.19 and later, struct field offsets are not shifted
+	swissMaps    bool // Go 1.24 and later
+	gcOnDemand   bool // Go 1.24 and later, there are no GC programs
+}
+
+var rtypes *goTypes
+
+// rtypesFor returns the description of the runtime types of the executable,
+// or nil if it does not have any.
+func rtypesFor() *goTypes {
+	if rtypes != nil {
+		return rtypes
+	}
+	var types uint64
+	for _, name := range []string{"runtime.types", "type:*", "type.*"} {
+		for _, sym := range tableSymbols {
+			if sym.Name == name {
+				types = sym.Addr
+				break
+			}
+		}
+		if types != 0 {
+			break
+		}
+	}
+	if types == 0 || len(exeSections) == 0 {
+		return nil
+	}
+	var etypes uint64
+	for _, sym := range tableSymbols {
+		if sym.Name == "runtime.etypes" {
+			etypes = sym.Addr
+		}
+	}
+	producer := goProducer()
+	ver := ParseProducer(producer)
+	rtypes = &goTypes{
+		Types:        types,
+		Text:         goTextStart(),
+		ETypes:       etypes,
+		Version:      ver.String(),
+		varintNames:  ProducerAfterOrEqual(producer, 1, 17),
+		embeddedFlag: ProducerAfterOrEqual(producer, 1, 19),
+		swissMaps:    ProducerAfterOrEqual(producer, 1, 24),
+		gcOnDemand:   ProducerAfterOrEqual(producer, 1, 24),
+	}
+	return rtypes
+}
+
+// goProducer returns the producer of the first compile unit compiled by
+// the Go compiler, without the compiler flags.
+func goProducer() string {
+	for _, cu := range compileUnits {
+		if p, _ := cu.Val(dwarf.AttrProducer).(string); strings.HasPrefix(p, producerVersionPrefix) {
+			p, _, _ = strings.Cut(p, ";")
+			return p
+		}
+	}
+	return ""
+}
+
+// rtype is a decoded runtime type descriptor.
+type rtype struct {
+	Addr       uint64
+	Size       uint64
+	PtrBytes   uint64
+	Hash       uint32
+	TFlag      uint8
+	Align      uint8
+	FieldAlign uint8
+	KindByte   uint8
+	Equal      uint64
+	GCData     uint64
+	Str        int32
+	PtrToThis  int32
+	Name       string
+	GCMask     string
+
+	Len      uint64       // length of an array
+	Extra    []rtypeExtra // kind specific fields
+	Fields   []rtypeField // fields of a struct or methods of an interface
+	In, Out  []uint64     // parameters of a function
+	Uncommon uint64       // address of the uncommon type, 0 if there isn't one
+	PkgPath  string
+	Mcount   uint16
+	Xcount   uint16
+	Methods  []rtypeMethod
+
+	DIE      dwarf.Offset
+	Problems []string // differences with the DWARF type
+	Err      string
+}
+
+type rtypeExtra struct {
+	Name  string
+	Value template.HTML
+}
+
+type rtypeField struct {
+	Name     string
+	Tag      string
+	Typ      uint64
+	Offset   uint64
+	Embedded bool
+}
+
+type rtypeMethod struct {
+	Name     string
+	Exported bool
+	Mtyp     uint64
+	Ifn, Tfn uint64
+}
+
+func (t *rtype) Kind() reflect.Kind {
+	return reflect.Kind(t.KindByte & _KindMask)
+}
+
+func (t *rtype) Flags() string {
+	var r []string
+	for i, name := range tflagNames {
+		if t.TFlag&(1<<i) != 0 {
+			r = append(r, name)
+		}
+	}
+	return strings.Join(r, "|")
+}
+
+func (t *rtype) KindFlags() string {
+	var r []string
+	if t.KindByte&_KindDirectIface != 0 {
+		r = append(r, "DirectIface")
+	}
+	if t.KindByte&_KindGCProg != 0 {
+		r = append(r, "GCProg")
+	}
+	return strings.Join(r, "|")
+}
+
+func (gt *goTypes) typeOff(off int32) uint64 {
+	if off == 0 || off == -1 {
+		return 0
+	}
+	return gt.Types + uint64(int64(off))
+}
+
+// runtimeType returns the address of the runtime type referenced by the
+// value v of DW_AT_go_runtime_type, which is relative to runtime.types in
+// recent versions of Go.
+func (gt *goTypes) runtimeType(v uint64) uint64 {
+	if v == 0 || v >= gt.Types {
+		return v
+	}
+	return gt.Types + v
+}
+
+// isType returns true if addr is inside the type descriptors.
+func (gt *goTypes) isType(addr uint64) bool {
+	return addr >= gt.Types && (gt.ETypes == 0 || addr < gt.ETypes)
+}
+
+func (gt *goTypes) textOff(off int32) uint64 {
+	if off == -1 {
+		return 0
+	}
+	return gt.Text + uint64(int64(off))
+}
+
+// name reads the abi.Name at addr.
+func (gt *goTypes) name(addr uint64) (name, tag string, flags byte) {
+	b := readExe(addr, 1)
+	if b == nil {
+		return "", "", 0
+	}
+	flags = b[0]
+	addr++
+	str := func() string {
+		var n uint64
+		if gt.varintNames {
+			for shift := 0; ; shift += 7 {
+				c := readExe(addr, 1)
+				if c == nil || shift > 28 {
+					return ""
+				}
+				addr++
+				n |= uint64(c[0]&0x7f) << shift
+				if c[0]&0x80 == 0 {
+					break
+				}
+			}
+		} else {
+			c := readExe(addr, 2)
+			if c == nil {
+				return ""
+			}
+			addr += 2
+			n = uint64(c[0])<<8 | uint64(c[1])
+		}
+		s := readExe(addr, int(n))
+		addr += n
+		return string(s)
+	}
+	name = str()
+	if flags&_NameFlagTag != 0 {
+		tag = str()
+	}
+	return name, tag, flags
+}
+
+// typeName returns the name of the runtime type at addr.
+func (gt *goTypes) typeName(addr uint64) string {
+	p := Arch.PtrSize
+	hdr := readExe(addr, 4*p+16)
+	if hdr == nil {
+		return ""
+	}
+	b := &lineBuf{data: hdr, off: 2*p + 4, bo: Arch.ByteOrder}
+	tflag := b.u8()
+	b.off = 4*p + 8
+	name, _, _ := gt.name(gt.typeOff(int32(b.u32())))
+	if tflag&_TFlagExtraStar != 0 {
+		name = strings.TrimPrefix(name, "*")
+	}
+	return name
+}
+
+// readRtype decodes the runtime type descriptor at addr.
+func (gt *goTypes) readRtype(addr uint64) *rtype {
+	p := Arch.PtrSize
+	t := &rtype{Addr: addr}
+	hsize := 4*p + 16
+	hdr := readExe(addr, hsize)
+	if hdr == nil {
+		t.Err = fmt.Sprintf("address %#x is not contained in the executable", addr)
+		return t
+	}
+	b := &lineBuf{data: hdr, bo: Arch.ByteOrder}
+	t.Size = b.uint(p)
+	t.PtrBytes = b.uint(p)
+	t.Hash = b.u32()
+	t.TFlag, t.Align, t.FieldAlign, t.KindByte = b.u8(), b.u8(), b.u8(), b.u8()
+	t.Equal = b.uint(p)
+	t.GCData = b.uint(p)
+	t.Str = int32(b.u32())
+	t.PtrToThis = int32(b.u32())
+	t.Name, _, _ = gt.name(gt.typeOff(t.Str))
+	if t.TFlag&_TFlagExtraStar != 0 {
+		t.Name = strings.TrimPrefix(t.Name, "*")
+	}
+	t.GCMask = gt.gcMask(t)
+
+	align := func(n int) int { return (n + p - 1) &^ (p - 1) }
+	size := hsize // size of the kind specific type structure
+	b = &lineBuf{bo: Arch.ByteOrder}
+	read := func(n int) bool {
+		b.data, b.off = readExe(addr+uint64(hsize), n-hsize), 0
+		if b.data == nil {
+			t.Err = fmt.Sprintf("%s type at %#x is truncated", t.Kind(), addr)
+			return false
+		}
+		size = n
+		return true
+	}
+	extra := func(name string, v template.HTML) {
+		t.Extra = append(t.Extra, rtypeExtra{name, v})
+	}
+	ptr := func(name string) {
+		extra(name, gt.link(b.uint(p)))
+	}
+	var fn struct{ in, out int }
+	switch t.Kind() {
+	case reflect.Array:
+		if read(hsize + 3*p) {
+			ptr("Elem")
+			ptr("Slice")
+			t.Len = b.uint(p)
+			extra("Len", template.HTML(fmt.Sprint(t.Len)))
+		}
+	case reflect.Chan:
+		if read(hsize + 2*p) {
+			ptr("Elem")
+			dir := b.uint(p)
+			extra("Dir", template.HTML(fmt.Sprintf("%d (%s)", dir, reflect.ChanDir(dir))))
+		}
+	case reflect.Func:
+		if read(align(hsize + 4)) {
+			fn.in, fn.out = int(b.u16()), int(b.u16())
+			extra("InCount", template.HTML(fmt.Sprint(fn.in)))
+			extra("OutCount", template.HTML(fmt.Sprintf("%#x", fn.out)))
+			if fn.out&(1<<15) != 0 {
+				extra("Variadic", "true")
+				fn.out &^= 1 << 15
+			}
+		}
+	case reflect.Interface:
+		if read(hsize + 4*p) {
+			t.PkgPath, _, _ = gt.name(b.uint(p))
+			t.Fields = gt.imethods(b.uint(p), b.uint(p))
+		}
+	case reflect.Map:
+		n := hsize + 4*p + 8
+		if gt.swissMaps {
+			n = align(hsize + 7*p + 4)
+		}
+		if read(n) {
+			ptr("Key")
+			ptr("Elem")
+			if gt.swissMaps {
+				ptr("Group")
+			} else {
+				ptr("Bucket")
+			}
+			extra("Hasher", gt.codeLink(b.uint(p)))
+			if gt.swissMaps {
+				extra("GroupSize", template.HTML(fmt.Sprint(b.uint(p))))
+				extra("SlotSize", template.HTML(fmt.Sprint(b.uint(p))))
+				extra("ElemOff", template.HTML(fmt.Sprint(b.uint(p))))
+			} else {
+				extra("KeySize", template.HTML(fmt.Sprint(b.u8())))
+				extra("ValueSize", template.HTML(fmt.Sprint(b.u8())))
+				extra("BucketSize", template.HTML(fmt.Sprint(b.u16())))
+			}
+			extra("Flags", template.HTML(fmt.Sprintf("%#x", b.u32())))
+		}
+	case reflect.Pointer, reflect.Slice:
+		if read(hsize + p) {
+			ptr("Elem")
+		}
+	case reflect.Struct:
+		if read(hsize + 4*p) {
+			t.PkgPath, _, _ = gt.name(b.uint(p))
+			t.Fields = gt.fields(b.uint(p), b.uint(p))
+		}
+	}
+	if t.Err != "" {
+		return t
+	}
+
+	if t.TFlag&_TFlagUncommon != 0 {
+		t.Uncommon = addr + uint64(size)
+		u := readExe(t.Uncommon, 16)
+		if u == nil {
+			t.Err = fmt.Sprintf("uncommon type at %#x is truncated", t.Uncommon)
+			return t
+		}
+		b := &lineBuf{data: u, bo: Arch.ByteOrder}
+		t.PkgPath, _, _ = gt.name(gt.typeOff(int32(b.u32())))
+		t.Mcount, t.Xcount = b.u16(), b.u16()
+		moff := b.u32()
+		t.Methods = gt.methods(t.Uncommon+uint64(moff), int(t.Mcount))
+		size += 16
+	}
+
+	if t.Kind() == reflect.Func {
+		params := readExe(addr+uint64(size), (fn.in+fn.out)*p)
+		if params == nil {
+			t.Err = fmt.Sprintf("parameters of the function type at %#x are truncated", addr)
+			return t
+		}
+		b := &lineBuf{data: params, bo: Arch.ByteOrder}
+		for i := 0; i < fn.in; i++ {
+			t.In = append(t.In, b.uint(p))
+		}
+		for i := 0; i < fn.out; i++ {
+			t.Out = append(t.Out, b.uint(p))
+		}
+	}
+	return t
+}
+
+// gcMask returns the GC pointer bitmap of t, one bit for every pointer
+// sized word of its first PtrBytes bytes.
+func (gt *goTypes) gcMask(t *rtype) string {
+	switch {
+	case t.PtrBytes == 0:
+		return "no pointers"
+	case gt.gcOnDemand && t.TFlag&_TFlagGCMaskOnDemand != 0:
+		return "built at run time"
+	case !gt.gcOnDemand && t.KindByte&_KindGCProg != 0:
+		return fmt.Sprintf("GC program at %#x", t.GCData)
+	}
+	words := t.PtrBytes / uint64(Arch.PtrSize)
+	mask := readExe(t.GCData, int((words+7)/8))
+	if mask == nil {
+		return fmt.Sprintf("could not read %#x", t.GCData)
+	}
+	var buf strings.Builder
+	for i := uint64(0); i < words; i++ {
+		if mask[i/8]&(1<<(i%8)) != 0 {
+			buf.WriteByte('1')
+		} else {
+			buf.WriteByte('0')
+		}
+	}
+	return buf.String()
+}
+
+// fields reads the abi.StructField array of a struct type.
+func (gt *goTypes) fields(addr, n uint64) []rtypeField {
+	p := Arch.PtrSize
+	data := readExe(addr, int(n)*3*p)
+	if data == nil {
+		return nil
+	}
+	b := &lineBuf{data: data, bo: Arch.ByteOrder}
+	r := make([]rtypeField, n)
+	for i := range r {
+		f := &r[i]
+		var flags byte
+		f.Name, f.Tag, flags = gt.name(b.uint(p))
+		f.Typ = b.uint(p)
+		f.Offset = b.uint(p)
+		if gt.embeddedFlag {
+			f.Embedded = flags&_NameFlagEmbedded != 0
+		} else {
+			f.Embedded = f.Offset&1 != 0
+			f.Offset >>= 1
+		}
+	}
+	return r
+}
+
+// imethods reads the abi.Imethod array of an interface type.
+func (gt *goTypes) imethods(addr, n uint64) []rtypeField {
+	data := readExe(addr, int(n)*8)
+	if data == nil {
+		return nil
+	}
+	b := &lineBuf{data: data, bo: Arch.ByteOrder}
+	r := make([]rtypeField, n)
+	for i := range r {
+		r[i].Name, _, _ = gt.name(gt.typeOff(int32(b.u32())))
+		r[i].Typ = gt.typeOff(int32(b.u32()))
+	}
+	return r
+}
+
+// methods reads the abi.Method array of an uncommon type.
+func (gt *goTypes) methods(addr uint64, n int) []rtypeMethod {
+	data := readExe(addr, n*16)
+	if data == nil {
+		return nil
+	}
+	b := &lineBuf{data: data, bo: Arch.ByteOrder}
+	r := make([]rtypeMethod, n)
+	for i := range r {
+		m := &r[i]
+		var flags byte
+		m.Name, _, flags = gt.name(gt.typeOff(int32(b.u32())))
+		m.Exported = flags&_NameFlagExported != 0
+		m.Mtyp = gt.typeOff(int32(b.u32()))
+		m.Ifn = gt.textOff(int32(b.u32()))
+		m.Tfn = gt.textOff(int32(b.u32()))
+	}
+	return r
+}
+
+// link returns a link to the runtime type at addr.
+func (gt *goTypes) link(addr uint64) template.HTML {
+	if addr == 0 {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf("<a href=\"/rtype/%x\">%#x</a> %s", addr, addr, html.EscapeString(gt.typeName(addr))))
+}
+
+// codeLink describes the code address addr, linking to the entry of its
+// function.
+func (gt *goTypes) codeLink(addr uint64) template.HTML {
+	if addr == 0 {
+		return ""
+	}
+	var lup lookupper
+	name, _ := lup.lookup(addr)
+	if lup.sym != nil && lup.sym.HasDIE() {
+		return template.HTML(fmt.Sprintf("<a href=\"/%x\">%#x</a> %s", lup.sym.Off, addr, html.EscapeString(name)))
+	}
+	return template.HTML(fmt.Sprintf("%#x %s", addr, html.EscapeString(name)))
+}
+
+var rtypeDIEs map[uint64]dwarf.Offset
+
+func init() {
+	onReset(func() {
+		rtypes, rtypeDIEs = nil, nil
+	})
+}
+
+// rtypeDIE returns the DWARF type of the runtime type at addr.
+func (gt *goTypes) rtypeDIE(addr uint64) dwarf.Offset {
+	if rtypeDIEs == nil {
+		rtypeDIEs = map[uint64]dwarf.Offset{}
+		rdr := Dwarf.Reader()
+		for {
+			e, err := rdr.Next()
+			if err != nil || e == nil {
+				break
+			}
+			if v, ok := e.Val(_DW_AT_go_runtime_type).(uint64); ok {
+				rtypeDIEs[gt.runtimeType(v)] = e.Offset
+			}
+		}
+	}
+	return rtypeDIEs[addr]
+}
+
+// checkEntry compares the size and kind of t with the DWARF type e.
+func (t *rtype) checkEntry(e *dwarf.Entry) []string {
+	var r []string
+	if sz, ok := e.Val(dwarf.AttrByteSize).(int64); ok && uint64(sz) != t.Size {
+		r = append(r, fmt.Sprintf("size is %d in DWARF and %d in the runtime type", sz, t.Size))
+	}
+	if k, ok := e.Val(_DW_AT_go_kind).(int64); ok && reflect.Kind(k) != t.Kind() {
+		r = append(r, fmt.Sprintf("kind is %s in DWARF and %s in the runtime type", reflect.Kind(k), t.Kind()))
+	}
+	return r
+}
+
+// check compares t with the DWARF type en, including its children.
+func (t *rtype) check(en *EntryNode) []string {
+	r := t.checkEntry(en.E)
+	switch {
+	case en.E.Tag == dwarf.TagStructType && t.Kind() == reflect.Struct:
+		var members []*dwarf.Entry
+		for _, child := range en.Childs {
+			if child.E.Tag == dwarf.TagMember {
+				members = append(members, child.E)
+			}
+		}
+		if len(members) != len(t.Fields) {
+			r = append(r, fmt.Sprintf("%d members in DWARF and %d fields in the runtime type", len(members), len(t.Fields)))
+		}
+		for i := 0; i < len(members) && i < len(t.Fields); i++ {
+			name, _ := members[i].Val(dwarf.AttrName).(string)
+			f := &t.Fields[i]
+			if name != f.Name {
+				r = append(r, fmt.Sprintf("field %d is %q in DWARF and %q in the runtime type", i, name, f.Name))
+			}
+			if off, ok := members[i].Val(dwarf.AttrDataMemberLoc).(int64); ok && uint64(off) != f.Offset {
+				r = append(r, fmt.Sprintf("offset of field %s is %#x in DWARF and %#x in the runtime type", f.Name, off, f.Offset))
+			}
+		}
+	case en.E.Tag == dwarf.TagArrayType && t.Kind() == reflect.Array:
+		for _, child := range en.Childs {
+			if child.E.Tag != dwarf.TagSubrangeType {
+				continue
+			}
+			if n, ok := child.E.Val(dwarf.AttrCount).(int64); ok && uint64(n) != t.Len {
+				r = append(r, fmt.Sprintf("length is %d in DWARF and %d in the runtime type", n, t.Len))
+			}
+			break
+		}
+	}
+	return r
+}
+
+// fmtRuntimeType formats the value of DW_AT_go_runtime_type for the entry e.
+func fmtRuntimeType(e *dwarf.Entry, v uint64) string {
+	gt := rtypesFor()
+	if gt == nil || v == 0 {
+		return fmt.Sprintf("%#x", v)
+	}
+	addr := gt.runtimeType(v)
+	t := gt.readRtype(addr)
+	if t.Err != "" {
+		return fmt.Sprintf("<a href=\"/rtype/%x\">%#x</a> <b>%s</b>", addr, v, html.EscapeString(t.Err))
+	}
+	s := fmt.Sprintf("<a href=\"/rtype/%x\">%#x</a> (%s)", addr, v, html.EscapeString(t.Name))
+	if problems := t.checkEntry(e); len(problems) > 0 {
+		s += fmt.Sprintf(" <b style='color: red'>%s</b>", html.EscapeString(strings.Join(problems, ", ")))
+	}
+	return s
+}
+
+var rtypeTmpl = template.Must(template.New("rtype").Parse(`<!doctype html>
+<html>
+<head>
+<title>Runtime type {{.T.Name}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+{{with .T}}
+<h3>Runtime type {{.Name}} at {{.Addr | printf "%#x"}}</h3>
+{{if .DIE}}<p>DWARF type: <a href="/{{.DIE | printf "%x"}}">&lt;{{.DIE | printf "%x"}}&gt;</a></p>{{else}}<p>No DWARF type references this runtime type.</p>{{end}}
+{{range .Problems}}<p style='color: red'>{{.}}</p>
+{{end}}
+{{if .Err}}<p><b>{{.Err}}</b></p>{{end}}
+<tt><table class='dwarftbl'>
+<tr><td>Size</td><td>{{.Size}}</td></tr>
+<tr><td>PtrBytes</td><td>{{.PtrBytes}}</td></tr>
+<tr><td>Hash</td><td>{{.Hash | printf "%#x"}}</td></tr>
+<tr><td>TFlag</td><td>{{.TFlag | printf "%#x"}} {{.Flags}}</td></tr>
+<tr><td>Align</td><td>{{.Align}}</td></tr>
+<tr><td>FieldAlign</td><td>{{.FieldAlign}}</td></tr>
+<tr><td>Kind</td><td>{{.KindByte | printf "%#x"}} {{.Kind}} {{.KindFlags}}</td></tr>
+<tr><td>Equal</td><td>{{call $.Code .Equal}}</td></tr>
+<tr><td>GCData</td><td>{{.GCData | printf "%#x"}}</td></tr>
+<tr><td>GC bitmap</td><td>{{.GCMask}}</td></tr>
+<tr><td>Str</td><td>{{.Str | printf "%#x"}} {{printf "%q" .Name}}</td></tr>
+<tr><td>PtrToThis</td><td>{{.PtrToThis | printf "%#x"}} {{call $.TypeOff .PtrToThis}}</td></tr>
+{{if .PkgPath}}<tr><td>PkgPath</td><td>{{.PkgPath}}</td></tr>{{end}}
+{{range .Extra}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}
+</table></tt>
+{{if .Fields}}
+<h4>{{if eq .Kind.String "struct"}}Fields{{else}}Methods{{end}}</h4>
+<tt><table class='dwarftbl'>
+{{range .Fields}}<tr><td>{{if eq $.T.Kind.String "struct"}}{{.Offset | printf "%#x"}}{{end}}</td><td>{{.Name}}{{if .Embedded}} (embedded){{end}}</td><td>{{call $.Link .Typ}}</td><td>{{with .Tag}}{{printf "%q" .}}{{end}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+{{if or .In .Out}}
+<h4>Parameters</h4>
+<tt><table class='dwarftbl'>
+{{range $i, $x := .In}}<tr><td>in {{$i}}</td><td>{{call $.Link $x}}</td></tr>
+{{end}}
+{{range $i, $x := .Out}}<tr><td>out {{$i}}</td><td>{{call $.Link $x}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+{{if .Uncommon}}
+<h4>Uncommon type at {{.Uncommon | printf "%#x"}}</h4>
+<p>{{.Mcount}} methods, {{.Xcount}} exported</p>
+{{if .Methods}}
+<tt><table class='dwarftbl'>
+<tr><th>Name</th><th>Type</th><th>Ifn</th><th>Tfn</th></tr>
+{{range .Methods}}<tr><td>{{.Name}}</td><td>{{call $.Link .Mtyp}}</td><td>{{call $.Code .Ifn}}</td><td>{{call $.Code .Tfn}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}
+{{end}}
+{{end}}
+<p>Go version: {{.G.Version}}</p>
+</body>
+</html>
+`))
+
+// rtypeHandler shows the runtime type descriptor at the given address.
+func rtypeHandler(w http.ResponseWriter, r *http.Request) {
+	addr := address(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	gt := rtypesFor()
+	if gt == nil || addr == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	t := gt.readRtype(addr)
+	if t.Err == "" {
+		if t.DIE = gt.rtypeDIE(addr); t.DIE != 0 {
+			rdr := Dwarf.Reader()
+			rdr.Seek(t.DIE)
+			en, _ := toEntryNode(rdr)
+			t.Problems = t.check(en)
+		}
+	}
+	must(rtypeTmpl.Execute(w, struct {
+		T       *rtype
+		G       *goTypes
+		Link    func(uint64) template.HTML
+		Code    func(uint64) template.HTML
+		TypeOff func(int32) template.HTML
+	}{t, gt, gt.link, gt.codeLink, func(off int32) template.HTML { return gt.link(gt.typeOff(off)) }}))
+}
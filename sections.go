@@ -19,7 +19,11 @@ import (
 func GetDebugSectionElf(f *elf.File, name string) ([]byte, error) {
 	sec := f.Section(".debug_" + name)
 	if sec != nil {
-		return sec.Data()
+		b, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		return relocateElf(f, sec, b), nil
 	}
 	sec = f.Section(".zdebug_" + name)
 	if sec == nil {
@@ -29,7 +33,28 @@ func GetDebugSectionElf(f *elf.File, name string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return decompressMaybe(b)
+	b, err = decompressMaybe(b)
+	if err != nil {
+		return nil, err
+	}
+	return relocateElf(f, sec, b), nil
+}
+
+// getDebugTypesElf returns the contents of all .debug_types sections,
+// relocatable objects have one for each type unit.
+func getDebugTypesElf(f *elf.File) []byte {
+	var r []byte
+	for _, sec := range f.Sections {
+		if sec.Name != ".debug_types" || sec.Type == elf.SHT_NOBITS {
+			continue
+		}
+		b, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		r = append(r, relocateElf(f, sec, b)...)
+	}
+	return r
 }
 
 // GetDebugSectionPE returns the data contents of the specified debug
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/leb128"
+)
+
+// Split DWARF support, see DWARFv5 section 3.1.3 and appendix F, for the
+// pre-standard GNU extension see https://gcc.gnu.org/wiki/DebugFission.
+
+const (
+	_DW_AT_GNU_dwo_name    = 0x2130
+	_DW_AT_GNU_dwo_id      = 0x2131
+	_DW_AT_GNU_ranges_base = 0x2132
+	_DW_AT_GNU_addr_base   = 0x2133
+
+	_DW_FORM_addrx          = 0x1b
+	_DW_FORM_strx           = 0x1a
+	_DW_FORM_implicit_const = 0x21
+	_DW_FORM_GNU_addr_index = 0x1f01
+	_DW_FORM_GNU_str_index  = 0x1f02
+)
+
+// dwarfData is the DWARF data of the executable extended with the split
+// compile units loaded from .dwo and .dwp files.
+// Entries of split units are given offsets past the end of the .debug_info
+// section of the executable so that they can be used everywhere an offset
+// of the executable is used.
+type dwarfData struct {
+	*dwarf.Data
+	Splits []*splitUnit
+
+	// Types contains the type units of .debug_types, its entries are given
+	// offsets past the end of the split units, see loadTypeUnits.
+	Types     *dwarf.Data
+	typesBase dwarf.Offset
+}
+
+// splitUnit is a split compile unit and the skeleton unit that references it.
+type splitUnit struct {
+	Skeleton *dwarf.Entry
+	Name     string // value of DW_AT_dwo_name
+	Path     string // file the split unit was loaded from
+	Err      error
+
+	data    *dwarf.Data
+	base    dwarf.Offset // offset of the unit in the virtual .debug_info section
+	size    dwarf.Offset
+	cuOff   dwarf.Offset
+	version uint8
+	dwarf64 bool
+	info    []byte // the unit in .debug_info.dwo
+	abbrev  []byte
+
+	str, strOffsets []byte
+	macro, macinfo  []byte
+
+	addrBase     uint64
+	debugAddr    *godwarf.DebugAddr
+	loclists     *loclistSection5
+	loclistsBase int64
+	locGNU       []byte
+	rnglists     []byte
+}
+
+// dwoSections contains the sections of a .dwo file, or the contributions
+// of a split unit to the sections of a .dwp file.
+type dwoSections struct {
+	info, abbrev, line, str, strOffsets, loc, loclists, rnglists, macro, macinfo []byte
+}
+
+func (d *dwarfData) Reader() *dwarfReader {
+	return &dwarfReader{d: d, rdr: d.Data.Reader(), split: -1}
+}
+
+// splitFor returns the split unit containing the entry at off or nil if
+// the entry belongs to the executable.
+func (d *dwarfData) splitFor(off dwarf.Offset) *splitUnit {
+	for _, su := range d.Splits {
+		if su.data != nil && off >= su.base && off < su.base+su.size {
+			return su
+		}
+	}
+	return nil
+}
+
+// splitForSkeleton returns the split unit loaded for the skeleton unit at
+// off, or nil.
+func (d *dwarfData) splitForSkeleton(off dwarf.Offset) *splitUnit {
+	for _, su := range d.Splits {
+		if su.Skeleton.Offset == off {
+			return su
+		}
+	}
+	return nil
+}
+
+func (d *dwarfData) Ranges(e *dwarf.Entry) ([][2]uint64, error) {
+	su := d.splitFor(e.Offset)
+	if su == nil {
+		return d.Data.Ranges(e)
+	}
+	if e.Offset == su.cuOff {
+		return d.Data.Ranges(su.Skeleton)
+	}
+	return su.data.Ranges(su.local(e))
+}
+
+// LineReader returns the line table for cu, split units use the line table
+// of their skeleton unit.
+func (d *dwarfData) LineReader(cu *dwarf.Entry) (*dwarf.LineReader, error) {
+	if su := d.splitFor(cu.Offset); su != nil {
+		return d.Data.LineReader(su.Skeleton)
+	}
+	return d.Data.LineReader(cu)
+}
+
+// Type reads the type at off, which can belong to a split unit.
+func (d *dwarfData) Type(off dwarf.Offset) (dwarf.Type, error) {
+	if d.Types != nil && off >= d.typesBase {
+		return d.Types.Type(off - d.typesBase)
+	}
+	if su := d.splitFor(off); su != nil {
+		return su.data.Type(off - su.base)
+	}
+	return d.Data.Type(off)
+}
+
+// local returns a copy of e with the offset it has inside su.
+func (su *splitUnit) local(e *dwarf.Entry) *dwarf.Entry {
+	r := *e
+	r.Offset -= su.base
+	return &r
+}
+
+// translate converts the offsets of e from the split unit to the virtual
+// .debug_info section.
+func (su *splitUnit) translate(e *dwarf.Entry) {
+	translateEntry(e, su.base)
+}
+
+func translateEntry(e *dwarf.Entry, base dwarf.Offset) {
+	if e == nil {
+		return
+	}
+	e.Offset += base
+	for i := range e.Field {
+		if e.Field[i].Class == dwarf.ClassReference {
+			e.Field[i].Val = e.Field[i].Val.(dwarf.Offset) + base
+		}
+	}
+}
+
+// dwarfReader reads the entries of the executable followed by the entries
+// of all split units and the type units of .debug_types.
+type dwarfReader struct {
+	d     *dwarfData
+	rdr   *dwarf.Reader
+	split int  // index of the split unit being read or -1
+	types bool // reading .debug_types
+}
+
+func (r *dwarfReader) Seek(off dwarf.Offset) {
+	if r.d.Types != nil && off >= r.d.typesBase {
+		r.split = len(r.d.Splits) - 1
+		r.types = true
+		r.rdr = r.d.Types.Reader()
+		r.rdr.Seek(off - r.d.typesBase)
+		return
+	}
+	r.types = false
+	for i, su := range r.d.Splits {
+		if su.data != nil && off >= su.base && off < su.base+su.size {
+			r.split = i
+			r.rdr = su.data.Reader()
+			r.rdr.Seek(off - su.base)
+			return
+		}
+	}
+	r.split = -1
+	r.rdr = r.d.Data.Reader()
+	r.rdr.Seek(off)
+}
+
+func (r *dwarfReader) Next() (*dwarf.Entry, error) {
+	for {
+		e, err := r.rdr.Next()
+		if r.types && e != nil && e.Tag == typesPaddingTag {
+			continue
+		}
+		if e != nil || err != nil {
+			if r.types {
+				translateEntry(e, r.d.typesBase)
+			} else if r.split >= 0 {
+				r.d.Splits[r.split].translate(e)
+			}
+			return e, err
+		}
+		if r.types {
+			return nil, nil
+		}
+		r.split++
+		for r.split < len(r.d.Splits) && r.d.Splits[r.split].data == nil {
+			r.split++
+		}
+		if r.split >= len(r.d.Splits) {
+			r.split = len(r.d.Splits) - 1
+			if r.d.Types == nil {
+				return nil, nil
+			}
+			r.types = true
+			r.rdr = r.d.Types.Reader()
+			continue
+		}
+		r.rdr = r.d.Splits[r.split].data.Reader()
+	}
+}
+
+func (r *dwarfReader) SkipChildren() {
+	r.rdr.SkipChildren()
+}
+
+// loadSplitUnits finds the skeleton units of the executable at path and
+// loads the corresponding split units, from a .dwp package next to the
+// executable or from the .dwo files.
+func loadSplitUnits(path string, getSection func(name string) []byte) {
+	info := getSection("info")
+	addr := getSection("addr")
+	ranges := getSection("ranges")
+
+	var dwp *dwpFile
+	var dwpErr error
+	if _, err := os.Stat(path + ".dwp"); err == nil {
+		dwp, dwpErr = openDwp(path + ".dwp")
+		if dwpErr != nil {
+			fmt.Fprintf(os.Stderr, "could not open %s.dwp: %v\n", path, dwpErr)
+		} else {
+			addDataSource("split units", dwp.path, "")
+		}
+	}
+
+	base := dwarf.Offset(len(info))
+	rdr := Dwarf.Data.Reader()
+	for {
+		e, err := rdr.Next()
+		must(err)
+		if e == nil {
+			break
+		}
+		rdr.SkipChildren()
+		if e.Tag != dwarf.TagSkeletonUnit && e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		name, _ := e.Val(dwarf.AttrDwoName).(string)
+		if name == "" {
+			name, _ = e.Val(_DW_AT_GNU_dwo_name).(string)
+		}
+		if name == "" {
+			continue
+		}
+
+		su := &splitUnit{Skeleton: e, Name: name, base: base}
+		id, hasID := UnitIDs[e.Offset]
+		if !hasID {
+			var gnuID int64
+			gnuID, hasID = e.Val(_DW_AT_GNU_dwo_id).(int64)
+			id = uint64(gnuID)
+		}
+
+		var secs *dwoSections
+		switch {
+		case dwp != nil && hasID:
+			su.Path = dwp.path
+			secs, su.Err = dwp.sections(id)
+		default:
+			su.Path, secs, su.Err = openDwo(path, name, e)
+		}
+		if su.Err == nil {
+			su.Err = su.load(secs, id, hasID, addr, ranges)
+		}
+		if su.Err != nil {
+			if dwpErr != nil {
+				su.Err = fmt.Errorf("%v, could not open %s.dwp: %v", su.Err, path, dwpErr)
+			}
+			fmt.Fprintf(os.Stderr, "could not load split unit %s: %v\n", name, su.Err)
+			su.data = nil
+		} else {
+			if dwp == nil {
+				addDataSource("split unit "+name, su.Path, "")
+			}
+			UnitVersions[su.cuOff] = su.version
+			UnitDwarf64[su.cuOff] = su.dwarf64
+			base += su.size
+		}
+		Dwarf.Splits = append(Dwarf.Splits, su)
+	}
+}
+
+// openDwo opens the .dwo file for the skeleton unit e, name is resolved
+// against DW_AT_comp_dir and then against the directory of the executable.
+func openDwo(exePath, name string, e *dwarf.Entry) (string, *dwoSections, error) {
+	compDir, _ := e.Val(dwarf.AttrCompDir).(string)
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{filepath.Join(compDir, name), filepath.Join(filepath.Dir(exePath), name)}
+	}
+	candidates = append(candidates, filepath.Join(filepath.Dir(exePath), filepath.Base(name)))
+
+	for _, path := range candidates {
+		file, err := elf.Open(path)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+		get := func(name string) []byte {
+			data, _ := GetDebugSectionElf(file, name+".dwo")
+			return data
+		}
+		return path, &dwoSections{
+			info:       get("info"),
+			abbrev:     get("abbrev"),
+			line:       get("line"),
+			str:        get("str"),
+			strOffsets: get("str_offsets"),
+			loc:        get("loc"),
+			loclists:   get("loclists"),
+			rnglists:   get("rnglists"),
+			macro:      get("macro"),
+			macinfo:    get("macinfo"),
+		}, nil
+	}
+	return "", nil, fmt.Errorf("could not find %s", name)
+}
+
+// load creates the dwarf.Data for the split unit with the given id (for
+// DWARFv4 units hasID can be false) out of the sections of its .dwo file.
+// The .debug_addr, .debug_str_offsets and .debug_rnglists sections are
+// sliced so that their base for the split unit is 0, this way debug/dwarf
+// can read pre-standard split units which do not support base attributes.
+func (su *splitUnit) load(secs *dwoSections, id uint64, hasID bool, addr, ranges []byte) error {
+	const (
+		_DW_UT_split_compile = 0x5
+	)
+
+	var unit []byte
+	var ptrsz int
+	for info := secs.info; len(info) > 0; {
+		length, dwarf64, version, byteOrder := readDwarfLengthVersion(info)
+		hdrsz := 4
+		if dwarf64 {
+			hdrsz = 12
+		}
+		if length == 0 || uint64(len(info)) < uint64(hdrsz)+length {
+			break
+		}
+		cur := info[:uint64(hdrsz)+length]
+		info = info[len(cur):]
+		secoffsz := hdrsz - 4
+		if secoffsz == 0 {
+			secoffsz = 4
+		}
+		if version < 5 {
+			if len(cur) > hdrsz+2+secoffsz {
+				unit = cur
+				su.version, su.dwarf64 = version, dwarf64
+				ptrsz = int(cur[hdrsz+2+secoffsz])
+			}
+			break
+		}
+		if len(cur) < hdrsz+4+secoffsz+8 || cur[hdrsz+2] != _DW_UT_split_compile {
+			continue
+		}
+		if !hasID || byteOrder.Uint64(cur[hdrsz+4+secoffsz:]) == id {
+			unit = cur
+			su.version, su.dwarf64 = version, dwarf64
+			ptrsz = int(cur[hdrsz+3])
+			break
+		}
+	}
+	if unit == nil {
+		return errors.New("split compile unit not found")
+	}
+
+	abbrev := secs.abbrev
+	if su.version < 5 {
+		var err error
+		abbrev, err = remapGNUSplitForms(abbrev)
+		if err != nil {
+			return err
+		}
+	}
+
+	var rangesGNU []byte
+	if base, ok := su.Skeleton.Val(_DW_AT_GNU_ranges_base).(int64); ok && base <= int64(len(ranges)) {
+		rangesGNU = ranges[base:]
+	}
+
+	var err error
+	su.data, err = dwarf.New(abbrev, nil, nil, unit, secs.line, nil, rangesGNU, secs.str)
+	if err != nil {
+		return err
+	}
+
+	addrBase, ok := su.Skeleton.Val(dwarf.AttrAddrBase).(int64)
+	if !ok {
+		addrBase, _ = su.Skeleton.Val(_DW_AT_GNU_addr_base).(int64)
+	}
+	if addrBase > int64(len(addr)) {
+		return errors.New("skeleton address base out of range")
+	}
+	su.addrBase = uint64(addrBase)
+	su.data.AddSection(".debug_addr", addr[addrBase:])
+	if su.version >= 5 {
+		su.debugAddr = DebugAddr5.GetSubsection(su.addrBase)
+	} else {
+		// pre-standard .debug_addr sections do not have a header
+		hdr := []byte{0, 0, 0, 0, 5, 0, byte(ptrsz), 0}
+		Arch.ByteOrder.PutUint16(hdr[4:], 5)
+		su.debugAddr = godwarf.ParseAddr(append(hdr, addr...)).GetSubsection(uint64(len(hdr)) + su.addrBase)
+	}
+
+	if su.version >= 5 {
+		su.strOffsets = skipSectionHeader(secs.strOffsets, 8)
+		su.data.AddSection(".debug_str_offsets", su.strOffsets)
+		su.data.AddSection(".debug_rnglists", skipSectionHeader(secs.rnglists, 12))
+		su.rnglists = secs.rnglists
+		su.loclists = newLoclistSection5(secs.loclists, ptrsz)
+		su.loclistsBase = int64(len(secs.loclists) - len(skipSectionHeader(secs.loclists, 12)))
+	} else {
+		su.strOffsets = secs.strOffsets
+		su.data.AddSection(".debug_str_offsets", su.strOffsets)
+		su.locGNU = secs.loc
+	}
+
+	su.info, su.abbrev = unit, secs.abbrev
+	su.str, su.macro, su.macinfo = secs.str, secs.macro, secs.macinfo
+	su.size = dwarf.Offset(len(unit))
+	e, err := su.data.Reader().Next()
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return errors.New("empty split unit")
+	}
+	su.cuOff = su.base + e.Offset
+	return nil
+}
+
+// skipSectionHeader returns data without the header of a DWARFv5
+// .debug_str_offsets, .debug_rnglists or .debug_loclists contribution, sz
+// is the size of the header in the 32bit DWARF format.
+func skipSectionHeader(data []byte, sz int) []byte {
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == ^uint32(0) {
+		sz += 8
+	}
+	if len(data) < sz {
+		return nil
+	}
+	return data[sz:]
+}
+
+// remapGNUSplitForms rewrites the abbreviation table of a pre-standard split
+// unit replacing DW_FORM_GNU_addr_index and DW_FORM_GNU_str_index with
+// DW_FORM_addrx and DW_FORM_strx, which have the same encoding.
+func remapGNUSplitForms(abbrev []byte) ([]byte, error) {
+	in := bytes.NewBuffer(abbrev)
+	out := new(bytes.Buffer)
+	copyUleb := func() uint64 {
+		n, _ := leb128.DecodeUnsigned(in)
+		leb128.EncodeUnsigned(out, n)
+		return n
+	}
+	for in.Len() > 0 {
+		if code := copyUleb(); code == 0 {
+			continue
+		}
+		copyUleb() // tag
+		children, err := in.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		out.WriteByte(children)
+		for {
+			attr, _ := leb128.DecodeUnsigned(in)
+			form, _ := leb128.DecodeUnsigned(in)
+			switch form {
+			case _DW_FORM_GNU_addr_index:
+				form = _DW_FORM_addrx
+			case _DW_FORM_GNU_str_index:
+				form = _DW_FORM_strx
+			}
+			leb128.EncodeUnsigned(out, attr)
+			leb128.EncodeUnsigned(out, form)
+			if form == _DW_FORM_implicit_const {
+				n, _ := leb128.DecodeSigned(in)
+				leb128.EncodeSigned(out, n)
+			}
+			if attr == 0 && form == 0 {
+				break
+			}
+			if in.Len() == 0 {
+				return nil, errors.New("truncated abbreviation table")
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// dwpFile is a DWARF package file, see DWARFv5 section 7.3.5.
+type dwpFile struct {
+	path       string
+	version    uint32
+	cols       []uint32
+	rows       map[uint64]int
+	offs, szs  [][]uint32
+	sectionsOf map[uint32][]byte
+	str        []byte
+}
+
+func openDwp(path string) (*dwpFile, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	get := func(name string) []byte {
+		data, _ := GetDebugSectionElf(file, name)
+		return data
+	}
+	index := get("cu_index")
+	if len(index) < 16 {
+		return nil, errors.New("missing or truncated .debug_cu_index")
+	}
+
+	bo := file.ByteOrder
+	dwp := &dwpFile{path: path, rows: make(map[uint64]int)}
+	dwp.version = bo.Uint32(index)
+	if dwp.version != 2 {
+		// DWARFv5 uses a 2 byte version followed by 2 bytes of padding
+		dwp.version = uint32(bo.Uint16(index))
+	}
+	ncols, nunits, nslots := bo.Uint32(index[4:]), bo.Uint32(index[8:]), bo.Uint32(index[12:])
+	if uint64(len(index)) < 16+uint64(nslots)*12+uint64(ncols)*4*(2*uint64(nunits)+1) {
+		return nil, errors.New("truncated .debug_cu_index")
+	}
+	sigs := index[16:]
+	idxs := sigs[nslots*8:]
+	tbl := idxs[nslots*4:]
+	for i := uint32(0); i < nslots; i++ {
+		if row := bo.Uint32(idxs[i*4:]); row != 0 {
+			dwp.rows[bo.Uint64(sigs[i*8:])] = int(row - 1)
+		}
+	}
+	readRow := func(data []byte) []uint32 {
+		r := make([]uint32, ncols)
+		for i := range r {
+			r[i] = bo.Uint32(data[i*4:])
+		}
+		return r
+	}
+	dwp.cols = readRow(tbl)
+	tbl = tbl[ncols*4:]
+	for i := uint32(0); i < nunits; i++ {
+		dwp.offs = append(dwp.offs, readRow(tbl[i*ncols*4:]))
+	}
+	tbl = tbl[nunits*ncols*4:]
+	for i := uint32(0); i < nunits; i++ {
+		dwp.szs = append(dwp.szs, readRow(tbl[i*ncols*4:]))
+	}
+
+	dwp.sectionsOf = make(map[uint32][]byte)
+	for _, col := range dwp.cols {
+		dwp.sectionsOf[col] = get(dwp.sectionName(col) + ".dwo")
+	}
+	dwp.str = get("str.dwo")
+	return dwp, nil
+}
+
+func (dwp *dwpFile) sectionName(col uint32) string {
+	const (
+		_DW_SECT_INFO        = 1
+		_DW_SECT_TYPES       = 2 // version 2 only
+		_DW_SECT_ABBREV      = 3
+		_DW_SECT_LINE        = 4
+		_DW_SECT_LOCLISTS    = 5 // DW_SECT_LOC in version 2
+		_DW_SECT_STR_OFFSETS = 6
+		_DW_SECT_MACRO       = 7 // DW_SECT_MACINFO in version 2
+		_DW_SECT_RNGLISTS    = 8 // DW_SECT_MACRO in version 2
+	)
+	switch col {
+	case _DW_SECT_INFO:
+		return "info"
+	case _DW_SECT_TYPES:
+		return "types"
+	case _DW_SECT_ABBREV:
+		return "abbrev"
+	case _DW_SECT_LINE:
+		return "line"
+	case _DW_SECT_LOCLISTS:
+		if dwp.version == 2 {
+			return "loc"
+		}
+		return "loclists"
+	case _DW_SECT_STR_OFFSETS:
+		return "str_offsets"
+	case _DW_SECT_MACRO:
+		if dwp.version == 2 {
+			return "macinfo"
+		}
+		return "macro"
+	case _DW_SECT_RNGLISTS:
+		if dwp.version == 2 {
+			return "macro"
+		}
+		return "rnglists"
+	}
+	return fmt.Sprintf("unknown%d", col)
+}
+
+// sections returns the contributions of the split unit with the given id.
+func (dwp *dwpFile) sections(id uint64) (*dwoSections, error) {
+	row, ok := dwp.rows[id]
+	if !ok {
+		return nil, fmt.Errorf("unit %#x not found in %s", id, dwp.path)
+	}
+	secs := &dwoSections{str: dwp.str}
+	for i, col := range dwp.cols {
+		data := dwp.sectionsOf[col]
+		off, sz := uint64(dwp.offs[row][i]), uint64(dwp.szs[row][i])
+		if off+sz > uint64(len(data)) {
+			return nil, fmt.Errorf("contribution of unit %#x to .debug_%s.dwo out of range", id, dwp.sectionName(col))
+		}
+		data = data[off : off+sz]
+		switch dwp.sectionName(col) {
+		case "info":
+			secs.info = data
+		case "abbrev":
+			secs.abbrev = data
+		case "line":
+			secs.line = data
+		case "loc":
+			secs.loc = data
+		case "loclists":
+			secs.loclists = data
+		case "str_offsets":
+			secs.strOffsets = data
+		case "macro":
+			secs.macro = data
+		case "macinfo":
+			secs.macinfo = data
+		case "rnglists":
+			secs.rnglists = data
+		}
+	}
+	return secs, nil
+}
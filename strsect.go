@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+// String sections: .debug_str, .debug_line_str and .debug_str_offsets, see
+// DWARFv5 sections 7.26 and 7.5.5.
+
+type strEntry struct {
+	Off  int
+	Str  string
+	Refs int  // number of attributes and line table entries referencing the string or a suffix of it
+	Dup  bool // the same string appears at a different offset
+}
+
+type strSection struct {
+	Name         string
+	Size         int
+	Strs         []*strEntry
+	Unreferenced int // bytes of unreferenced strings
+	Duplicated   int // bytes of strings that appear more than once, excluding the first copy
+	Units        []*strUnitCost
+}
+
+// strUnitCost is the space a unit uses in a string section.
+type strUnitCost struct {
+	Unit      dwarf.Offset
+	Name      string
+	Strings   int
+	Bytes     int
+	Exclusive int // bytes of the strings only referenced by this unit
+	HasTable  bool
+
+	strs map[*strEntry]bool
+}
+
+var strSections []*strSection
+
+func init() {
+	onReset(func() {
+		strSections = nil
+	})
+}
+
+func readStrSection(name string, data []byte) *strSection {
+	s := &strSection{Name: name, Size: len(data)}
+	for off := 0; off < len(data); {
+		n := bytes.IndexByte(data[off:], 0)
+		if n < 0 {
+			n = len(data) - off
+		}
+		s.Strs = append(s.Strs, &strEntry{Off: off, Str: string(data[off : off+n])})
+		off += n + 1
+	}
+	return s
+}
+
+// lookup returns the string containing off.
+func (s *strSection) lookup(off uint64) *strEntry {
+	i := sort.Search(len(s.Strs), func(i int) bool { return uint64(s.Strs[i].Off) > off })
+	if i == 0 || off >= uint64(s.Size) {
+		return nil
+	}
+	return s.Strs[i-1]
+}
+
+func (s *strSection) ref(unit *strUnitCost, off uint64) {
+	se := s.lookup(off)
+	if se == nil {
+		return
+	}
+	se.Refs++
+	if unit.strs == nil {
+		unit.strs = map[*strEntry]bool{}
+		s.Units = append(s.Units, unit)
+	}
+	unit.strs[se] = true
+}
+
+func (s *strSection) finish() {
+	seen := map[string]bool{}
+	count := map[*strEntry]int{}
+	for _, se := range s.Strs {
+		if se.Refs == 0 {
+			s.Unreferenced += len(se.Str) + 1
+		}
+		if seen[se.Str] {
+			se.Dup = true
+			s.Duplicated += len(se.Str) + 1
+		}
+		seen[se.Str] = true
+	}
+	for _, unit := range s.Units {
+		for se := range unit.strs {
+			count[se]++
+		}
+	}
+	for _, unit := range s.Units {
+		unit.Strings = len(unit.strs)
+		for se := range unit.strs {
+			unit.Bytes += len(se.Str) + 1
+			if count[se] == 1 {
+				unit.Exclusive += len(se.Str) + 1
+			}
+		}
+	}
+	sort.SliceStable(s.Units, func(i, j int) bool { return s.Units[i].Bytes > s.Units[j].Bytes })
+	dups := map[string]bool{}
+	for _, se := range s.Strs {
+		if se.Dup {
+			dups[se.Str] = true
+		}
+	}
+	for _, se := range s.Strs {
+		if dups[se.Str] {
+			se.Dup = true
+		}
+	}
+}
+
+// strOffsetsFor returns the .debug_str_offsets table used by the entry at
+// off starting at the base of its unit, the string section it indexes and
+// the size of its entries.
+func strOffsetsFor(off dwarf.Offset) ([]byte, []byte, int) {
+	if su := Dwarf.splitFor(off); su != nil {
+		return su.strOffsets, su.str, 4
+	}
+	u := abbrevUnitFor(off)
+	if u == nil || u.base != 0 {
+		return nil, DebugStr, 4
+	}
+	rdr := Dwarf.Reader()
+	rdr.Seek(u.first)
+	cu, _ := rdr.Next()
+	if cu == nil {
+		return nil, DebugStr, u.offsz
+	}
+	base, ok := cu.Val(dwarf.AttrStrOffsetsBase).(int64)
+	if !ok || base < 0 || base > int64(len(DebugStrOffsets)) {
+		return nil, DebugStr, u.offsz
+	}
+	return DebugStrOffsets[base:], DebugStr, u.offsz
+}
+
+func strxOffset(table []byte, offsz int, idx uint64) (uint64, bool) {
+	if idx >= uint64(len(table)/offsz) {
+		return 0, false
+	}
+	b := &lineBuf{data: table, off: int(idx) * offsz, bo: Arch.ByteOrder}
+	return b.uint(offsz), true
+}
+
+func isStrxForm(form uint64) bool {
+	switch form {
+	case _DW_FORM_strx, 0x25, 0x26, 0x27, 0x28, _DW_FORM_GNU_str_index: // DW_FORM_strx1, strx2, strx3, strx4
+		return true
+	}
+	return false
+}
+
+// uint returns the value of a field encoded as an unsigned integer.
+func (f *dieField) uint() uint64 {
+	b := &lineBuf{data: f.val, bo: Arch.ByteOrder}
+	switch f.form {
+	case 0x0f, 0x15, _DW_FORM_strx, _DW_FORM_addrx, 0x22, 0x23, _DW_FORM_GNU_addr_index, _DW_FORM_GNU_str_index:
+		// DW_FORM_udata, ref_udata, strx, addrx, loclistx, rnglistx
+		return b.uleb()
+	}
+	return b.uint(len(f.val))
+}
+
+// fmtStrForm describes how the string attribute attr of e is encoded.
+func fmtStrForm(e *dwarf.Entry, attr dwarf.Attr) string {
+	fields, _ := dieBytes(e.Offset)
+	for i := range fields {
+		f := &fields[i]
+		if f.attr != attr || f.val == nil {
+			continue
+		}
+		switch {
+		case f.form == 0x0e || f.form == 0x1f: // DW_FORM_strp, line_strp
+			return fmt.Sprintf(" (offset %#x)", f.uint())
+		case isStrxForm(f.form):
+			idx := f.uint()
+			table, _, offsz := strOffsetsFor(e.Offset)
+			if off, ok := strxOffset(table, offsz, idx); ok {
+				return fmt.Sprintf(" (index %d, offset %#x)", idx, off)
+			}
+			return fmt.Sprintf(" (index %d out of range)", idx)
+		}
+		return ""
+	}
+	return ""
+}
+
+// loadStrSections reads .debug_str and .debug_line_str and counts the
+// references to each string from the entries and line number program
+// headers of the executable.
+func loadStrSections() {
+	if strSections != nil {
+		return
+	}
+	strs, lineStrs := readStrSection(".debug_str", DebugStr), readStrSection(".debug_line_str", DebugLineStr)
+	strSections = []*strSection{strs, lineStrs}
+
+	var unit, lineUnit *strUnitCost
+	var table []byte
+	var offsz int
+	lineSeen := map[int64]bool{}
+	rdr := Dwarf.Reader()
+	for {
+		e, err := rdr.Next()
+		if err != nil || e == nil {
+			break
+		}
+		if e.Tag == 0 || Dwarf.splitFor(e.Offset) != nil {
+			continue
+		}
+		u := abbrevUnitFor(e.Offset)
+		if u == nil {
+			continue
+		}
+		if unit == nil || unit.Unit != u.first {
+			// normally the unit entry itself, but don't attribute the
+			// strings of a unit to the previous one if it was not read
+			var name string
+			if e.Offset == u.first {
+				name, _ = e.Val(dwarf.AttrName).(string)
+			}
+			unit = &strUnitCost{Unit: u.first, Name: name}
+			lineUnit = &strUnitCost{Unit: u.first, Name: name}
+			table, _, offsz = strOffsetsFor(u.first)
+			unit.HasTable = table != nil
+		}
+		if e.Offset == u.first {
+			if off, ok := stmtListOffset(e); ok && !lineSeen[off] {
+				lineSeen[off] = true
+				lp := readLineProgram(off, e)
+				for _, off := range lp.strRefs {
+					strs.ref(unit, off)
+				}
+				for _, off := range lp.lineStrRefs {
+					lineStrs.ref(lineUnit, off)
+				}
+			}
+		}
+		fields, _ := dieBytes(e.Offset)
+		for i := range fields {
+			f := &fields[i]
+			switch {
+			case f.form == 0x0e: // DW_FORM_strp
+				strs.ref(unit, f.uint())
+			case f.form == 0x1f: // DW_FORM_line_strp
+				lineStrs.ref(lineUnit, f.uint())
+			case isStrxForm(f.form):
+				if off, ok := strxOffset(table, offsz, f.uint()); ok {
+					strs.ref(unit, off)
+				}
+			}
+		}
+	}
+	for _, s := range strSections {
+		s.finish()
+	}
+}
+
+var strTmpl = template.Must(template.New("strings").Parse(`<!doctype html>
+<html>
+<head>
+<title>String sections</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>String sections</h3>
+<table class='dwarftbl'>
+<tr><th>Section</th><th>Size</th><th>Strings</th><th>Unreferenced bytes</th><th>Duplicated bytes</th></tr>
+{{range .}}<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{len .Strs}}</td><td>{{.Unreferenced}}</td><td>{{.Duplicated}}</td></tr>
+{{end}}
+</table>
+<p>References are counted from the entries of .debug_info and the headers of the line number programs, strings of split units are not included. Duplicated strings appear at more than one offset.</p>
+{{range .}}{{if .Strs}}
+<hr/>
+<h4><a name="{{.Name}}"></a>{{.Name}} by unit</h4>
+<table class='dwarftbl'>
+<tr><th>Unit</th><th>Name</th><th>Strings</th><th>Bytes</th><th>Exclusive bytes</th><th></th></tr>
+{{range .Units}}<tr><td><a href="/{{.Unit | printf "%x"}}">&lt;{{.Unit | printf "%x"}}&gt;</a></td><td>{{.Name}}</td><td>{{.Strings}}</td><td>{{.Bytes}}</td><td>{{.Exclusive}}</td><td>{{if .HasTable}}<a href="/stroffsets/{{.Unit | printf "%x"}}">.debug_str_offsets</a>{{end}}</td></tr>
+{{end}}
+</table>
+<h4>{{.Name}} contents</h4>
+<tt><table class='dwarftbl'>
+<tr><th>Offset</th><th>References</th><th>String</th><th></th></tr>
+{{range .Strs}}<tr><td>{{.Off | printf "%#x"}}</td><td>{{if .Refs}}{{.Refs}}{{else}}<b>0</b>{{end}}</td><td>{{printf "%q" .Str}}</td><td>{{if .Dup}}duplicated{{end}}</td></tr>
+{{end}}
+</table></tt>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+func strHandler(w http.ResponseWriter, r *http.Request) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	loadStrSections()
+	must(strTmpl.Execute(w, strSections))
+}
+
+type strOffsetsEntry struct {
+	Index int
+	Off   uint64
+	Str   string
+}
+
+var strOffsetsTmpl = template.Must(template.New("stroffsets").Parse(`<!doctype html>
+<html>
+<head>
+<title>.debug_str_offsets of {{.Unit | printf "%x"}}</title>
+<style>
+	.dwarftbl td {
+		padding-left: 10px;
+		padding-right: 10px;
+		vertical-align: top;
+	}
+</style>
+</head>
+<body>
+<h3>{{.Name}} of <a href="/{{.Unit | printf "%x"}}">&lt;{{.Unit | printf "%x"}}&gt;</a></h3>
+{{if .Header}}<p>{{.Header}}</p>{{end}}
+<tt><table class='dwarftbl'>
+<tr><th>Index</th><th>Offset</th><th>String</th></tr>
+{{range .Entries}}<tr><td>{{.Index}}</td><td>{{.Off | printf "%#x"}}</td><td>{{printf "%q" .Str}}</td></tr>
+{{end}}
+</table></tt>
+</body>
+</html>
+`))
+
+func strOffsetsHandler(w http.ResponseWriter, r *http.Request) {
+	off := offset(r)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	table, str, offsz := strOffsetsFor(off)
+	if table == nil {
+		http.NotFound(w, r)
+		return
+	}
+	name, header := ".debug_str_offsets.dwo", ""
+	if Dwarf.splitFor(off) == nil {
+		// the table is preceded by the header of its contribution
+		name = ".debug_str_offsets"
+		base := len(DebugStrOffsets) - len(table)
+		hdrOff := base - 8
+		if offsz == 8 {
+			hdrOff = base - 16
+		}
+		if hdrOff >= 0 {
+			length, dwarf64, version, _ := readDwarfLengthVersion(DebugStrOffsets[hdrOff:])
+			header = fmt.Sprintf("Contribution at %#x, unit length %d, version %d", hdrOff, length, version)
+			end := hdrOff + 4 + int(length)
+			if dwarf64 {
+				end += 8
+			}
+			if end >= base && end <= len(DebugStrOffsets) {
+				table = table[:end-base]
+			}
+		}
+	}
+	var entries []strOffsetsEntry
+	for i := 0; i < len(table)/offsz; i++ {
+		soff, _ := strxOffset(table, offsz, uint64(i))
+		entries = append(entries, strOffsetsEntry{i, soff, cstrAt(str, soff)})
+	}
+	must(strOffsetsTmpl.Execute(w, struct {
+		Name    string
+		Unit    dwarf.Offset
+		Header  string
+		Entries []strOffsetsEntry
+	}{name, off, header, entries}))
+}
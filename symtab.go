@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+// Where symbols come from.
+const (
+	symSourceDWARF  = "DWARF"
+	symSourceSymtab = ".symtab"
+	symSourceDynsym = ".dynsym"
+	symSourcePLT    = "PLT"
+	symSourceMacho  = "Mach-O symtab"
+	symSourceStubs  = "Mach-O stubs"
+	symSourceCOFF   = "COFF symbol table"
+)
+
+// tableSymbols are the symbols read from the symbol tables of the
+// executable, they are merged with the symbols found in DWARF by
+// findSymbols.
+var tableSymbols []Sym
+
+func init() {
+	onReset(func() {
+		tableSymbols = nil
+	})
+}
+
+func addTableSymbol(name string, addr, size uint64, source string) {
+	if name == "" {
+		return
+	}
+	tableSymbols = append(tableSymbols, Sym{Name: name, Addr: addr, Size: size, Source: source})
+}
+
+// loadSymbolsElf loads the symbol tables of file, if the debug info is in a
+// separate file dbgfile its symbol table is also loaded.
+func loadSymbolsElf(file, dbgfile *elf.File) {
+	load := func(syms []elf.Symbol, source string) {
+		// findSymbols keeps the first symbol of every address, put
+		// functions and global symbols first
+		syms = slices.Clone(syms)
+		sort.SliceStable(syms, func(i, j int) bool { return elfSymbolRank(&syms[i]) > elfSymbolRank(&syms[j]) })
+		for _, sym := range syms {
+			if sym.Section == elf.SHN_UNDEF || sym.Section >= elf.SHN_LORESERVE {
+				continue
+			}
+			if strings.HasPrefix(sym.Name, "$") && elf.ST_TYPE(sym.Info) == elf.STT_NOTYPE {
+				// ARM, AArch64 and RISC-V mapping symbols ($a, $d, $t, $x...)
+				continue
+			}
+			addr := elfSymbolAddr(file, &sym)
+			switch elf.ST_TYPE(sym.Info) {
+			case elf.STT_FUNC:
+				if file.Machine == elf.EM_ARM {
+					addr &^= 1 // thumb bit
+				}
+			case elf.STT_OBJECT, elf.STT_NOTYPE, elf.STT_TLS:
+			default:
+				continue
+			}
+			addTableSymbol(sym.Name, addr, sym.Size, source)
+		}
+	}
+	syms, _ := file.Symbols()
+	load(syms, symSourceSymtab)
+	if dbgfile != file {
+		syms, _ := dbgfile.Symbols()
+		load(syms, symSourceSymtab)
+	}
+	dynsyms, _ := file.DynamicSymbols()
+	load(dynsyms, symSourceDynsym)
+	loadPLTElf(file, dynsyms)
+}
+
+// elfSymbolRank orders symbols at the same address, higher is better.
+func elfSymbolRank(sym *elf.Symbol) int {
+	r := 0
+	if elf.ST_TYPE(sym.Info) == elf.STT_FUNC {
+		r += 2
+	}
+	if bind := elf.ST_BIND(sym.Info); bind == elf.STB_GLOBAL || bind == elf.STB_WEAK {
+		r++
+	}
+	return r
+}
+
+// elfDynRelocs returns the dynamic relocations of file that reference a
+// symbol, in the order they appear in the section called name. If name is
+// empty all dynamic relocation sections are read.
+func elfDynRelocs(file *elf.File, dynsyms []elf.Symbol, name string) (slots []uint64, names []string) {
+	for _, sect := range file.Sections {
+		if sect.Type != elf.SHT_RELA && sect.Type != elf.SHT_REL || name != "" && sect.Name != name {
+			continue
+		}
+		if int(sect.Link) >= len(file.Sections) || file.Sections[sect.Link].Type != elf.SHT_DYNSYM {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			continue
+		}
+		entsz := 8
+		if file.Class == elf.ELFCLASS64 {
+			entsz = 16
+		}
+		if sect.Type == elf.SHT_RELA {
+			entsz += entsz / 2
+		}
+		for ; len(data) >= entsz; data = data[entsz:] {
+			var off, symidx uint64
+			if file.Class == elf.ELFCLASS64 {
+				off = file.ByteOrder.Uint64(data)
+				symidx = file.ByteOrder.Uint64(data[8:]) >> 32
+			} else {
+				off = uint64(file.ByteOrder.Uint32(data))
+				symidx = uint64(file.ByteOrder.Uint32(data[4:]) >> 8)
+			}
+			// debug/elf drops the null symbol from dynsyms
+			if symidx == 0 || symidx > uint64(len(dynsyms)) {
+				continue
+			}
+			slots = append(slots, off)
+			names = append(names, dynsyms[symidx-1].Name)
+		}
+	}
+	return slots, names
+}
+
+var endbr64 = []byte{0xf3, 0x0f, 0x1e, 0xfa}
+
+// loadPLTElf creates a symbol for each PLT entry of file. On amd64 the
+// stubs are decoded to find which GOT slot they jump through, on other
+// architectures entries are assumed to follow the order of .rela.plt.
+func loadPLTElf(file *elf.File, dynsyms []elf.Symbol) {
+	switch file.Machine {
+	case elf.EM_X86_64:
+		slots, names := elfDynRelocs(file, dynsyms, "")
+		gotNames := make(map[uint64]string)
+		for i := range slots {
+			gotNames[slots[i]] = names[i]
+		}
+		for _, sect := range file.Sections {
+			if sect.Name != ".plt" && sect.Name != ".plt.sec" && sect.Name != ".plt.got" {
+				continue
+			}
+			data, err := sect.Data()
+			if err != nil {
+				continue
+			}
+			for i := 0; i < len(data); {
+				inst, err := x86asm.Decode(data[i:], 64)
+				if err != nil || inst.Len == 0 {
+					i++
+					continue
+				}
+				start := i
+				i += inst.Len
+				if inst.Op != x86asm.JMP {
+					continue
+				}
+				mem, ok := inst.Args[0].(x86asm.Mem)
+				if !ok || mem.Base != x86asm.RIP {
+					continue
+				}
+				name, ok := gotNames[sect.Addr+uint64(i)+uint64(mem.Disp)]
+				if !ok {
+					continue
+				}
+				if start >= 4 && bytes.Equal(data[start-4:start], endbr64) {
+					start -= 4
+				}
+				addTableSymbol(name+"@plt", sect.Addr+uint64(start), sect.Entsize, symSourcePLT)
+			}
+		}
+	case elf.EM_386, elf.EM_AARCH64:
+		relname, hdrsz, entsz := ".rel.plt", uint64(16), uint64(16)
+		if file.Machine == elf.EM_AARCH64 {
+			relname, hdrsz = ".rela.plt", 32
+		}
+		sect := file.Section(".plt")
+		if sect == nil {
+			return
+		}
+		_, names := elfDynRelocs(file, dynsyms, relname)
+		for i, name := range names {
+			addr := sect.Addr + hdrsz + uint64(i)*entsz
+			if addr+entsz > sect.Addr+sect.Size {
+				break
+			}
+			addTableSymbol(name+"@plt", addr, entsz, symSourcePLT)
+		}
+	}
+}
+
+const (
+	_N_STAB = 0xe0
+	_N_TYPE = 0x0e
+	_N_SECT = 0x0e
+
+	_S_SYMBOL_STUBS = 0x8
+
+	_INDIRECT_SYMBOL_LOCAL = 0x80000000
+	_INDIRECT_SYMBOL_ABS   = 0x40000000
+)
+
+func loadSymbolsMacho(file *macho.File) {
+	if file.Symtab == nil {
+		return
+	}
+	for _, sym := range file.Symtab.Syms {
+		if sym.Type&_N_STAB != 0 || sym.Type&_N_TYPE != _N_SECT {
+			continue
+		}
+		addTableSymbol(sym.Name, sym.Value, 0, symSourceMacho)
+	}
+	if file.Dysymtab == nil {
+		return
+	}
+	for _, stubs := range machoStubSections(file) {
+		for j := uint64(0); stubs.size > 0 && (j+1)*stubs.size <= stubs.Size; j++ {
+			idx := uint64(stubs.first) + j
+			if idx >= uint64(len(file.Dysymtab.IndirectSyms)) {
+				break
+			}
+			symidx := file.Dysymtab.IndirectSyms[idx]
+			if symidx&(_INDIRECT_SYMBOL_LOCAL|_INDIRECT_SYMBOL_ABS) != 0 || symidx >= uint32(len(file.Symtab.Syms)) {
+				continue
+			}
+			addTableSymbol(file.Symtab.Syms[symidx].Name+"@stub", stubs.Addr+j*stubs.size, stubs.size, symSourceStubs)
+		}
+	}
+}
+
+type machoStubSection struct {
+	*macho.Section
+	first uint32 // index of the first stub in the indirect symbol table
+	size  uint64 // size of a stub
+}
+
+// machoStubSections returns the S_SYMBOL_STUBS sections of file. The
+// reserved1 and reserved2 fields of the section headers are not exported by
+// debug/macho and are read from the raw segment load commands.
+func machoStubSections(file *macho.File) []machoStubSection {
+	var r []machoStubSection
+	segsz, sectsz, addrsz := 56, 68, 4
+	if file.Magic == macho.Magic64 {
+		segsz, sectsz, addrsz = 72, 80, 8
+	}
+	flagsOff := 32 + 2*addrsz + 16
+	for _, l := range file.Loads {
+		seg, ok := l.(*macho.Segment)
+		if !ok {
+			continue
+		}
+		raw := seg.Raw()
+		for i := uint32(0); i < seg.Nsect; i++ {
+			hdr := raw[segsz+int(i)*sectsz:]
+			if len(hdr) < sectsz {
+				break
+			}
+			name := strings.TrimRight(string(hdr[:16]), "\x00")
+			flags := file.ByteOrder.Uint32(hdr[flagsOff:])
+			if flags&0xff != _S_SYMBOL_STUBS {
+				continue
+			}
+			sect := file.Section(name)
+			if sect == nil || sect.Seg != seg.Name {
+				continue
+			}
+			r = append(r, machoStubSection{
+				Section: sect,
+				first:   file.ByteOrder.Uint32(hdr[flagsOff+4:]),
+				size:    uint64(file.ByteOrder.Uint32(hdr[flagsOff+8:])),
+			})
+		}
+	}
+	return r
+}
+
+const (
+	_IMAGE_SYM_CLASS_EXTERNAL = 2
+	_IMAGE_SYM_CLASS_STATIC   = 3
+)
+
+func loadSymbolsPE(file *pe.File, imageBase uint64) {
+	for _, sym := range file.Symbols {
+		if sym.SectionNumber <= 0 || int(sym.SectionNumber) > len(file.Sections) {
+			continue
+		}
+		if sym.StorageClass != _IMAGE_SYM_CLASS_EXTERNAL && sym.StorageClass != _IMAGE_SYM_CLASS_STATIC {
+			continue
+		}
+		if strings.HasPrefix(sym.Name, ".") && sym.Value == 0 {
+			// section symbol
+			continue
+		}
+		sect := file.Sections[sym.SectionNumber-1]
+		addTableSymbol(sym.Name, imageBase+uint64(sect.VirtualAddress)+uint64(sym.Value), 0, symSourceCOFF)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// TextSection is a section, or segment, of the executable containing code.
+type TextSection struct {
+	Name string
+	Addr uint64
+	Data []byte
+}
+
+func (sect *TextSection) End() uint64 {
+	return sect.Addr + uint64(len(sect.Data))
+}
+
+// TextSections lists all the executable sections of the file, sorted by address.
+var TextSections []*TextSection
+
+func init() {
+	onReset(func() {
+		TextSections = nil
+	})
+}
+
+func addTextSection(name string, addr uint64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	TextSections = append(TextSections, &TextSection{Name: name, Addr: addr, Data: data})
+	sort.Slice(TextSections, func(i, j int) bool { return TextSections[i].Addr < TextSections[j].Addr })
+}
+
+// findTextSection returns the executable section containing the address
+// range [start, end).
+func findTextSection(start, end uint64) (*TextSection, error) {
+	for _, sect := range TextSections {
+		if start < sect.Addr || start >= sect.End() {
+			continue
+		}
+		if end > sect.End() {
+			return nil, fmt.Errorf("range %#x-%#x crosses the end of section %s (%#x-%#x)", start, end, sect.Name, sect.Addr, sect.End())
+		}
+		return sect, nil
+	}
+	return nil, fmt.Errorf("range %#x-%#x is not contained in any executable section", start, end)
+}
+
+// loadTextSectionsElf loads all sections of file with the SHF_EXECINSTR
+// flag, if the file has no section headers the executable segments are used
+// instead.
+func loadTextSectionsElf(file *elf.File) {
+	for _, sect := range file.Sections {
+		if sect.Flags&elf.SHF_EXECINSTR == 0 || sect.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := sect.Data()
+		must(err)
+		addTextSection(sect.Name, sect.Addr, data)
+	}
+	if len(TextSections) > 0 {
+		return
+	}
+	for i, prog := range file.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_X == 0 {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		must(err)
+		addTextSection(fmt.Sprintf("segment %d", i), prog.Vaddr, data)
+	}
+}
+
+const (
+	_S_ATTR_PURE_INSTRUCTIONS = 0x80000000
+	_S_ATTR_SOME_INSTRUCTIONS = 0x00000400
+)
+
+func loadTextSectionsMacho(file *macho.File) {
+	for _, sect := range file.Sections {
+		if sect.Flags&(_S_ATTR_PURE_INSTRUCTIONS|_S_ATTR_SOME_INSTRUCTIONS) == 0 {
+			continue
+		}
+		data, err := sect.Data()
+		must(err)
+		addTextSection(sect.Seg+","+sect.Name, sect.Addr, data)
+	}
+}
+
+const (
+	_IMAGE_SCN_CNT_CODE    = 0x00000020
+	_IMAGE_SCN_MEM_EXECUTE = 0x20000000
+)
+
+func loadTextSectionsPE(file *pe.File, imageBase uint64) {
+	for _, sect := range file.Sections {
+		if sect.Characteristics&(_IMAGE_SCN_CNT_CODE|_IMAGE_SCN_MEM_EXECUTE) == 0 {
+			continue
+		}
+		data, err := sect.Data()
+		must(err)
+		if sect.VirtualSize != 0 && uint32(len(data)) > sect.VirtualSize {
+			// the raw data of a section is padded to the file alignment
+			data = data[:sect.VirtualSize]
+		}
+		addTextSection(sect.Name, imageBase+uint64(sect.VirtualAddress), data)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+)
+
+// Type units, see DWARFv4 section 3.1.3 and DWARFv5 section 3.1.4.
+
+var DebugTypes []byte
+
+// typeUnit is a type unit of .debug_types (DWARFv4) or .debug_info (DWARFv5).
+type typeUnit struct {
+	Sig     uint64
+	Off     dwarf.Offset // first entry of the unit
+	TypeOff dwarf.Offset // entry of the type
+	hdrOff  dwarf.Offset
+}
+
+// TypeUnits maps type signatures to type units.
+var TypeUnits map[uint64]*typeUnit
+
+func init() {
+	onReset(func() {
+		DebugTypes, TypeUnits = nil, nil
+	})
+}
+
+// typesPaddingTag is the tag of the padding entries of Dwarf.Types.
+const typesPaddingTag dwarf.Tag = 0xffff
+
+// loadTypeUnits indexes the type units of .debug_types and loads them into
+// Dwarf.Types, type units of .debug_info are indexed by readUnitVersions.
+// Since debug/dwarf can not read the entries of .debug_types, Dwarf.Types is
+// read from a copy of the section where the header of each type unit is
+// replaced by the header of a compile unit followed by a padding entry in
+// place of the type signature and type offset, this way the offsets of all
+// entries are unchanged.
+func loadTypeUnits() {
+	Dwarf.typesBase = dwarf.Offset(len(DebugInfo))
+	for _, su := range Dwarf.Splits {
+		if su.data != nil && su.base+su.size > Dwarf.typesBase {
+			Dwarf.typesBase = su.base + su.size
+		}
+	}
+	if len(DebugTypes) == 0 {
+		return
+	}
+	if TypeUnits == nil {
+		TypeUnits = make(map[uint64]*typeUnit)
+	}
+
+	info := append([]byte(nil), DebugTypes...)
+	newAbbrev := append([]byte(nil), DebugAbbrev...)
+	abbrevOffs := map[uint64]uint64{}
+	for off := 0; off+4 <= len(info); {
+		length, dwarf64, version, byteOrder := readDwarfLengthVersion(info[off:])
+		hdrsz, offsz := 4, 4
+		if dwarf64 {
+			hdrsz, offsz = 12, 8
+		}
+		end := off + hdrsz + int(length)
+		if version != 4 || end > len(info) || end < off || end-off < hdrsz+2+offsz+1+8+offsz {
+			fmt.Fprintf(os.Stderr, "could not read .debug_types at %#x\n", off)
+			break
+		}
+		b := &lineBuf{data: info[:end], off: off + hdrsz + 2, bo: byteOrder}
+		aoffPos := b.off
+		aoff := b.uint(offsz)
+		b.u8()
+		padStart := b.off
+		tu := &typeUnit{Sig: b.u64(), hdrOff: Dwarf.typesBase + dwarf.Offset(off)}
+		tu.TypeOff = tu.hdrOff + dwarf.Offset(b.uint(offsz))
+		tu.Off = Dwarf.typesBase + dwarf.Offset(b.off)
+		TypeUnits[tu.Sig] = tu
+
+		// the padding entry is a code followed by a DW_FORM_block1
+		newOff, ok := abbrevOffs[aoff]
+		if !ok {
+			newOff = uint64(len(newAbbrev))
+			abbrevOffs[aoff] = newOff
+			newAbbrev = append(newAbbrev, typesPaddingAbbrev...)
+			if aoff < uint64(len(DebugAbbrev)) {
+				newAbbrev = append(newAbbrev, DebugAbbrev[aoff:abbrevTableEnd(DebugAbbrev, int(aoff))]...)
+			}
+		}
+		if offsz == 8 {
+			byteOrder.PutUint64(info[aoffPos:], newOff)
+		} else {
+			byteOrder.PutUint32(info[aoffPos:], uint32(newOff))
+		}
+		pad := info[padStart:b.off]
+		for i := range pad {
+			pad[i] = 0
+		}
+		copy(pad, typesPaddingCode)
+		pad[len(typesPaddingCode)] = byte(len(pad) - len(typesPaddingCode) - 1)
+
+		off = end
+	}
+
+	var err error
+	Dwarf.Types, err = dwarf.New(newAbbrev, nil, nil, info, nil, nil, nil, DebugStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read .debug_types: %v\n", err)
+		Dwarf.Types = nil
+	}
+}
+
+var (
+	// typesPaddingCode is the abbreviation code 0x7fffffff
+	typesPaddingCode = []byte{0xff, 0xff, 0xff, 0xff, 0x07}
+	// typesPaddingAbbrev declares typesPaddingCode with typesPaddingTag,
+	// no children and a single DW_AT_hi_user attribute with DW_FORM_block1
+	typesPaddingAbbrev = append(typesPaddingCode, 0xff, 0xff, 0x03, 0x00, 0xff, 0x7f, 0x0a, 0x00, 0x00)
+)
+
+// abbrevTableEnd returns the end of the abbreviation table at off.
+func abbrevTableEnd(abbrev []byte, off int) int {
+	b := &lineBuf{data: abbrev, off: off, bo: Arch.ByteOrder}
+	for b.uleb() != 0 && !b.eof {
+		b.uleb()
+		b.u8()
+		for {
+			attr, form := b.uleb(), b.uleb()
+			if b.eof || (attr == 0 && form == 0) {
+				break
+			}
+			if form == _DW_FORM_implicit_const {
+				b.sleb()
+			}
+		}
+	}
+	return b.off
+}
+
+// readTypeUnitHeader indexes the DWARFv5 type unit whose header is at hdrOff
+// in .debug_info, data starts after the unit length.
+func readTypeUnitHeader(hdrOff, off dwarf.Offset, data []byte, secoffsz int, byteOrder binary.ByteOrder) {
+	tu := &typeUnit{Sig: byteOrder.Uint64(data[4+secoffsz:]), Off: off, hdrOff: hdrOff}
+	if secoffsz == 8 {
+		tu.TypeOff = hdrOff + dwarf.Offset(byteOrder.Uint64(data[12+secoffsz:]))
+	} else {
+		tu.TypeOff = hdrOff + dwarf.Offset(byteOrder.Uint32(data[12+secoffsz:]))
+	}
+	TypeUnits[tu.Sig] = tu
+}
+
+func fmtTypeSigField(f *dwarf.Field, nodes []*EntryNode) template.HTML {
+	sig := f.Val.(uint64)
+	tu := TypeUnits[sig]
+	if tu == nil {
+		return template.HTML(fmt.Sprintf("<td>%s</td><td>signature %#x (type unit not found)</td>", f.Attr.String(), sig))
+	}
+	name := findReferenceName(tu.TypeOff, nodes)
+	return template.HTML(fmt.Sprintf("<td>%s</td><td><a href=\"#%x\">&lt;%x&gt;</a> (%s) signature %#x</td>", f.Attr.String(), tu.TypeOff, tu.TypeOff, html.EscapeString(name), sig))
+}
@@ -18,7 +18,6 @@ import (
 	"time"
 
 	"github.com/go-delve/delve/pkg/dwarf/frame"
-	"github.com/go-delve/delve/pkg/dwarf/op"
 )
 
 type HandleFunc func(w http.ResponseWriter, r *http.Request)
@@ -52,7 +51,16 @@ var funcMap = template.FuncMap{
 	"EntryNodeField": func(f *dwarf.Field) template.HTML {
 		panic("EntryNodeField not replaced")
 	},
+	"EntryNodeForm": func(en *EntryNode, i int) string {
+		return fmtEntryNodeForm(en.E, i)
+	},
 	"FmtRange": fmtRange,
+	"HasPclntab": func() bool {
+		return Pclntab != nil
+	},
+	"HasGoTypes": func() bool {
+		return rtypesFor() != nil
+	},
 	"FmtFrameInstr": func(instr []byte) string {
 		return fmtFrameInstr(instr, 0)
 	},
@@ -60,10 +68,53 @@ var funcMap = template.FuncMap{
 		return fmtFrameInstr(fde.Instructions, fde.Begin())
 	},
 	"IsFrameEntry": isFrameEntry,
+	"FrameInfo": func(x interface{}) *frameEntryInfo {
+		return FrameInfo[x]
+	},
+	"IsRoot": func() bool {
+		return false
+	},
+	"ModuleGroup": func(i int) *goModule {
+		return nil
+	},
+	"DataSources": func() []DataSource {
+		return DataSources
+	},
+	"Arch": func() *Architecture {
+		return Arch
+	},
+	"Archive": func() *archive {
+		return Archive
+	},
+	"Core": func() *coreFile {
+		return Core
+	},
+	"GoBuildInfo": func() *goBuildInfo {
+		return buildInfo()
+	},
+	"RegName": func(n uint64) string {
+		if Arch.RegnumToString == nil {
+			return ""
+		}
+		return Arch.RegnumToString(n)
+	},
 }
 
 func fmtEntryNodeHeader(e *dwarf.Entry) template.HTML {
-	return template.HTML(fmt.Sprintf("<a name=\"%x\"><a href=\"/%x\">&lt;%x&gt;</a> <b>%s</b>", e.Offset, e.Offset, e.Offset, e.Tag.String()))
+	s := fmt.Sprintf("<a name=\"%x\"><a href=\"/%x\">&lt;%x&gt;</a> <b>%s</b>", e.Offset, e.Offset, e.Offset, e.Tag.String())
+	s += fmtEntryNodeAbbrev(e)
+	s += genericLink(e)
+	if su := Dwarf.splitForSkeleton(e.Offset); su != nil {
+		if su.Err != nil {
+			s += fmt.Sprintf(" (split unit %s not loaded: %s)", html.EscapeString(su.Name), html.EscapeString(su.Err.Error()))
+		} else {
+			s += fmt.Sprintf(" (skeleton of split unit <a href=\"/%x\">&lt;%x&gt;</a>)", su.cuOff, su.cuOff)
+		}
+	} else if su := Dwarf.splitFor(e.Offset); su != nil && su.cuOff == e.Offset {
+		s += fmt.Sprintf(" (split unit loaded from %s, skeleton <a href=\"/%x\">&lt;%x&gt;</a>)", html.EscapeString(su.Path), su.Skeleton.Offset, su.Skeleton.Offset)
+	}
+	s += fmtEntryNodeBytes(e)
+	return template.HTML(s)
 }
 
 const (
@@ -91,7 +142,7 @@ func fmtEntryNodeField(en *EntryNode, f *dwarf.Field, nodes []*EntryNode) templa
 
 	case dwarf.ClassAddress:
 		if f.Attr == _DW_AT_go_runtime_type {
-			return template.HTML(fmt.Sprintf("<td>GoRuntimeType</td><td>%#x</td>", f.Val.(uint64)))
+			return template.HTML(fmt.Sprintf("<td>GoRuntimeType</td><td>%s</td>", fmtRuntimeType(en.E, f.Val.(uint64))))
 		} else {
 			return template.HTML(fmt.Sprintf("<td>%s</td><td>%#x</td>", f.Attr.String(), f.Val.(uint64)))
 		}
@@ -101,15 +152,28 @@ func fmtEntryNodeField(en *EntryNode, f *dwarf.Field, nodes []*EntryNode) templa
 		if f.Attr == _DW_AT_go_package_name {
 			attrName = "GoPackageName"
 		}
-		return template.HTML(fmt.Sprintf("<td>%s</td><td>%s</td>", attrName, html.EscapeString(strconv.Quote(f.Val.(string)))))
+		return template.HTML(fmt.Sprintf("<td>%s</td><td>%s%s</td>", attrName, html.EscapeString(strconv.Quote(f.Val.(string))), fmtStrForm(en.E, f.Attr)))
 
 	case dwarf.ClassExprLoc:
 		block, _ := f.Val.([]byte)
 		var out bytes.Buffer
-		op.PrettyPrint(&out, block, RegnumToString)
+		PrettyPrintOp(&out, block, unitOffsetSize(findCompileUnit(en)))
 		return template.HTML(fmt.Sprintf("<td>%s</td><td>%s</td>", f.Attr.String(), html.EscapeString(out.String())))
-	case dwarf.ClassLocListPtr:
-		return template.HTML(fmt.Sprintf("<td>%s</td><td><pre>loclistptr = %#x (<a href='#' onclick='toggleLoclist2(this)'>toggle</a>)</pre><pre class='loclist' style='display: none'>%s</pre></td>", f.Attr.String(), f.Val.(int64), loclistPrint(f.Val.(int64), findCompileUnit(en), loclistReaderForEntry(en))))
+	case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+		cu := findCompileUnit(en)
+		if cu == nil {
+			return template.HTML(fmt.Sprintf("<td>%s</td><td>%v</td>", f.Attr.String(), f.Val))
+		}
+		off := loclistOffset(cu, f)
+		idx := ""
+		if f.Class == dwarf.ClassLocList {
+			idx = fmt.Sprintf("loclistx = %#x, ", f.Val.(uint64))
+		}
+		return template.HTML(fmt.Sprintf("<td>%s</td><td><pre>%sloclistptr = %#x (<a href='#' onclick='toggleLoclist2(this)'>toggle</a>)</pre><pre class='loclist' style='display: none'>%s</pre></td>", f.Attr.String(), idx, off, loclistPrint(off, cu, loclistReaderFor(cu))))
+	case dwarf.ClassRangeListPtr, dwarf.ClassRngList:
+		return fmtRangeListField(en, f)
+	case dwarf.ClassReferenceSig:
+		return fmtTypeSigField(f, nodes)
 
 	default:
 		var attrName string
@@ -124,6 +188,12 @@ func fmtEntryNodeField(en *EntryNode, f *dwarf.Field, nodes []*EntryNode) templa
 			attrName = "GoEmbeddedField"
 		case _DW_AT_go_dict_index:
 			attrName = "GoDictIndex"
+		case dwarf.AttrMacros, dwarf.AttrMacroInfo:
+			return fmtMacroField(en, f, f.Attr.String())
+		case _DW_AT_GNU_macros:
+			return fmtMacroField(en, f, "GNUMacros")
+		case dwarf.AttrStrOffsetsBase:
+			return template.HTML(fmt.Sprintf("<td>%s</td><td><a href=\"/stroffsets/%x\">%#x</a></td>", f.Attr.String(), en.E.Offset, f.Val))
 		default:
 			attrName = f.Attr.String()
 		}
@@ -184,20 +254,49 @@ var tmpl = template.Must(template.New("all").Funcs(funcMap).Parse(`<!doctype htm
 					el.style["display"] = "none";
 				}
 			}
+			function toggleBytes(e) {
+				var el = e.parentElement.getElementsByClassName("diebytes")[0];
+				if (el.style["display"] == "none") {
+					el.style["display"] = "block";
+				} else {
+					el.style["display"] = "none";
+				}
+			}
+			function highlightBytes(e, on) {
+				var el = document.getElementById("b" + e.dataset.die + "_" + e.dataset.field);
+				if (el) {
+					el.style["background-color"] = on ? "yellow" : "";
+				}
+			}
 		</script>
 	</head>
 	<body>
+		{{if IsRoot}}
+			{{template "dataSources"}}<hr/>
+			{{with Core}}{{template "coreThreads" .}}<hr/>{{end}}
+			{{with GoBuildInfo}}{{template "goBuildInfo" .}}<hr/>{{end}}
+		{{end}}
 		{{with $first := (index . 0)}}
 			{{if $first.IsFunction}}
 				<a href="#frames">Debug Frame Entries</a><hr/>
 			{{end}}
 			{{if $first.IsCompileUnit}}
-				<a href="/frames/">&gt;&gt; Debug Frame Section</a><hr/>
+				<a href="/frames/">&gt;&gt; Debug Frame Section</a><br/>
+				<a href="/rnglists/">&gt;&gt; Range Lists Section</a><br/>
+				<a href="/aranges/">&gt;&gt; Address Ranges Section</a><br/>
+				<a href="/names/">&gt;&gt; Accelerator Tables</a><br/>
+				<a href="/strings/">&gt;&gt; String Sections</a><br/>
+				{{if HasPclntab}}<a href="/pclntab/">&gt;&gt; Go Function Table</a><br/>{{end}}
+				{{if HasGoTypes}}<a href="/generics/">&gt;&gt; Go Generics</a><br/>{{end}}
+				{{with $first.AbbrevTable}}<a href="/abbrev/{{.Off | printf "%x"}}">&gt;&gt; Abbreviation Table</a><br/>{{end}}
+				<a href="/line/{{$first.E.Offset | printf "%x"}}">&gt;&gt; Line Number Program</a><hr/>
 			{{end}}
 		{{end}}
 		
-		{{range .}}<tt>
-			{{template "entryNode" .}}
+		{{range $i, $n := .}}{{with ModuleGroup $i}}
+			<h3>{{if .Main}}Main module{{with .Path}} <a href="/?module={{.}}">{{.}}</a>{{end}}{{else if .Path}}Module <a href="/?module={{.Path}}">{{.Path}}</a>{{else}}Other compile units{{end}}</h3>
+		{{end}}<tt>
+			{{template "entryNode" $n}}
 		</tt><hr>{{end}}
 		{{with $first := (index . 0)}}
 			{{if $first.IsFunction}}
@@ -211,7 +310,15 @@ var tmpl = template.Must(template.New("all").Funcs(funcMap).Parse(`<!doctype htm
 					{{end}}</tt>
 					<hr/>
 				{{end}}
-				
+				{{with $first.EhFrameHdr}}
+					<h3>.eh_frame_hdr</h3>
+					<table class='dwarftbl'>
+					<tr><td>Initial Location</td><td>FDE</td><td></td></tr>
+					{{range .}}
+					<tr><td>{{.Loc | printf "%#x"}}</td><td>{{.FDEAddr | printf "%#x"}}</td><td>{{if .Problem}}<b>{{.Problem}}</b>{{end}}</td></tr>
+					{{end}}
+					</table>
+				{{end}}
 			{{end}}
 		{{end}}
 		
@@ -223,9 +330,10 @@ var tmpl = template.Must(template.New("all").Funcs(funcMap).Parse(`<!doctype htm
 	<div style="padding-left: 1em;">
 		{{EntryNodeHeader .E}}<br>
 		<table style="padding-left: 1em;" class='dwarftbl'>
-		{{range .E.Field}}
-			<tr>{{EntryNodeField $en .}}</tr>
+		{{range $i, $f := .E.Field}}
+			<tr data-die="{{$en.E.Offset | printf "%x"}}" data-field="{{$i}}" onmouseover="highlightBytes(this, true)" onmouseout="highlightBytes(this, false)">{{EntryNodeField $en $f}}<td>{{EntryNodeForm $en $i}}</td></tr>
 		{{end}}
+		{{with .CoreValue}}<tr><td><i>Value in core</i></td><td>{{.}}</td></tr>{{end}}
 		</table>
 		{{if .Ranges}}
 			&nbsp;&nbsp;Ranges: 
@@ -246,21 +354,78 @@ var tmpl = template.Must(template.New("all").Funcs(funcMap).Parse(`<!doctype htm
 	</div>
 {{end}}
 
+{{define "dataSources"}}
+<table class='dwarftbl'>
+<tr><td>Architecture</td><td>{{Arch}}</td><td></td></tr>
+{{with Archive}}<tr><td>Archive</td><td><tt>{{.Path}}</tt></td><td><a href="/members/">{{len .Members}} members</a></td></tr>{{end}}
+{{range DataSources}}
+<tr><td>{{.What}}</td><td><tt>{{.Path}}</tt></td><td>{{if .How}}({{.How}}){{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+
+{{define "goBuildInfo"}}
+<h3>Go build info</h3>
+<table class='dwarftbl'>
+<tr><td>Go version</td><td>{{.Version}}{{with .Producer}} <b>(compile units: {{.}})</b>{{end}}</td></tr>
+{{with .Info}}
+<tr><td>Path</td><td>{{.Path}}</td></tr>
+{{range .Settings}}<tr><td>{{.Key}}</td><td>{{.Value}}</td></tr>
+{{end}}
+{{end}}
+{{with .Err}}<tr><td></td><td><b>{{.}}</b></td></tr>{{end}}
+</table>
+{{if .Modules}}
+<h4>Modules</h4>
+<table class='dwarftbl'>
+<tr><th>Module</th><th>Version</th><th>Sum</th><th>Replaced by</th><th>Compile units</th></tr>
+{{range .Modules}}<tr><td>{{.Path}}{{if .Main}} (main){{end}}</td><td>{{.Version}}</td><td>{{.Sum}}</td><td>{{with .Replace}}{{.Path}} {{.Version}} {{.Sum}}{{end}}</td><td>{{if .CUs}}<a href="/?module={{.Path}}">{{.CUs}}</a>{{else}}0{{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+
+{{define "coreThreads"}}
+<h3>Threads</h3>
+<table class='dwarftbl'>
+<tr><th>Thread</th><th>PC</th><th>SP</th><th>Function</th><th>Registers</th></tr>
+{{range .Threads}}
+<tr>
+<td>{{.Pid}}</td>
+<td>{{with .PC}}{{printf "%#x" .}}{{end}}</td>
+<td>{{with .SP}}{{printf "%#x" .}}{{end}}</td>
+<td>{{with .Function}}{{if .HasDIE}}<a href="/{{printf "%x" .Off}}">{{.Name}}</a>{{else}}{{.Name}} ({{.Source}}){{end}}{{end}}</td>
+<td><details><summary>{{len .Registers}} registers</summary><pre>{{range .Registers}}{{printf "%-8s %#x" .Name .Value}}
+{{end}}</pre></details></td>
+</tr>
+{{end}}
+</table>
+{{end}}
+
+{{define "frameEntryInfo"}}
+{{with FrameInfo .}}
+<tr><td>Section</td><td>{{.Section}} at {{.Offset | printf "%#x"}}</td></tr>
+{{if .Problem}}<tr><td>Problem</td><td><b>{{.Problem}}</b></td></tr>{{end}}
+{{end}}
+{{end}}
+
 {{define "commonInformationEntry"}}
 <table class='cietbl'>
+{{template "frameEntryInfo" .}}
 <tr><td>Length</td><td>{{.Length}}</td></tr>
 <tr><td>CIE Id</td><td>{{.CIE_id}}</td></tr>
 <tr><td>Version</td><td>{{.Version}}</td></tr>
 <tr><td>Augmentation</td><td>{{.Augmentation | printf "%q"}}</td></tr>
 <tr><td>Code Alignment Factor</td><td>{{.CodeAlignmentFactor}}</td></tr>
 <tr><td>Data Alignment Factor</td><td>{{.DataAlignmentFactor}}</td></tr>
-<tr><td>Return Address Register</td><td>{{.ReturnAddressRegister}}</td></tr>
+<tr><td>Return Address Register</td><td>{{.ReturnAddressRegister}} {{with RegName .ReturnAddressRegister}}({{.}}){{end}}</td></tr>
 </table>
 <pre>{{.InitialInstructions | FmtFrameInstr }}</pre>
 {{end}}
 
 {{define "frameDescriptionEntry"}}
 <table class='fdetbl'>
+{{template "frameEntryInfo" .}}
 <tr><td>Length</td><td>{{.Length}}</td></tr>
 <tr><td>CIE</td><td>{{.CIE.CIE_id}}</td></tr>
 <tr><td>Begin</td><td>{{.Begin | printf "%#x"}}</td></tr>
@@ -295,12 +460,18 @@ var instantiationsTmpl = template.Must(template.New("fn").Funcs(funcMap).Parse(`
 `))
 
 func offset(r *http.Request) dwarf.Offset {
+	return dwarf.Offset(address(r))
+}
+
+// address returns the first hexadecimal component of the request path,
+// addresses can be wider than a dwarf.Offset.
+func address(r *http.Request) uint64 {
 	v := strings.Split(r.URL.Path, "/")
 	for _, x := range v {
 		if len(x) != 0 {
 			n, err := strconv.ParseUint(x, 16, 64)
 			if err == nil {
-				return dwarf.Offset(n)
+				return n
 			}
 		}
 	}
@@ -347,12 +518,17 @@ func rangesOverlap(a, b [2]uint64) bool {
 func allHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	off := offset(r)
-	root := off == 0
 	frames := strings.HasPrefix(r.URL.Path, "/frames/")
+	root := off == 0 && !frames
 
 	mu.Lock()
 	defer mu.Unlock()
 
+	if Dwarf == nil && Archive != nil {
+		http.Redirect(w, r, "/members/", http.StatusFound)
+		return
+	}
+
 	rdr := Dwarf.Reader()
 
 	// Check if this is a subprogram to serve a different type of page
@@ -380,6 +556,13 @@ func allHandler(w http.ResponseWriter, r *http.Request) {
 
 			rdr.Seek(off)
 			entryNode, addOffs := toEntryNode(rdr)
+			if su := Dwarf.splitForSkeleton(entryNode.E.Offset); root && su != nil && su.data != nil {
+				// show the split unit in place of its skeleton
+				srdr := Dwarf.Reader()
+				srdr.Seek(su.cuOff)
+				entryNode, addOffs = toEntryNode(srdr)
+				seen[su.cuOff] = true
+			}
 			stack = append(stack, addOffs...)
 			nodes = append(nodes, entryNode)
 			if root {
@@ -394,6 +577,26 @@ func allHandler(w http.ResponseWriter, r *http.Request) {
 		nodes = append(nodes, e)
 	}
 
+	if mod := r.Form.Get("module"); root && mod != "" {
+		bi := buildInfo()
+		var cus []*EntryNode
+		for _, n := range nodes {
+			if n.E.Tag == dwarf.TagCompileUnit && bi != nil && bi.inModule(n.E, mod) {
+				cus = append(cus, n)
+			}
+		}
+		if len(cus) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		nodes = cus
+	}
+
+	var groups map[int]*goModule
+	if bi := buildInfo(); root && r.Form.Get("module") == "" && bi != nil && len(bi.Modules) > 0 && allCompileUnits(nodes) {
+		groups = bi.groupByModule(nodes)
+	}
+
 	if allCompileUnits(nodes) && len(nodes) > 1 {
 		if countNodes(nodes) > 10000 {
 			for _, n := range nodes {
@@ -405,6 +608,12 @@ func allHandler(w http.ResponseWriter, r *http.Request) {
 	must(tmpl.Funcs(template.FuncMap{
 		"EntryNodeField": func(en *EntryNode, f *dwarf.Field) template.HTML {
 			return fmtEntryNodeField(en, f, nodes)
+		},
+		"IsRoot": func() bool {
+			return root
+		},
+		"ModuleGroup": func(i int) *goModule {
+			return groups[i]
 		}}).Execute(w, nodes))
 }
 
@@ -414,6 +623,21 @@ func framesHandler(w http.ResponseWriter, r *http.Request) {
 
 func serve() {
 	http.HandleFunc("/disassemble/", handlerWrapper(disassembleHandler))
+	http.HandleFunc("/members/", handlerWrapper(membersHandler))
+	http.HandleFunc("/line/", handlerWrapper(lineHandler))
+	http.HandleFunc("/rnglists/", handlerWrapper(rnglistsHandler))
+	http.HandleFunc("/aranges/", handlerWrapper(arangesHandler))
+	http.HandleFunc("/names/", handlerWrapper(accelHandler))
+	http.HandleFunc("/abbrev/", handlerWrapper(abbrevHandler))
+	http.HandleFunc("/macro/", handlerWrapper(macroHandler))
+	http.HandleFunc("/strings/", handlerWrapper(strHandler))
+	http.HandleFunc("/stroffsets/", handlerWrapper(strOffsetsHandler))
+	http.HandleFunc("/pclntab/", handlerWrapper(pclntabHandler))
+	http.HandleFunc("/pcfunc/", handlerWrapper(pcfuncHandler))
+	http.HandleFunc("/pccheck/", handlerWrapper(pclnCheckHandler))
+	http.HandleFunc("/rtype/", handlerWrapper(rtypeHandler))
+	http.HandleFunc("/generics/", handlerWrapper(genericsHandler))
+	http.HandleFunc("/generic/", handlerWrapper(genericHandler))
 	http.HandleFunc("/", handlerWrapper(allHandler))
 
 	s := &http.Server{